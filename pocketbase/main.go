@@ -8,6 +8,7 @@ import (
 
 	"github.com/joho/godotenv"
 	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/ai_chat"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/book_export"
 	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/book_hooks"
 	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/chapter_hooks"
 	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/chats"
@@ -15,6 +16,10 @@ import (
 	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/full_text_search"
 	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/highlight_hooks"
 	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/message_hooks"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/opds"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/progress"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/quota"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/reader_sync"
 	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/stripe_webhooks"
 	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/vector_search"
 	"github.com/mattn/go-sqlite3"
@@ -60,6 +65,10 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
+	if err := quota.Init(app); err != nil {
+		log.Fatal(err)
+	}
+
 	if err := ai_chat.Init(app); err != nil {
 		log.Fatal(err)
 	}
@@ -80,6 +89,10 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err := book_export.Init(app); err != nil {
+		log.Fatal(err)
+	}
+
 	if err := chapter_hooks.Init(app); err != nil {
 		log.Fatal(err)
 	}
@@ -102,6 +115,18 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err := opds.Init(app); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := progress.Init(app); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := reader_sync.Init(app); err != nil {
+		log.Fatal(err)
+	}
+
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
 		se.Router.GET("/{path...}", apis.Static(os.DirFS("./pb_public"), true))
 		return se.Next()
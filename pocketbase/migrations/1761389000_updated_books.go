@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2170393721")
+		if err != nil {
+			return err
+		}
+
+		// update field
+		if err := collection.Fields.AddMarshaledJSONAt(8, []byte(`{
+			"hidden": false,
+			"id": "file2359244304",
+			"maxSelect": 1,
+			"maxSize": 25000000,
+			"mimeTypes": [
+				"application/epub+zip",
+				"application/pdf",
+				"text/plain",
+				"text/markdown",
+				"text/html"
+			],
+			"name": "file",
+			"presentable": false,
+			"protected": true,
+			"required": true,
+			"system": false,
+			"thumbs": [],
+			"type": "file"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2170393721")
+		if err != nil {
+			return err
+		}
+
+		// update field
+		if err := collection.Fields.AddMarshaledJSONAt(8, []byte(`{
+			"hidden": false,
+			"id": "file2359244304",
+			"maxSelect": 1,
+			"maxSize": 25000000,
+			"mimeTypes": [
+				"application/epub+zip",
+				"application/pdf"
+			],
+			"name": "file",
+			"presentable": false,
+			"protected": true,
+			"required": true,
+			"system": false,
+			"thumbs": [],
+			"type": "file"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "pbc_2170393721",
+					"hidden": false,
+					"id": "relation3420824369",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "book",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text888727361",
+					"max": 0,
+					"min": 0,
+					"name": "href",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": true,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"hidden": false,
+					"id": "file2359244304",
+					"maxSelect": 1,
+					"maxSize": 10000000,
+					"mimeTypes": [
+						"image/jpeg",
+						"image/png",
+						"image/gif",
+						"image/webp",
+						"image/svg+xml"
+					],
+					"name": "file",
+					"presentable": false,
+					"protected": false,
+					"required": true,
+					"system": false,
+					"thumbs": [],
+					"type": "file"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "_pb_users_auth_",
+					"hidden": false,
+					"id": "relation2375276105",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "user",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_1342600707",
+			"indexes": [
+				"CREATE INDEX ` + "`" + `idx_book_assets_book` + "`" + ` ON ` + "`" + `book_assets` + "`" + ` (` + "`" + `book` + "`" + `)"
+			],
+			"listRule": "@request.auth.id = user.id",
+			"name": "book_assets",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": "@request.auth.id = user.id"
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_1342600707")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
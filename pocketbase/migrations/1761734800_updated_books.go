@@ -0,0 +1,71 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2170393721")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(14, []byte(`{
+			"hidden": false,
+			"id": "number4156564586",
+			"max": null,
+			"min": 0,
+			"name": "size",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// backfill the size of books uploaded before the field existed
+		books, err := app.FindAllRecords(collection)
+		if err != nil {
+			return err
+		}
+
+		fsys, err := app.NewFilesystem()
+		if err != nil {
+			return err
+		}
+		defer fsys.Close()
+
+		for _, book := range books {
+			attrs, err := fsys.Attributes(book.BaseFilesPath() + "/" + book.GetString("file"))
+			if err != nil {
+				continue
+			}
+
+			book.Set("size", attrs.Size)
+			if err := app.SaveNoValidate(book); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2170393721")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("number4156564586")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2170393721")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE INDEX `+"`"+`idx_sBRT4XwfD0`+"`"+` ON `+"`"+`books`+"`"+` (`+"`"+`user`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_books_content_hash`+"`"+` ON `+"`"+`books`+"`"+` (`+"`"+`content_hash`+"`"+`)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(15, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text484085629",
+			"max": 0,
+			"min": 0,
+			"name": "content_hash",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// backfill the hash of books uploaded before the field existed
+		books, err := app.FindAllRecords(collection)
+		if err != nil {
+			return err
+		}
+
+		fsys, err := app.NewFilesystem()
+		if err != nil {
+			return err
+		}
+		defer fsys.Close()
+
+		for _, book := range books {
+			r, err := fsys.GetReader(book.BaseFilesPath() + "/" + book.GetString("file"))
+			if err != nil {
+				continue
+			}
+
+			hash := sha256.New()
+			_, err = io.Copy(hash, r)
+			r.Close()
+			if err != nil {
+				continue
+			}
+
+			book.Set("content_hash", hex.EncodeToString(hash.Sum(nil)))
+			if err := app.SaveNoValidate(book); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2170393721")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE INDEX `+"`"+`idx_sBRT4XwfD0`+"`"+` ON `+"`"+`books`+"`"+` (`+"`"+`user`+"`"+`)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("text484085629")
+
+		return app.Save(collection)
+	})
+}
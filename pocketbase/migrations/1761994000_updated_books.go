@@ -0,0 +1,185 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2170393721")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE INDEX `+"`"+`idx_sBRT4XwfD0`+"`"+` ON `+"`"+`books`+"`"+` (`+"`"+`user`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_books_content_hash`+"`"+` ON `+"`"+`books`+"`"+` (`+"`"+`content_hash`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_books_series`+"`"+` ON `+"`"+`books`+"`"+` (`+"`"+`user`+"`"+`, `+"`"+`series`+"`"+`, `+"`"+`series_index`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_books_publisher`+"`"+` ON `+"`"+`books`+"`"+` (`+"`"+`user`+"`"+`, `+"`"+`publisher`+"`"+`)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(16, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text2632504646",
+			"max": 0,
+			"min": 0,
+			"name": "publisher",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(17, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text3424449766",
+			"max": 0,
+			"min": 0,
+			"name": "isbn",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(18, []byte(`{
+			"hidden": false,
+			"id": "json3055446478",
+			"maxSize": 0,
+			"name": "identifiers",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "json"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(19, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text974127405",
+			"max": 0,
+			"min": 0,
+			"name": "series",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(20, []byte(`{
+			"hidden": false,
+			"id": "number4126966556",
+			"max": null,
+			"min": null,
+			"name": "series_index",
+			"onlyInt": false,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(21, []byte(`{
+			"hidden": false,
+			"id": "json1926390370",
+			"maxSize": 0,
+			"name": "contributors",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "json"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(22, []byte(`{
+			"autogeneratePattern": "",
+			"hidden": false,
+			"id": "text23122179",
+			"max": 0,
+			"min": 0,
+			"name": "rights",
+			"pattern": "",
+			"presentable": false,
+			"primaryKey": false,
+			"required": false,
+			"system": false,
+			"type": "text"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2170393721")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE INDEX `+"`"+`idx_sBRT4XwfD0`+"`"+` ON `+"`"+`books`+"`"+` (`+"`"+`user`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_books_content_hash`+"`"+` ON `+"`"+`books`+"`"+` (`+"`"+`content_hash`+"`"+`)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("text2632504646")
+
+		// remove field
+		collection.Fields.RemoveById("text3424449766")
+
+		// remove field
+		collection.Fields.RemoveById("json3055446478")
+
+		// remove field
+		collection.Fields.RemoveById("text974127405")
+
+		// remove field
+		collection.Fields.RemoveById("number4126966556")
+
+		// remove field
+		collection.Fields.RemoveById("json1926390370")
+
+		// remove field
+		collection.Fields.RemoveById("text23122179")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,214 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		jsonData := `{
+			"createRule": null,
+			"deleteRule": null,
+			"fields": [
+				{
+					"autogeneratePattern": "[a-z0-9]{15}",
+					"hidden": false,
+					"id": "text3208210256",
+					"max": 15,
+					"min": 15,
+					"name": "id",
+					"pattern": "^[a-z0-9]+$",
+					"presentable": false,
+					"primaryKey": true,
+					"required": true,
+					"system": true,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "pbc_2170393721",
+					"hidden": false,
+					"id": "relation3420824369",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "book",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"cascadeDelete": false,
+					"collectionId": "pbc_2272205672",
+					"hidden": false,
+					"id": "relation4186027310",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "chapter",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"cascadeDelete": false,
+					"collectionId": "pbc_2272205672",
+					"hidden": false,
+					"id": "relation155511293",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "start_chapter",
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"hidden": false,
+					"id": "number3787780032",
+					"max": 100,
+					"min": 0,
+					"name": "start_percentage",
+					"onlyInt": false,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "number2638420144",
+					"max": 100,
+					"min": 0,
+					"name": "end_percentage",
+					"onlyInt": false,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "date3029767898",
+					"max": "",
+					"min": "",
+					"name": "started",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"hidden": false,
+					"id": "date1367529039",
+					"max": "",
+					"min": "",
+					"name": "ended",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "date"
+				},
+				{
+					"hidden": false,
+					"id": "number2254405824",
+					"max": null,
+					"min": 0,
+					"name": "duration",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"hidden": false,
+					"id": "number1904025228",
+					"max": null,
+					"min": 0,
+					"name": "words",
+					"onlyInt": true,
+					"presentable": false,
+					"required": false,
+					"system": false,
+					"type": "number"
+				},
+				{
+					"autogeneratePattern": "",
+					"hidden": false,
+					"id": "text154121870",
+					"max": 100,
+					"min": 0,
+					"name": "device",
+					"pattern": "",
+					"presentable": false,
+					"primaryKey": false,
+					"required": false,
+					"system": false,
+					"type": "text"
+				},
+				{
+					"cascadeDelete": true,
+					"collectionId": "_pb_users_auth_",
+					"hidden": false,
+					"id": "relation2375276105",
+					"maxSelect": 1,
+					"minSelect": 0,
+					"name": "user",
+					"presentable": false,
+					"required": true,
+					"system": false,
+					"type": "relation"
+				},
+				{
+					"hidden": false,
+					"id": "autodate2990389176",
+					"name": "created",
+					"onCreate": true,
+					"onUpdate": false,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				},
+				{
+					"hidden": false,
+					"id": "autodate3332085495",
+					"name": "updated",
+					"onCreate": true,
+					"onUpdate": true,
+					"presentable": false,
+					"system": false,
+					"type": "autodate"
+				}
+			],
+			"id": "pbc_3432497315",
+			"indexes": [
+				"CREATE INDEX ` + "`" + `idx_reading_sessions_user_started` + "`" + ` ON ` + "`" + `reading_sessions` + "`" + ` (` + "`" + `user` + "`" + `, ` + "`" + `started` + "`" + `)",
+				"CREATE INDEX ` + "`" + `idx_reading_sessions_user_book` + "`" + ` ON ` + "`" + `reading_sessions` + "`" + ` (` + "`" + `user` + "`" + `, ` + "`" + `book` + "`" + `, ` + "`" + `ended` + "`" + `)"
+			],
+			"listRule": "@request.auth.id = user.id",
+			"name": "reading_sessions",
+			"system": false,
+			"type": "base",
+			"updateRule": null,
+			"viewRule": "@request.auth.id = user.id"
+		}`
+
+		collection := &core.Collection{}
+		if err := json.Unmarshal([]byte(jsonData), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3432497315")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
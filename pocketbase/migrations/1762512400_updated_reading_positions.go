@@ -0,0 +1,158 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_497590701")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE UNIQUE INDEX `+"`"+`idx_reading_positions_user_book`+"`"+` ON `+"`"+`reading_positions`+"`"+` (`+"`"+`user`+"`"+`, `+"`"+`book`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_reading_positions_user_opened`+"`"+` ON `+"`"+`reading_positions`+"`"+` (`+"`"+`user`+"`"+`, `+"`"+`opened`+"`"+`)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(9, []byte(`{
+			"hidden": false,
+			"id": "date2908104539",
+			"max": "",
+			"min": "",
+			"name": "opened",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "date"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(10, []byte(`{
+			"hidden": false,
+			"id": "bool3194813053",
+			"name": "removed",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "bool"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		findPosition := func(userId, bookId string) (*core.Record, error) {
+			positions, err := app.FindAllRecords(collection, dbx.HashExp{"user": userId, "book": bookId})
+			if err != nil {
+				return nil, err
+			}
+			if len(positions) > 0 {
+				return positions[0], nil
+			}
+
+			position := core.NewRecord(collection)
+			position.Set("user", userId)
+			position.Set("book", bookId)
+			return position, nil
+		}
+
+		// progress used to be kept in last_read, one record per user, and in
+		// the book's current_chapter
+		positions, err := app.FindAllRecords(collection)
+		if err != nil {
+			return err
+		}
+		for _, position := range positions {
+			position.Set("opened", position.GetDateTime("updated"))
+			if err := app.SaveNoValidate(position); err != nil {
+				return err
+			}
+		}
+
+		lastReads, err := app.FindAllRecords("last_read")
+		if err != nil {
+			return err
+		}
+		for _, lastRead := range lastReads {
+			if lastRead.GetString("book") == "" {
+				continue
+			}
+
+			position, err := findPosition(lastRead.GetString("user"), lastRead.GetString("book"))
+			if err != nil {
+				return err
+			}
+			if position.GetString("chapter") == "" {
+				position.Set("chapter", lastRead.GetString("chapter"))
+			}
+			position.Set("opened", lastRead.GetDateTime("updated"))
+			if err := app.SaveNoValidate(position); err != nil {
+				return err
+			}
+		}
+
+		books, err := app.FindAllRecords("books", dbx.NewExp("[[current_chapter]] != ''"))
+		if err != nil {
+			return err
+		}
+		for _, book := range books {
+			position, err := findPosition(book.GetString("user"), book.Id)
+			if err != nil {
+				return err
+			}
+			if !position.IsNew() {
+				continue
+			}
+
+			// imports set current_chapter to the first chapter, so any other
+			// chapter means the book was opened
+			position.Set("chapter", book.GetString("current_chapter"))
+			if chapters := book.GetStringSlice("chapters"); len(chapters) == 0 || chapters[0] != book.GetString("current_chapter") {
+				position.Set("opened", book.GetDateTime("updated"))
+			}
+			if err := app.SaveNoValidate(position); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_497590701")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE UNIQUE INDEX `+"`"+`idx_reading_positions_user_book`+"`"+` ON `+"`"+`reading_positions`+"`"+` (`+"`"+`user`+"`"+`, `+"`"+`book`+"`"+`)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("date2908104539")
+
+		// remove field
+		collection.Fields.RemoveById("bool3194813053")
+
+		return app.Save(collection)
+	})
+}
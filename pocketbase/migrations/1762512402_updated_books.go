@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2170393721")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("relation1401696427")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_2170393721")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(5, []byte(`{
+			"cascadeDelete": false,
+			"collectionId": "pbc_2272205672",
+			"hidden": false,
+			"id": "relation1401696427",
+			"maxSelect": 1,
+			"minSelect": 0,
+			"name": "current_chapter",
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "relation"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		// restore the owner's chapter from their reading position
+		books, err := app.FindAllRecords(collection)
+		if err != nil {
+			return err
+		}
+		for _, book := range books {
+			positions, err := app.FindAllRecords("reading_positions", dbx.HashExp{"user": book.GetString("user"), "book": book.Id})
+			if err != nil {
+				return err
+			}
+
+			chapter := ""
+			if len(positions) > 0 {
+				chapter = positions[0].GetString("chapter")
+			} else if chapters := book.GetStringSlice("chapters"); len(chapters) > 0 {
+				chapter = chapters[0]
+			}
+
+			book.Set("current_chapter", chapter)
+			if err := app.SaveNoValidate(book); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3301151734")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE INDEX `+"`"+`idx_38wKpMHGuE`+"`"+` ON `+"`"+`highlights`+"`"+` (\n  `+"`"+`book`+"`"+`,\n  `+"`"+`user`+"`"+`\n)",
+				"CREATE INDEX `+"`"+`idx_pQOSeiJo5E`+"`"+` ON `+"`"+`highlights`+"`"+` (\n  `+"`"+`book`+"`"+`,\n  `+"`"+`user`+"`"+`,\n  `+"`"+`chapter`+"`"+`\n)",
+				"CREATE INDEX `+"`"+`idx_highlights_user_seq`+"`"+` ON `+"`"+`highlights`+"`"+` (`+"`"+`user`+"`"+`, `+"`"+`seq`+"`"+`)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(6, []byte(`{
+			"hidden": false,
+			"id": "number1600875692",
+			"max": null,
+			"min": 0,
+			"name": "modified",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(7, []byte(`{
+			"hidden": false,
+			"id": "number2524893523",
+			"max": null,
+			"min": 0,
+			"name": "seq",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_3301151734")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE INDEX `+"`"+`idx_38wKpMHGuE`+"`"+` ON `+"`"+`highlights`+"`"+` (\n  `+"`"+`book`+"`"+`,\n  `+"`"+`user`+"`"+`\n)",
+				"CREATE INDEX `+"`"+`idx_pQOSeiJo5E`+"`"+` ON `+"`"+`highlights`+"`"+` (\n  `+"`"+`book`+"`"+`,\n  `+"`"+`user`+"`"+`,\n  `+"`"+`chapter`+"`"+`\n)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("number1600875692")
+
+		// remove field
+		collection.Fields.RemoveById("number2524893523")
+
+		return app.Save(collection)
+	})
+}
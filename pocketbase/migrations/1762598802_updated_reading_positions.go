@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_497590701")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE UNIQUE INDEX `+"`"+`idx_reading_positions_user_book`+"`"+` ON `+"`"+`reading_positions`+"`"+` (`+"`"+`user`+"`"+`, `+"`"+`book`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_reading_positions_user_opened`+"`"+` ON `+"`"+`reading_positions`+"`"+` (`+"`"+`user`+"`"+`, `+"`"+`opened`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_reading_positions_user_seq`+"`"+` ON `+"`"+`reading_positions`+"`"+` (`+"`"+`user`+"`"+`, `+"`"+`seq`+"`"+`)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(11, []byte(`{
+			"hidden": false,
+			"id": "number2524893523",
+			"max": null,
+			"min": 0,
+			"name": "seq",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_497590701")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"indexes": [
+				"CREATE UNIQUE INDEX `+"`"+`idx_reading_positions_user_book`+"`"+` ON `+"`"+`reading_positions`+"`"+` (`+"`"+`user`+"`"+`, `+"`"+`book`+"`"+`)",
+				"CREATE INDEX `+"`"+`idx_reading_positions_user_opened`+"`"+` ON `+"`"+`reading_positions`+"`"+` (`+"`"+`user`+"`"+`, `+"`"+`opened`+"`"+`)"
+			]
+		}`), &collection); err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("number2524893523")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// the sync sequence moves out of the users table, which is saved as a whole
+// row by code that may hold an older copy of it
+func init() {
+	m.Register(func(app core.App) error {
+		_, err := app.DB().NewQuery(`
+			INSERT INTO {{sync_counters}} ([[id]], [[user]], [[seq]])
+			SELECT substr(lower(hex(randomblob(8))), 1, 15), [[id]], [[sync_seq]]
+			FROM {{users}}
+			WHERE [[sync_seq]] > 0
+		`).Execute()
+		if err != nil {
+			return err
+		}
+
+		collection, err := app.FindCollectionByNameOrId("_pb_users_auth_")
+		if err != nil {
+			return err
+		}
+
+		// remove field
+		collection.Fields.RemoveById("number674277600")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("_pb_users_auth_")
+		if err != nil {
+			return err
+		}
+
+		// add field
+		if err := collection.Fields.AddMarshaledJSONAt(11, []byte(`{
+			"hidden": true,
+			"id": "number674277600",
+			"max": null,
+			"min": 0,
+			"name": "sync_seq",
+			"onlyInt": true,
+			"presentable": false,
+			"required": false,
+			"system": false,
+			"type": "number"
+		}`)); err != nil {
+			return err
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+
+		_, err = app.DB().NewQuery(`
+			UPDATE {{users}} SET [[sync_seq]] = (
+				SELECT [[seq]] FROM {{sync_counters}} WHERE [[sync_counters.user]] = [[users.id]]
+			)
+			WHERE [[id]] IN (SELECT [[user]] FROM {{sync_counters}})
+		`).Execute()
+		return err
+	})
+}
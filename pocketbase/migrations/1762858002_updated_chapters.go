@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// chapter content links to its assets with root-relative paths instead of
+// URLs under the app URL, which break when the app is reached at another one
+func init() {
+	m.Register(func(app core.App) error {
+		baseURL := strings.TrimRight(app.Settings().Meta.AppURL, "/")
+		if baseURL == "" {
+			return nil
+		}
+
+		_, err := app.DB().NewQuery(`
+			UPDATE {{chapters}}
+			SET [[content]] = REPLACE([[content]], {:absolute}, '/api/files/')
+			WHERE INSTR([[content]], {:absolute}) > 0
+		`).Bind(dbx.Params{"absolute": baseURL + "/api/files/"}).Execute()
+
+		return err
+	}, func(app core.App) error {
+		return nil
+	})
+}
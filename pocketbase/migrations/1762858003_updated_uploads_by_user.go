@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// books whose import failed don't count towards the upload limit
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_1286117294")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"viewQuery": "SELECT users.id, users.email, COUNT(books.id) as uploadCount\nFROM users\nLEFT JOIN books ON users.id = books.user AND books.import_error = ''\nGROUP BY users.id\nORDER BY uploadCount DESC;"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("pbc_1286117294")
+		if err != nil {
+			return err
+		}
+
+		// update collection data
+		if err := json.Unmarshal([]byte(`{
+			"viewQuery": "SELECT users.id, users.email, COUNT(books.id) as uploadCount\nFROM users\nLEFT JOIN books ON users.id = books.user\nGROUP BY users.id\nORDER BY uploadCount DESC;"
+		}`), &collection); err != nil {
+			return err
+		}
+
+		return app.Save(collection)
+	})
+}
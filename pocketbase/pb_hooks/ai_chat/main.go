@@ -3,11 +3,13 @@ package ai_chat
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
 
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/quota"
 	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/vector_search"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
@@ -37,6 +39,15 @@ func Init(app *pocketbase.PocketBase) error {
 				return e.BadRequestError("failed to read chat request data", err)
 			}
 
+			// the user's message has already been created and counted
+			if err := quota.CheckMessages(e.App, e.Auth, 0); err != nil {
+				var exceeded *quota.ExceededError
+				if errors.As(err, &exceeded) {
+					return e.ForbiddenError(exceeded.Message, nil)
+				}
+				return e.InternalServerError("failed to check message quota", err)
+			}
+
 			book, err := e.App.FindRecordById("books", data.BookId)
 			if err != nil {
 				return e.InternalServerError("failed to get book information", err)
@@ -0,0 +1,342 @@
+package book_export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/highlight_hooks"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+var highlightFormats = map[string]string{
+	"md":   "text/markdown; charset=utf-8",
+	"csv":  "text/csv; charset=utf-8",
+	"json": "application/json",
+	"txt":  "text/plain; charset=utf-8",
+}
+
+// HighlightsExport is a book's highlights grouped by chapter, in the order of
+// the chapters and of the highlights in them.
+type HighlightsExport struct {
+	Book     string              `json:"book"`
+	Title    string              `json:"title"`
+	Author   string              `json:"author"`
+	Exported types.DateTime      `json:"exported"`
+	Chapters []ChapterHighlights `json:"chapters"`
+}
+
+type ChapterHighlights struct {
+	Id         string              `json:"id"`
+	Title      string              `json:"title"`
+	Order      int                 `json:"order"`
+	Highlights []ExportedHighlight `json:"highlights"`
+}
+
+// ExportedHighlight is where a highlight is as Kindle style locations, counted
+// from the start of the book, along with its anchor in the chapter.
+type ExportedHighlight struct {
+	Id          string         `json:"id"`
+	Text        string         `json:"text"`
+	Note        string         `json:"note"`
+	Color       string         `json:"color"`
+	Tags        []string       `json:"tags"`
+	Location    int            `json:"location"`
+	EndLocation int            `json:"endLocation"`
+	Created     types.DateTime `json:"created"`
+	highlight_hooks.Anchor
+}
+
+// exportHighlights returns the user's highlights and notes in the book as
+// Markdown, Readwise CSV, JSON or a "My Clippings.txt" like text file.
+func exportHighlights(e *core.RequestEvent) error {
+	format := e.Request.URL.Query().Get("format")
+	if format == "" {
+		format = "md"
+	}
+	contentType, ok := highlightFormats[format]
+	if !ok {
+		return e.BadRequestError("format must be one of md, csv, json or txt.", nil)
+	}
+
+	book, err := e.App.FindRecordById("books", e.Request.PathValue("id"))
+	if err != nil || book.GetString("user") != e.Auth.Id {
+		return e.NotFoundError("Book not found.", err)
+	}
+
+	export, err := bookHighlights(e.App, e.Auth.Id, book)
+	if err != nil {
+		return e.InternalServerError("failed to get highlights", err)
+	}
+
+	var body []byte
+	switch format {
+	case "md":
+		body = highlightsMarkdown(export)
+	case "csv":
+		body, err = highlightsCSV(export)
+	case "json":
+		body, err = json.MarshalIndent(export, "", "  ")
+	case "txt":
+		body = highlightsClippings(export)
+	}
+	if err != nil {
+		return e.InternalServerError("failed to export highlights", err)
+	}
+
+	filename := fmt.Sprintf("%s-highlights.%s", titleSlug(book.GetString("title")), format)
+	e.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	return e.Blob(http.StatusOK, contentType, body)
+}
+
+func bookHighlights(app core.App, userId string, book *core.Record) (*HighlightsExport, error) {
+	export := &HighlightsExport{
+		Book:     book.Id,
+		Title:    book.GetString("title"),
+		Author:   book.GetString("author"),
+		Exported: types.NowDateTime(),
+		Chapters: []ChapterHighlights{},
+	}
+
+	highlights, err := app.FindRecordsByFilter(
+		"highlights",
+		"book = {:book} && user = {:user}",
+		"created",
+		0,
+		0,
+		dbx.Params{"book": book.Id, "user": userId},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	byChapter := make(map[string][]*core.Record)
+	var tagIds []string
+	for _, highlight := range highlights {
+		byChapter[highlight.GetString("chapter")] = append(byChapter[highlight.GetString("chapter")], highlight)
+		tagIds = append(tagIds, highlight.GetStringSlice("tags")...)
+	}
+
+	tagRecords, err := app.FindRecordsByIds("tags", tagIds)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(tagRecords))
+	for _, tag := range tagRecords {
+		tags[tag.Id] = tag.GetString("name")
+	}
+
+	chapters, err := app.FindRecordsByFilter("chapters", "book = {:book}", "order", 0, 0, dbx.Params{"book": book.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	// where the chapter starts in the text of the book
+	offset := 0
+	for _, chapter := range chapters {
+		length, err := highlight_hooks.TextLength(chapter.GetString("content"))
+		if err != nil {
+			return nil, err
+		}
+
+		chapterHighlights := byChapter[chapter.Id]
+		if len(chapterHighlights) == 0 {
+			offset += length
+			continue
+		}
+		sort.SliceStable(chapterHighlights, func(i, j int) bool {
+			return chapterHighlights[i].GetInt("start") < chapterHighlights[j].GetInt("start")
+		})
+
+		exported := ChapterHighlights{
+			Id:         chapter.Id,
+			Title:      chapter.GetString("title"),
+			Order:      chapter.GetInt("order"),
+			Highlights: make([]ExportedHighlight, 0, len(chapterHighlights)),
+		}
+		for _, highlight := range chapterHighlights {
+			anchor := highlight_hooks.AnchorFromRecord(highlight)
+
+			tagNames := []string{}
+			for _, id := range highlight.GetStringSlice("tags") {
+				if name, ok := tags[id]; ok {
+					tagNames = append(tagNames, name)
+				}
+			}
+
+			exported.Highlights = append(exported.Highlights, ExportedHighlight{
+				Id:          highlight.Id,
+				Text:        highlight.GetString("text"),
+				Note:        highlight.GetString("note"),
+				Color:       highlight.GetString("color"),
+				Tags:        tagNames,
+				Location:    location(offset + anchor.Start),
+				EndLocation: location(offset + max(anchor.Start, anchor.End-1)),
+				Created:     highlight.GetDateTime("created"),
+				Anchor:      anchor,
+			})
+		}
+
+		export.Chapters = append(export.Chapters, exported)
+		offset += length
+	}
+
+	return export, nil
+}
+
+// highlightsMarkdown writes the highlights as quotes under a heading for each
+// chapter, followed by their notes. Tags become hashtags, as Obsidian uses
+// them.
+func highlightsMarkdown(export *HighlightsExport) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "# %s\n\n", export.Title)
+	if export.Author != "" {
+		fmt.Fprintf(&buf, "%s\n\n", export.Author)
+	}
+
+	for _, chapter := range export.Chapters {
+		fmt.Fprintf(&buf, "## %s\n\n", chapterTitle(chapter))
+
+		for _, highlight := range chapter.Highlights {
+			for _, line := range strings.Split(strings.TrimSpace(highlight.Text), "\n") {
+				fmt.Fprintf(&buf, "> %s\n", line)
+			}
+			buf.WriteString("\n")
+
+			if note := strings.TrimSpace(highlight.Note); note != "" {
+				buf.WriteString(note + "\n\n")
+			}
+
+			buf.WriteString(locationLabel(highlight))
+			for _, tag := range highlight.Tags {
+				buf.WriteString(" #" + tagSlug(tag))
+			}
+			buf.WriteString("\n\n")
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// highlightsCSV writes the highlights in the columns Readwise imports. Tags
+// are put at the start of the note, which is how Readwise tags highlights.
+// Text cells are passed through csvCell, as the file may also be opened in a
+// spreadsheet.
+func highlightsCSV(export *HighlightsExport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write([]string{"Highlight", "Title", "Author", "URL", "Note", "Location", "Location Type", "Date"}); err != nil {
+		return nil, err
+	}
+	for _, chapter := range export.Chapters {
+		for _, highlight := range chapter.Highlights {
+			note := strings.TrimSpace(highlight.Note)
+			if len(highlight.Tags) > 0 {
+				tags := make([]string, len(highlight.Tags))
+				for i, tag := range highlight.Tags {
+					tags[i] = "." + tagSlug(tag)
+				}
+				note = strings.TrimSpace(strings.Join(tags, " ") + "\n" + note)
+			}
+
+			err := w.Write([]string{
+				csvCell(highlight.Text),
+				csvCell(export.Title),
+				csvCell(export.Author),
+				"",
+				csvCell(note),
+				strconv.Itoa(highlight.Location),
+				"location",
+				highlight.Created.Time().UTC().Format("2006-01-02 15:04:05"),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// csvCell prefixes the value with a quote if it starts with a character that
+// makes spreadsheets read it as a formula.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// highlightsClippings writes the highlights the way a Kindle writes them to
+// "My Clippings.txt", with each note as an entry after its highlight.
+func highlightsClippings(export *HighlightsExport) []byte {
+	var buf bytes.Buffer
+
+	title := export.Title
+	if export.Author != "" {
+		title += " (" + export.Author + ")"
+	}
+
+	entry := func(kind, location, text string, created types.DateTime) {
+		added := created.Time().UTC().Format("Monday, January 2, 2006 3:04:05 PM")
+		fmt.Fprintf(&buf, "%s\r\n- Your %s on Location %s | Added on %s\r\n\r\n%s\r\n==========\r\n", title, kind, location, added, text)
+	}
+
+	for _, chapter := range export.Chapters {
+		for _, highlight := range chapter.Highlights {
+			location := strconv.Itoa(highlight.Location)
+			if highlight.EndLocation != highlight.Location {
+				location += "-" + strconv.Itoa(highlight.EndLocation)
+			}
+			entry("Highlight", location, strings.Join(strings.Fields(highlight.Text), " "), highlight.Created)
+
+			if note := strings.Join(strings.Fields(highlight.Note), " "); note != "" {
+				entry("Note", strconv.Itoa(highlight.EndLocation), note, highlight.Created)
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// location returns the location of the UTF-16 offset in the text of the book,
+// counting from 1.
+func location(offset int) int {
+	return offset/highlight_hooks.CharactersPerLocation + 1
+}
+
+func locationLabel(highlight ExportedHighlight) string {
+	if highlight.EndLocation != highlight.Location {
+		return fmt.Sprintf("Location %d-%d", highlight.Location, highlight.EndLocation)
+	}
+	return fmt.Sprintf("Location %d", highlight.Location)
+}
+
+func chapterTitle(chapter ChapterHighlights) string {
+	if title := strings.TrimSpace(chapter.Title); title != "" {
+		return title
+	}
+	return fmt.Sprintf("Chapter %d", chapter.Order)
+}
+
+// tagSlug replaces the characters tags can't have in Obsidian and Readwise
+// with dashes.
+func tagSlug(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '/' {
+			return r
+		}
+		return '-'
+	}, name)
+}
@@ -0,0 +1,427 @@
+package book_export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/highlight_hooks"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/progress"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	ManifestFormat  = "ai-reader-export"
+	ManifestVersion = 1
+)
+
+// Manifest is written to manifest.json at the root of an export. File paths
+// are relative to the root of the zip.
+type Manifest struct {
+	Format   string         `json:"format"`
+	Version  int            `json:"version"`
+	Exported types.DateTime `json:"exported"`
+	User     string         `json:"user"`
+	Books    []Book         `json:"books"`
+}
+
+type Book struct {
+	Id             string             `json:"id"`
+	Title          string             `json:"title"`
+	Author         string             `json:"author"`
+	Description    string             `json:"description"`
+	Language       string             `json:"language"`
+	Date           string             `json:"date"`
+	Subject        string             `json:"subject"`
+	Publisher      string             `json:"publisher"`
+	Rights         string             `json:"rights"`
+	ISBN           string             `json:"isbn"`
+	Identifiers    json.RawMessage    `json:"identifiers"`
+	Series         string             `json:"series"`
+	SeriesIndex    float64            `json:"seriesIndex"`
+	Contributors   json.RawMessage    `json:"contributors"`
+	Created        types.DateTime     `json:"created"`
+	File           string             `json:"file"`
+	CoverImage     string             `json:"coverImage,omitempty"`
+	CurrentChapter string             `json:"currentChapter"`
+	Position       *progress.Position `json:"position"`
+	LastRead       bool               `json:"lastRead"`
+	Chapters       []Chapter          `json:"chapters"`
+	Assets         []Asset            `json:"assets"`
+	Highlights     []Highlight        `json:"highlights"`
+	Bookmarks      []Bookmark         `json:"bookmarks"`
+	Sessions       []progress.Session `json:"sessions"`
+	Chats          []Chat             `json:"chats"`
+}
+
+type Chapter struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+	Order int    `json:"order"`
+	Href  string `json:"href"`
+	File  string `json:"file"`
+}
+
+// Asset is an image extracted from the book. Href is the path it is
+// referenced by in the original file.
+type Asset struct {
+	Href string `json:"href"`
+	File string `json:"file"`
+}
+
+// Highlight keeps the anchor, editor selection and hash as stored, so
+// highlights can be restored exactly on an identical copy of the chapter. Tags
+// are exported by name, as they belong to the user rather than the book.
+type Highlight struct {
+	Id        string          `json:"id"`
+	Chapter   string          `json:"chapter"`
+	Text      string          `json:"text"`
+	Selection json.RawMessage `json:"selection"`
+	Hash      string          `json:"hash"`
+	Color     string          `json:"color"`
+	Note      string          `json:"note"`
+	Tags      []string        `json:"tags"`
+	Created   types.DateTime  `json:"created"`
+	highlight_hooks.Anchor
+}
+
+// Bookmark points at the same kind of location as a reading position.
+// Modified is when it was last changed on a device, in milliseconds since the
+// epoch.
+type Bookmark struct {
+	Id         string         `json:"id"`
+	Chapter    string         `json:"chapter"`
+	Path       string         `json:"path"`
+	NodeIndex  int            `json:"nodeIndex"`
+	Offset     int            `json:"offset"`
+	Percentage float64        `json:"percentage"`
+	Label      string         `json:"label"`
+	Modified   int64          `json:"modified"`
+	Created    types.DateTime `json:"created"`
+}
+
+type Chat struct {
+	Id       string         `json:"id"`
+	Title    string         `json:"title"`
+	Created  types.DateTime `json:"created"`
+	Messages []Message      `json:"messages"`
+}
+
+type Message struct {
+	Id        string          `json:"id"`
+	Role      string          `json:"role"`
+	Content   string          `json:"content"`
+	Citations json.RawMessage `json:"citations"`
+	Failed    bool            `json:"failed"`
+	Created   types.DateTime  `json:"created"`
+}
+
+func Init(app *pocketbase.PocketBase) error {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.GET("/api/books/{id}/export", func(e *core.RequestEvent) error {
+			book, err := e.App.FindRecordById("books", e.Request.PathValue("id"))
+			if err != nil || book.GetString("user") != e.Auth.Id {
+				return e.NotFoundError("Book not found.", err)
+			}
+
+			return writeExport(e, []*core.Record{book}, titleSlug(book.GetString("title")))
+		}).Bind(apis.RequireAuth())
+
+		se.Router.GET("/api/export", func(e *core.RequestEvent) error {
+			books, err := e.App.FindRecordsByFilter("books", "user = {:user}", "created", 0, 0, dbx.Params{"user": e.Auth.Id})
+			if err != nil {
+				return e.InternalServerError("failed to get books", err)
+			}
+
+			return writeExport(e, books, "library")
+		}).Bind(apis.RequireAuth())
+
+		se.Router.GET("/api/books/{id}/highlights/export", exportHighlights).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+
+	return nil
+}
+
+// writeExport streams a zip with the books and the manifest describing them.
+func writeExport(e *core.RequestEvent, books []*core.Record, name string) error {
+	fsys, err := e.App.NewFilesystem()
+	if err != nil {
+		return e.InternalServerError("failed to open storage", err)
+	}
+	defer fsys.Close()
+
+	filename := fmt.Sprintf("%s-%s.zip", name, time.Now().UTC().Format("2006-01-02"))
+	e.Response.Header().Set("Content-Type", "application/zip")
+	e.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	e.Response.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(e.Response)
+	defer zw.Close()
+
+	manifest := Manifest{
+		Format:   ManifestFormat,
+		Version:  ManifestVersion,
+		Exported: types.NowDateTime(),
+		User:     e.Auth.Id,
+		Books:    make([]Book, 0, len(books)),
+	}
+
+	lastOpened := progress.LastOpenedBook(e.App, e.Auth.Id)
+
+	for _, book := range books {
+		exported, err := exportBook(e.App, fsys, zw, book)
+		if err != nil {
+			// the status has already been sent, so the broken zip is all the client gets
+			e.App.Logger().Error("failed to export book", "book", book.Id, "error", err)
+			return err
+		}
+		exported.CurrentChapter = progress.ResumePosition(e.App, e.Auth.Id, book).Chapter
+		exported.Position = savedPosition(e.App, e.Auth.Id, book.Id)
+		exported.LastRead = lastOpened == book.Id
+
+		manifest.Books = append(manifest.Books, *exported)
+	}
+
+	w, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
+
+func exportBook(app core.App, fsys *filesystem.System, zw *zip.Writer, book *core.Record) (*Book, error) {
+	dir := "books/" + book.Id + "/"
+
+	exported := &Book{
+		Id:           book.Id,
+		Title:        book.GetString("title"),
+		Author:       book.GetString("author"),
+		Description:  book.GetString("description"),
+		Language:     book.GetString("language"),
+		Date:         book.GetString("date"),
+		Subject:      book.GetString("subject"),
+		Publisher:    book.GetString("publisher"),
+		Rights:       book.GetString("rights"),
+		ISBN:         book.GetString("isbn"),
+		Identifiers:  rawJSON(book.Get("identifiers")),
+		Series:       book.GetString("series"),
+		SeriesIndex:  book.GetFloat("series_index"),
+		Contributors: rawJSON(book.Get("contributors")),
+		Created:      book.GetDateTime("created"),
+		Chapters:     []Chapter{},
+		Assets:       []Asset{},
+		Highlights:   []Highlight{},
+		Bookmarks:    []Bookmark{},
+		Sessions:     []progress.Session{},
+		Chats:        []Chat{},
+	}
+
+	exported.File = dir + "original/" + book.GetString("file")
+	if err := copyFile(fsys, zw, book.BaseFilesPath()+"/"+book.GetString("file"), exported.File); err != nil {
+		return nil, err
+	}
+
+	if cover := book.GetString("cover_image"); cover != "" {
+		exported.CoverImage = dir + "cover/" + cover
+		if err := copyFile(fsys, zw, book.BaseFilesPath()+"/"+cover, exported.CoverImage); err != nil {
+			return nil, err
+		}
+	}
+
+	chapters, err := app.FindRecordsByFilter("chapters", "book = {:book}", "order", 0, 0, dbx.Params{"book": book.Id})
+	if err != nil {
+		return nil, err
+	}
+	for i, chapter := range chapters {
+		file := fmt.Sprintf("%schapters/%03d.html", dir, i+1)
+		w, err := zw.Create(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(w, chapter.GetString("content")); err != nil {
+			return nil, err
+		}
+
+		exported.Chapters = append(exported.Chapters, Chapter{
+			Id:    chapter.Id,
+			Title: chapter.GetString("title"),
+			Order: chapter.GetInt("order"),
+			Href:  chapter.GetString("href"),
+			File:  file,
+		})
+	}
+
+	assets, err := app.FindAllRecords("book_assets", dbx.HashExp{"book": book.Id})
+	if err != nil {
+		return nil, err
+	}
+	for _, asset := range assets {
+		file := dir + "assets/" + asset.Id + path.Ext(asset.GetString("file"))
+		if err := copyFile(fsys, zw, asset.BaseFilesPath()+"/"+asset.GetString("file"), file); err != nil {
+			return nil, err
+		}
+
+		exported.Assets = append(exported.Assets, Asset{
+			Href: asset.GetString("href"),
+			File: file,
+		})
+	}
+
+	highlights, err := app.FindRecordsByFilter("highlights", "book = {:book}", "created", 0, 0, dbx.Params{"book": book.Id})
+	if err != nil {
+		return nil, err
+	}
+	for _, highlight := range highlights {
+		tags, err := app.FindRecordsByIds("tags", highlight.GetStringSlice("tags"))
+		if err != nil {
+			return nil, err
+		}
+		tagNames := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			tagNames = append(tagNames, tag.GetString("name"))
+		}
+
+		exported.Highlights = append(exported.Highlights, Highlight{
+			Id:        highlight.Id,
+			Chapter:   highlight.GetString("chapter"),
+			Text:      highlight.GetString("text"),
+			Selection: rawJSON(highlight.Get("selection")),
+			Hash:      highlight.GetString("hash"),
+			Color:     highlight.GetString("color"),
+			Note:      highlight.GetString("note"),
+			Tags:      tagNames,
+			Created:   highlight.GetDateTime("created"),
+			Anchor:    highlight_hooks.AnchorFromRecord(highlight),
+		})
+	}
+
+	bookmarks, err := app.FindRecordsByFilter("bookmarks", "book = {:book}", "created", 0, 0, dbx.Params{"book": book.Id})
+	if err != nil {
+		return nil, err
+	}
+	for _, bookmark := range bookmarks {
+		exported.Bookmarks = append(exported.Bookmarks, Bookmark{
+			Id:         bookmark.Id,
+			Chapter:    bookmark.GetString("chapter"),
+			Path:       bookmark.GetString("path"),
+			NodeIndex:  bookmark.GetInt("node_index"),
+			Offset:     bookmark.GetInt("offset"),
+			Percentage: bookmark.GetFloat("percentage"),
+			Label:      bookmark.GetString("label"),
+			Modified:   int64(bookmark.GetInt("modified")),
+			Created:    bookmark.GetDateTime("created"),
+		})
+	}
+
+	sessions, err := app.FindRecordsByFilter("reading_sessions", "book = {:book}", "started", 0, 0, dbx.Params{"book": book.Id})
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		exported.Sessions = append(exported.Sessions, progress.SessionFromRecord(session))
+	}
+
+	chats, err := app.FindRecordsByFilter("chats", "book = {:book}", "created", 0, 0, dbx.Params{"book": book.Id})
+	if err != nil {
+		return nil, err
+	}
+	for _, chat := range chats {
+		exportedChat := Chat{
+			Id:       chat.Id,
+			Title:    chat.GetString("title"),
+			Created:  chat.GetDateTime("created"),
+			Messages: []Message{},
+		}
+
+		messages, err := app.FindRecordsByFilter("messages", "chat = {:chat}", "created", 0, 0, dbx.Params{"chat": chat.Id})
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			exportedChat.Messages = append(exportedChat.Messages, Message{
+				Id:        message.Id,
+				Role:      message.GetString("role"),
+				Content:   message.GetString("content"),
+				Citations: rawJSON(message.Get("citations")),
+				Failed:    message.GetBool("failed"),
+				Created:   message.GetDateTime("created"),
+			})
+		}
+
+		exported.Chats = append(exported.Chats, exportedChat)
+	}
+
+	return exported, nil
+}
+
+// savedPosition returns the reading position saved for the book, or nil if the
+// user hasn't read it yet.
+func savedPosition(app core.App, userId, bookId string) *progress.Position {
+	record, err := app.FindFirstRecordByFilter(
+		"reading_positions",
+		"user = {:user} && book = {:book} && chapter != ''",
+		dbx.Params{"user": userId, "book": bookId},
+	)
+	if err != nil {
+		return nil
+	}
+	return progress.PositionFromRecord(record)
+}
+
+func copyFile(fsys *filesystem.System, zw *zip.Writer, key, name string) error {
+	r, err := fsys.GetReader(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func rawJSON(value any) json.RawMessage {
+	if raw, ok := value.(types.JSONRaw); ok && len(raw) > 0 {
+		return json.RawMessage(raw)
+	}
+	return json.RawMessage("null")
+}
+
+func titleSlug(title string) string {
+	slug := make([]rune, 0, len(title))
+	for _, r := range title {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			slug = append(slug, r)
+		case r >= 'A' && r <= 'Z':
+			slug = append(slug, r+'a'-'A')
+		case len(slug) > 0 && slug[len(slug)-1] != '-':
+			slug = append(slug, '-')
+		}
+	}
+	for len(slug) > 0 && slug[len(slug)-1] == '-' {
+		slug = slug[:len(slug)-1]
+	}
+	if len(slug) == 0 {
+		return "book"
+	}
+	return string(slug)
+}
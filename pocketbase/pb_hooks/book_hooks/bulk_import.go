@@ -0,0 +1,236 @@
+package book_hooks
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/book_export"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/quota"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const maxBulkImportSize = 2 << 30
+
+// maxManifestSize caps the manifest.json read from an export bundle.
+const maxManifestSize = 10 << 20
+
+const (
+	BulkImported  = "imported"
+	BulkDuplicate = "duplicate"
+	BulkFailed    = "failed"
+)
+
+type BulkImportResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Book   string `json:"book,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BulkImportReport struct {
+	Imported  int                `json:"imported"`
+	Duplicate int                `json:"duplicate"`
+	Failed    int                `json:"failed"`
+	Results   []BulkImportResult `json:"results"`
+}
+
+var bookExtensions = map[string]bool{
+	".epub":     true,
+	".pdf":      true,
+	".txt":      true,
+	".md":       true,
+	".markdown": true,
+	".html":     true,
+	".htm":      true,
+	".xhtml":    true,
+}
+
+func initBulkImport(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.POST("/api/books/import", func(e *core.RequestEvent) error {
+			file, header, err := e.Request.FormFile("file")
+			if err != nil {
+				return e.BadRequestError("A zip file is required.", err)
+			}
+			defer file.Close()
+
+			archive, err := zip.NewReader(file, header.Size)
+			if err != nil {
+				return e.BadRequestError("The uploaded file is not a valid zip archive.", err)
+			}
+
+			report, err := bulkImportBooks(e.App, e.Auth, archive)
+			if err != nil {
+				return e.InternalServerError("failed to import books", err)
+			}
+
+			return e.JSON(http.StatusOK, report)
+		}).Bind(apis.RequireAuth(), apis.BodyLimit(maxBulkImportSize))
+
+		return se.Next()
+	})
+}
+
+// bulkImportBooks creates a book for every supported file in the archive, or
+// for the original files listed in the manifest of an export bundle. Each
+// book goes through the same checks as a single upload and is then ingested
+// by the ingest workers.
+func bulkImportBooks(app core.App, user *core.Record, archive *zip.Reader) (*BulkImportReport, error) {
+	booksCollection, err := app.FindCollectionByNameOrId("books")
+	if err != nil {
+		return nil, err
+	}
+
+	// entries are read into memory, so they are always capped, falling back
+	// to the size the file field allows when it has no MaxSize of its own
+	maxSize := core.DefaultFileFieldMaxSize
+	if field, ok := booksCollection.Fields.GetByName("file").(*core.FileField); ok && field.MaxSize > 0 {
+		maxSize = field.MaxSize
+	}
+
+	entries, err := bulkImportEntries(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BulkImportReport{Results: []BulkImportResult{}}
+	for _, entry := range entries {
+		result := BulkImportResult{Name: entry.Name}
+
+		book, err := bulkImportEntry(app, user, entry, maxSize)
+
+		var duplicate *DuplicateBookError
+		switch {
+		case err == nil:
+			result.Status = BulkImported
+			result.Book = book.Id
+			report.Imported++
+		case errors.As(err, &duplicate):
+			result.Status = BulkDuplicate
+			result.Book = duplicate.Book.Id
+			report.Duplicate++
+		default:
+			result.Status = BulkFailed
+			result.Error = err.Error()
+			report.Failed++
+		}
+
+		report.Results = append(report.Results, result)
+	}
+
+	return report, nil
+}
+
+func bulkImportEntry(app core.App, user *core.Record, entry *zip.File, maxSize int64) (*core.Record, error) {
+	if !IsBookFile(entry.Name) {
+		return nil, errors.New("unsupported file type")
+	}
+
+	if entry.UncompressedSize64 > uint64(maxSize) {
+		return nil, errFileTooLarge
+	}
+
+	data, err := readZipFile(entry, maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := filesystem.NewFileFromBytes(data, path.Base(entry.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	book, err := CreateBook(app, user, file)
+	if err != nil {
+		var exceeded *quota.ExceededError
+		if errors.As(err, &exceeded) {
+			return nil, errors.New(exceeded.Message)
+		}
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// IsBookFile reports whether the file name has the extension of a format books
+// can be imported from.
+func IsBookFile(name string) bool {
+	return bookExtensions[strings.ToLower(path.Ext(name))]
+}
+
+// bulkImportEntries returns the files of the archive to import, skipping
+// directories and hidden files such as the __MACOSX folder.
+func bulkImportEntries(archive *zip.Reader) ([]*zip.File, error) {
+	files := make(map[string]*zip.File, len(archive.File))
+	var entries []*zip.File
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || isHiddenPath(f.Name) {
+			continue
+		}
+		files[f.Name] = f
+		entries = append(entries, f)
+	}
+
+	manifestFile, ok := files["manifest.json"]
+	if !ok {
+		return entries, nil
+	}
+
+	data, err := readZipFile(manifestFile, maxManifestSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest book_export.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.Format != book_export.ManifestFormat {
+		return entries, nil
+	}
+
+	entries = nil
+	for _, book := range manifest.Books {
+		if f, ok := files[book.File]; ok {
+			entries = append(entries, f)
+		}
+	}
+
+	return entries, nil
+}
+
+var errFileTooLarge = errors.New("file is too large")
+
+// readZipFile reads the archive entry, failing with errFileTooLarge once more
+// than limit bytes are read. The size in the entry header is not trusted.
+func readZipFile(f *zip.File, limit int64) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errFileTooLarge
+	}
+
+	return data, nil
+}
+
+func isHiddenPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,372 @@
+package book_hooks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/book_parsers"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/chapter_hooks"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/quota"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	ingestWorkers      = 2
+	ingestMaxAttempts  = 3
+	ingestRetryBackoff = 30 * time.Second
+)
+
+const (
+	IngestKindImport   = "import"
+	IngestKindReimport = "reimport"
+)
+
+const (
+	IngestQueued    = "queued"
+	IngestParsing   = "parsing"
+	IngestChunking  = "chunking"
+	IngestEmbedding = "embedding"
+	IngestReady     = "ready"
+	IngestFailed    = "failed"
+)
+
+var (
+	ingestQueue = make(chan string, 256)
+
+	// jobs that are queued or being processed, so a job is never picked up twice
+	ingestMu       sync.Mutex
+	ingestInFlight = make(map[string]bool)
+)
+
+func initIngest(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		for range ingestWorkers {
+			go func() {
+				for jobId := range ingestQueue {
+					processIngestJob(app, jobId)
+				}
+			}()
+		}
+
+		// resume jobs that were interrupted by a restart
+		jobs, err := app.FindRecordsByFilter(
+			"ingest_jobs",
+			"status = {:queued} || status = {:parsing} || status = {:chunking}",
+			"created",
+			0,
+			0,
+			dbx.Params{"queued": IngestQueued, "parsing": IngestParsing, "chunking": IngestChunking},
+		)
+		if err != nil {
+			app.Logger().Error("failed to find unfinished ingest jobs", "error", err)
+		}
+		for _, job := range jobs {
+			enqueueIngestJob(job.Id)
+		}
+
+		se.Router.GET("/api/books/{id}/ingest", func(e *core.RequestEvent) error {
+			job, err := findBookIngestJob(e)
+			if err != nil {
+				return err
+			}
+
+			return e.JSON(http.StatusOK, job)
+		}).Bind(apis.RequireAuth())
+
+		se.Router.POST("/api/books/{id}/ingest/retry", func(e *core.RequestEvent) error {
+			job, err := findBookIngestJob(e)
+			if err != nil {
+				return err
+			}
+
+			if job.GetString("status") != IngestFailed {
+				return e.BadRequestError("Only failed imports can be retried.", nil)
+			}
+
+			// the failed book was left out of the quota, so it has to fit again
+			book, err := e.App.FindRecordById("books", job.GetString("book"))
+			if err != nil {
+				return e.NotFoundError("Book not found.", err)
+			}
+			if book.GetString("import_error") != "" {
+				if err := quota.CheckBookUpload(e.App, e.Auth, int64(book.GetInt("size"))); err != nil {
+					var exceeded *quota.ExceededError
+					if errors.As(err, &exceeded) {
+						return e.ForbiddenError(exceeded.Message, nil)
+					}
+					return e.InternalServerError("failed to check quota", err)
+				}
+			}
+
+			job.Set("status", IngestQueued)
+			job.Set("attempts", 0)
+			job.Set("error", "")
+			if err := e.App.Save(job); err != nil {
+				return e.InternalServerError("failed to update ingest job", err)
+			}
+
+			recordImportError(e.App, book.Id, nil)
+
+			enqueueIngestJob(job.Id)
+
+			return e.JSON(http.StatusOK, job)
+		}).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+
+	// embeddings are generated asynchronously by vector_search, so progress is
+	// polled until every vector of the book has one
+	app.Cron().MustAdd("updateIngestEmbeddingProgress", "* * * * *", func() {
+		jobs, err := app.FindRecordsByFilter("ingest_jobs", "status = {:status}", "", 0, 0, dbx.Params{"status": IngestEmbedding})
+		if err != nil {
+			app.Logger().Error("failed to find embedding ingest jobs", "error", err)
+			return
+		}
+
+		for _, job := range jobs {
+			done, err := app.CountRecords("vectors",
+				dbx.HashExp{"book": job.GetString("book")},
+				dbx.NewExp("vector_id != 0"),
+			)
+			if err != nil {
+				app.Logger().Error("failed to count embedded vectors", "job", job.Id, "error", err)
+				continue
+			}
+
+			job.Set("vectors_done", done)
+			if int(done) >= job.GetInt("vectors_total") {
+				job.Set("status", IngestReady)
+			}
+
+			if err := app.Save(job); err != nil {
+				app.Logger().Error("failed to update ingest job", "job", job.Id, "error", err)
+			}
+		}
+	})
+}
+
+// createIngestJob queues the import of a newly uploaded book.
+func createIngestJob(app core.App, book *core.Record) error {
+	_, err := queueIngestJob(app, book, IngestKindImport)
+	return err
+}
+
+// queueIngestJob creates a job of the given kind for the book and queues it.
+func queueIngestJob(app core.App, book *core.Record, kind string) (*core.Record, error) {
+	jobsCollection, err := app.FindCollectionByNameOrId("ingest_jobs")
+	if err != nil {
+		return nil, err
+	}
+
+	job := core.NewRecord(jobsCollection)
+	job.Set("book", book.Id)
+	job.Set("user", book.GetString("user"))
+	job.Set("kind", kind)
+	job.Set("status", IngestQueued)
+
+	if err := app.Save(job); err != nil {
+		return nil, err
+	}
+
+	enqueueIngestJob(job.Id)
+
+	return job, nil
+}
+
+func enqueueIngestJob(jobId string) {
+	ingestMu.Lock()
+	defer ingestMu.Unlock()
+
+	if ingestInFlight[jobId] {
+		return
+	}
+	ingestInFlight[jobId] = true
+
+	// sending from a goroutine keeps request handlers from blocking on a full queue
+	go func() {
+		ingestQueue <- jobId
+	}()
+}
+
+func processIngestJob(app core.App, jobId string) {
+	defer func() {
+		ingestMu.Lock()
+		delete(ingestInFlight, jobId)
+		ingestMu.Unlock()
+	}()
+
+	job, err := app.FindRecordById("ingest_jobs", jobId)
+	if err != nil {
+		// the book, and with it the job, was deleted while queued
+		return
+	}
+
+	job.Set("attempts", job.GetInt("attempts")+1)
+
+	err = runIngestJob(app, job)
+	if err == nil {
+		return
+	}
+
+	app.Logger().Error("book import failed", "job", job.Id, "book", job.GetString("book"), "error", err)
+
+	job.Set("error", err.Error())
+
+	retry := job.GetInt("attempts") < ingestMaxAttempts &&
+		!errors.Is(err, book_parsers.ErrUnsupportedFormat) &&
+		!errors.Is(err, book_parsers.ErrNoChapters)
+	if !retry {
+		job.Set("status", IngestFailed)
+		// a book that fails to reimport still has the chapters it had
+		if job.GetString("kind") != IngestKindReimport {
+			recordImportError(app, job.GetString("book"), err)
+		}
+	}
+
+	if err := app.Save(job); err != nil {
+		app.Logger().Error("failed to update ingest job", "job", job.Id, "error", err)
+		return
+	}
+
+	if retry {
+		// the job keeps its status so that the retry resumes at the failed step
+		time.AfterFunc(ingestRetryBackoff*time.Duration(job.GetInt("attempts")), func() {
+			enqueueIngestJob(job.Id)
+		})
+	}
+}
+
+func runIngestJob(app core.App, job *core.Record) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic during import: %v", r)
+		}
+	}()
+
+	book, err := app.FindRecordById("books", job.GetString("book"))
+	if err != nil {
+		return err
+	}
+
+	if job.GetString("kind") == IngestKindReimport {
+		return runReimportJob(app, job, book)
+	}
+
+	switch job.GetString("status") {
+	case IngestQueued, IngestParsing:
+		job.Set("status", IngestParsing)
+		job.Set("chapters_done", 0)
+		job.Set("vectors_total", 0)
+		job.Set("vectors_done", 0)
+		if err := app.Save(job); err != nil {
+			return err
+		}
+
+		if err := importBook(app, book); err != nil {
+			return err
+		}
+
+		job.Set("status", IngestChunking)
+		job.Set("chapters_total", len(book.GetStringSlice("chapters")))
+		if err := app.Save(job); err != nil {
+			return err
+		}
+		fallthrough
+	case IngestChunking:
+		if err := chunkBookChapters(app, job, book); err != nil {
+			return err
+		}
+
+		job.Set("status", IngestEmbedding)
+		job.Set("error", "")
+		return app.Save(job)
+	}
+
+	return nil
+}
+
+// chunkBookChapters creates the vectors of every chapter from chapters_done
+// onwards. Each chapter is chunked in its own transaction, and vectors left
+// over from an interrupted run are deleted first.
+func chunkBookChapters(app core.App, job *core.Record, book *core.Record) error {
+	chapters, err := app.FindRecordsByFilter("chapters", "book = {:book}", "order", 0, 0, dbx.Params{"book": book.Id})
+	if err != nil {
+		return err
+	}
+
+	for i := job.GetInt("chapters_done"); i < len(chapters); i++ {
+		chapter := chapters[i]
+
+		err := app.RunInTransaction(func(txApp core.App) error {
+			stale, err := txApp.FindAllRecords("vectors", dbx.HashExp{"chapter": chapter.Id})
+			if err != nil {
+				return err
+			}
+			for _, vector := range stale {
+				if err := txApp.Delete(vector); err != nil {
+					return err
+				}
+			}
+
+			_, err = chapter_hooks.CreateChapterVectors(txApp, chapter)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to chunk chapter %q: %w", chapter.GetString("title"), err)
+		}
+
+		total, err := app.CountRecords("vectors", dbx.HashExp{"book": book.Id})
+		if err != nil {
+			return err
+		}
+
+		job.Set("chapters_done", i+1)
+		job.Set("vectors_total", total)
+		if err := app.Save(job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordImportError stores the reason an import failed for good on the book,
+// so that it is visible without looking up the ingest job, or clears it when
+// importErr is nil. Books with an import error are left out of the duplicate
+// check and the quota.
+func recordImportError(app core.App, bookId string, importErr error) {
+	book, err := app.FindRecordById("books", bookId)
+	if err != nil {
+		return
+	}
+
+	if importErr != nil {
+		book.Set("import_error", importErr.Error())
+	} else {
+		book.Set("import_error", "")
+	}
+	if err := app.Save(book); err != nil {
+		app.Logger().Error("failed to record import error", "book", bookId, "error", err)
+	}
+}
+
+func findBookIngestJob(e *core.RequestEvent) (*core.Record, error) {
+	book, err := e.App.FindRecordById("books", e.Request.PathValue("id"))
+	if err != nil || book.GetString("user") != e.Auth.Id {
+		return nil, e.NotFoundError("Book not found.", err)
+	}
+
+	jobs, err := e.App.FindRecordsByFilter("ingest_jobs", "book = {:book}", "-created", 1, 0, dbx.Params{"book": book.Id})
+	if err != nil || len(jobs) == 0 {
+		return nil, e.NotFoundError("No import found for this book.", err)
+	}
+
+	return jobs[0], nil
+}
@@ -1,12 +1,23 @@
 package book_hooks
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
-	"regexp"
-
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/book_parsers"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/chapter_hooks"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/progress"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/quota"
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
-	"github.com/timsims/pamphlet"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
 )
 
 func Init(app *pocketbase.PocketBase) error {
@@ -15,18 +26,21 @@ func Init(app *pocketbase.PocketBase) error {
 			return e.ForbiddenError("You must be logged in to upload a book.", nil)
 		}
 
-		user := e.Auth
-		if !user.GetBool("paid") {
-			uploadCountRecord, err := e.App.FindRecordById("upload_count", user.Id)
-			if err != nil {
-				return e.Next()
-			}
-
-			if uploadCountRecord != nil {
-				uploadCount := uploadCountRecord.GetInt("uploadCount")
-				if uploadCount >= 5 {
-					return e.ForbiddenError("Upload limit reached. Please upgrade to continue uploading files.", nil)
-				}
+		if err := prepareBookUpload(e.App, e.Auth, e.Record); err != nil {
+			var duplicate *DuplicateBookError
+			var exceeded *quota.ExceededError
+			switch {
+			case errors.As(err, &duplicate):
+				return e.JSON(http.StatusConflict, map[string]any{
+					"status":  http.StatusConflict,
+					"message": duplicate.Error(),
+					"data":    map[string]any{},
+					"book":    duplicate.Book.Id,
+				})
+			case errors.As(err, &exceeded):
+				return e.ForbiddenError(exceeded.Message, nil)
+			default:
+				return e.BadRequestError("failed to process uploaded file", err)
 			}
 		}
 
@@ -34,210 +48,358 @@ func Init(app *pocketbase.PocketBase) error {
 	})
 
 	app.OnRecordAfterCreateSuccess("books").BindFunc(func(e *core.RecordEvent) error {
-		lastReadCollection, err := app.FindCollectionByNameOrId("last_read")
+		chatsCollection, err := app.FindCollectionByNameOrId("chats")
 		if err != nil {
 			return err
 		}
 
-		chatsCollection, err := app.FindCollectionByNameOrId("chats")
-		if err != nil {
+		book := e.Record
+
+		chatRecord := core.NewRecord(chatsCollection)
+		setChatFields(chatRecord, book.GetString("user"), book.Id, "New Chat")
+		if err := e.App.Save(chatRecord); err != nil {
 			return err
 		}
 
-		chaptersCollection, err := app.FindCollectionByNameOrId("chapters")
-		if err != nil {
+		// parsing and chunking run in the ingest workers so the upload returns right away
+		if err := createIngestJob(e.App, book); err != nil {
 			return err
 		}
 
-		book := e.Record
-		user := book.GetString("user")
-
-		lastRead, _ := e.App.FindFirstRecordByData("last_read", "user", user)
-		setLastRead := false
-		if lastRead == nil {
-			setLastRead = true
-			lastRead = core.NewRecord(lastReadCollection)
-			setLastReadFields(lastRead, user, book.Id)
+		return e.Next()
+	})
+
+	app.OnRecordViewRequest("books").BindFunc(func(e *core.RecordRequestEvent) error {
+		if e.HasSuperuserAuth() || e.Auth == nil {
+			return e.Next()
 		}
 
-		chatRecord := core.NewRecord(chatsCollection)
-		setChatFields(chatRecord, user, book.Id, "New Chat")
+		if err := progress.OpenBook(e.App, e.Auth.Id, e.Record, ""); err != nil {
+			e.App.Logger().Error("failed to save reading position", "book", e.Record.Id, "error", err)
+		}
 
-		fileKey := book.BaseFilesPath() + "/" + book.GetString("file")
+		return e.Next()
+	})
 
-		fsys, err := e.App.NewFilesystem()
-		if err != nil {
-			return err
-		}
-		defer fsys.Close()
+	initIngest(app)
+	initReimport(app)
+	initBulkImport(app)
 
-		r, err := fsys.GetReader(fileKey)
-		if err != nil {
-			return err
-		}
-		defer r.Close()
+	return nil
+}
 
-		data, err := io.ReadAll(r)
+// DuplicateBookError is returned when the user uploads a file they already have
+// a book for.
+type DuplicateBookError struct {
+	Book *core.Record
+}
+
+func (e *DuplicateBookError) Error() string {
+	return "You have already uploaded this book."
+}
+
+// prepareBookUpload sets the size and content hash of a book that is about to
+// be created and checks it against the user's existing books and quota.
+//
+// The same file uploaded twice would be parsed and embedded again, so a
+// duplicate is rejected with a *DuplicateBookError pointing at the existing book.
+// Books whose import failed don't count, so the file can be uploaded again.
+func prepareBookUpload(app core.App, user *core.Record, book *core.Record) error {
+	var size int64
+	var contentHash string
+	for _, file := range book.GetUnsavedFiles("file") {
+		hash, err := fileHash(file)
 		if err != nil {
 			return err
 		}
 
-		parser, err := pamphlet.OpenBytes(data)
-		if err != nil {
-			return err
+		size += file.Size
+		contentHash = hash
+	}
+	book.Set("size", size)
+	book.Set("content_hash", contentHash)
+
+	if contentHash != "" {
+		existing, _ := app.FindFirstRecordByFilter(
+			"books",
+			"user = {:user} && content_hash = {:hash} && import_error = ''",
+			dbx.Params{"user": user.Id, "hash": contentHash},
+		)
+		if existing != nil {
+			return &DuplicateBookError{Book: existing}
 		}
-		defer parser.Close()
+	}
 
-		parsedBook := parser.GetBook()
+	return quota.CheckBookUpload(app, user, size)
+}
 
-		var chapters []*core.Record
-		re := regexp.MustCompile(`(?s)^.*@page\s*\{[^}]*\}\s*`)
+// CreateBook creates a book for the user from a file that didn't come through
+// the books API, such as an entry of a zip archive or a download from an OPDS
+// catalog. It makes the same checks as an upload, so it can return a
+// *DuplicateBookError or a *quota.ExceededError, and the book is ingested by
+// the ingest workers like any other.
+func CreateBook(app core.App, user *core.Record, file *filesystem.File) (*core.Record, error) {
+	if !IsBookFile(file.OriginalName) {
+		return nil, errors.New("unsupported file type")
+	}
 
-		for _, chapter := range parsedBook.Chapters {
-			if chapter.Title == "" {
-				continue
-			}
+	booksCollection, err := app.FindCollectionByNameOrId("books")
+	if err != nil {
+		return nil, err
+	}
 
-			content, err := chapter.GetContent()
-			if err != nil {
-				continue
-			}
+	book := core.NewRecord(booksCollection)
+	book.Set("user", user.Id)
+	book.Set("file", file)
 
-			content = re.ReplaceAllString(content, "")
-			html := "<!DOCTYPE html>" + content
+	if err := prepareBookUpload(app, user, book); err != nil {
+		return nil, err
+	}
 
-			chapterRecord := core.NewRecord(chaptersCollection)
-			setChapterFields(chapterRecord, &chapter, html, book.Id, user)
+	if err := app.Save(book); err != nil {
+		return nil, err
+	}
 
-			chapters = append(chapters, chapterRecord)
-		}
+	return book, nil
+}
 
-		if setLastRead {
-			if err := e.App.Save(lastRead); err != nil {
-				return err
-			}
-		}
+// importBook parses the book's file and creates its chapters and assets in a
+// single transaction, so a failed import leaves no chapters, assets or asset
+// files behind. Anything left over from a previous import is removed first.
+func importBook(app core.App, book *core.Record) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		return importBookTx(txApp, book)
+	})
+}
 
-		if err := e.App.Save(chatRecord); err != nil {
-			return err
-		}
+func importBookTx(app core.App, book *core.Record) error {
+	if err := clearBookImport(app, book); err != nil {
+		return err
+	}
 
-		var chapterIds []string
-		for _, record := range chapters {
-			if err := e.App.Save(record); err != nil {
-				return err
-			}
-			chapterIds = append(chapterIds, record.Id)
-		}
+	chaptersCollection, err := app.FindCollectionByNameOrId("chapters")
+	if err != nil {
+		return err
+	}
+
+	user := book.GetString("user")
 
-		setBookFields(book, parsedBook, chapterIds)
-		if err := e.App.Save(book); err != nil {
+	parsedBook, err := parseBookFile(app, book)
+	if err != nil {
+		return err
+	}
+
+	assetURLs, err := saveBookAssets(app, book, parsedBook.Assets)
+	if err != nil {
+		return err
+	}
+
+	var chapterIds []string
+	var chapterRecords []*core.Record
+	var sanitized book_parsers.SanitizeReport
+	for _, chapter := range parsedBook.Chapters {
+		chapter.Content = book_parsers.RewriteAssetURLs(chapter.Content, assetURLs)
+		sanitized.Merge(chapter.Sanitized)
+
+		chapterRecord := core.NewRecord(chaptersCollection)
+		setChapterFields(chapterRecord, &chapter, book.Id, user)
+
+		if err := app.Save(chapterRecord); err != nil {
 			return err
 		}
+		chapterIds = append(chapterIds, chapterRecord.Id)
+		chapterRecords = append(chapterRecords, chapterRecord)
+	}
 
-		return e.Next()
-	})
+	if err := saveTocEntries(app, book, parsedBook.Toc, chapterIds); err != nil {
+		return err
+	}
 
-	app.OnRecordViewRequest("books").BindFunc(func(e *core.RecordRequestEvent) error {
-		if e.HasSuperuserAuth() {
-			return e.Next()
-		}
+	if !sanitized.Empty() {
+		app.Logger().Info("removed unsafe HTML from imported chapters",
+			"book", book.Id,
+			"elements", sanitized.Elements,
+			"attributes", sanitized.Attributes,
+			"urls", sanitized.URLs,
+		)
+	}
 
-		if e.Auth == nil {
-			return e.Next()
-		}
+	setBookFields(book, parsedBook, chapterIds)
+	chapter_hooks.SetBookLength(book, chapterRecords)
+	book.Set("import_error", "")
 
-		user := e.Auth.Id
-		book := e.Record.Id
+	return app.Save(book)
+}
 
-		lastReadRecord, err := e.App.FindFirstRecordByData("last_read", "user", user)
-		if lastReadRecord == nil || err != nil {
-			err = createLastReadRecord(e.App, user, book)
-			if err != nil {
-				return err
-			}
+// parseBookFile reads the book's uploaded file and parses it.
+func parseBookFile(app core.App, book *core.Record) (*book_parsers.Book, error) {
+	fileKey := book.BaseFilesPath() + "/" + book.GetString("file")
 
-			return e.Next()
-		}
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
 
-		currentBookId := lastReadRecord.GetString("book")
-		if currentBookId != book {
-			bookRecord, err := e.App.FindRecordById("books", book)
-			if err != nil {
-				return err
-			}
+	r, err := fsys.GetReader(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
 
-			currentChapter := bookRecord.GetString("current_chapter")
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
 
-			lastReadRecord.Set("book", book)
-			lastReadRecord.Set("chapter", currentChapter)
+	return book_parsers.Parse(book_parsers.NewSource(book.GetString("file"), data))
+}
 
-			err = e.App.Save(lastReadRecord)
-			if err != nil {
-				return e.Next()
+// clearBookImport deletes the table of contents, vectors, chapters and assets
+// created for the book.
+func clearBookImport(app core.App, book *core.Record) error {
+	if err := deleteTocEntries(app, book.Id); err != nil {
+		return err
+	}
+
+	for _, collection := range []string{"vectors", "chapters", "book_assets"} {
+		records, err := app.FindAllRecords(collection, dbx.HashExp{"book": book.Id})
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			if err := app.Delete(record); err != nil {
+				return err
 			}
 		}
+	}
 
-		return e.Next()
-	})
+	book.Set("chapters", nil)
 
 	return nil
 }
 
-func setBookFields(book *core.Record, parsedBook *pamphlet.Book, chapterIds []string) {
-	book.Set("title", parsedBook.Title)
+func setBookFields(book *core.Record, parsedBook *book_parsers.Book, chapterIds []string) {
+	title := parsedBook.Title
+	if title == "" {
+		title = titleFromFilename(book.GetString("file"))
+	}
+
+	book.Set("title", title)
 	book.Set("author", parsedBook.Author)
 	book.Set("description", parsedBook.Description)
 	book.Set("language", parsedBook.Language)
 	book.Set("date", parsedBook.Date)
 	book.Set("subject", parsedBook.Subject)
-	book.Set("chapters+", chapterIds)
-	book.Set("current_chapter", chapterIds[0])
+	setBookDetails(book, parsedBook)
+	book.Set("chapters", chapterIds)
 }
 
-func setChapterFields(chapterRecord *core.Record, chapter *pamphlet.Chapter, html string, bookId string, userId string) {
+// setBookDetails sets the metadata used to sort and filter the library that
+// isn't shown as the book's title and author.
+func setBookDetails(book *core.Record, parsedBook *book_parsers.Book) {
+	book.Set("publisher", parsedBook.Publisher)
+	book.Set("rights", parsedBook.Rights)
+	book.Set("isbn", parsedBook.ISBN)
+	book.Set("identifiers", parsedBook.Identifiers)
+	book.Set("series", parsedBook.Series)
+	book.Set("series_index", parsedBook.SeriesIndex)
+	book.Set("contributors", parsedBook.Contributors)
+}
+
+func setChapterFields(chapterRecord *core.Record, chapter *book_parsers.Chapter, bookId string, userId string) {
 	chapterRecord.Set("book", bookId)
 	chapterRecord.Set("title", chapter.Title)
 	chapterRecord.Set("order", chapter.Order)
 	chapterRecord.Set("href", chapter.Href)
 	chapterRecord.Set("has_toc", chapter.HasToc)
-	chapterRecord.Set("content", html)
+	chapterRecord.Set("content", chapter.Content)
 	chapterRecord.Set("user", userId)
+	chapter_hooks.SetSanitizeReport(chapterRecord, chapter.Sanitized)
 }
 
-func setLastReadFields(lastRead *core.Record, userId, bookId string) {
-	lastRead.Set("user", userId)
-	lastRead.Set("book", bookId)
+// fileHash returns the hex encoded SHA-256 of the file's content.
+func fileHash(file *filesystem.File) (string, error) {
+	r, err := file.Reader.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-func setChatFields(chatRecord *core.Record, userId, bookId, title string) {
-	chatRecord.Set("user", userId)
-	chatRecord.Set("book", bookId)
-	chatRecord.Set("title", title)
+// titleFromFilename strips the extension and the random suffix PocketBase
+// appends to stored file names, e.g. "my_paper_k2j3h4g5f6.pdf" -> "my paper".
+func titleFromFilename(filename string) string {
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+	if i := strings.LastIndex(name, "_"); i > 0 && len(name)-i-1 == 10 {
+		name = name[:i]
+	}
+	return strings.TrimSpace(strings.ReplaceAll(name, "_", " "))
 }
 
-func createLastReadRecord(app core.App, userId, bookId string) error {
-	bookRecord, err := app.FindRecordById("books", bookId)
-	if err != nil {
-		return err
+// saveBookAssets stores the images extracted from the book and returns the URL
+// each one is served from, keyed by its href in the parsed chapter content.
+// The cover image is also used for the book's cover_image unless one was uploaded.
+func saveBookAssets(app core.App, book *core.Record, assets []book_parsers.Asset) (map[string]string, error) {
+	if len(assets) == 0 {
+		return nil, nil
 	}
 
-	lastReadCollection, err := app.FindCollectionByNameOrId("last_read")
+	assetsCollection, err := app.FindCollectionByNameOrId("book_assets")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	currentChapter := bookRecord.GetString("current_chapter")
+	urls := make(map[string]string, len(assets))
 
-	lastReadRecord := core.NewRecord(lastReadCollection)
-	lastReadRecord.Set("user", userId)
-	lastReadRecord.Set("book", bookId)
-	lastReadRecord.Set("chapter", currentChapter)
+	for _, asset := range assets {
+		name := path.Base(asset.Href)
 
-	err = app.Save(lastReadRecord)
-	if err != nil {
-		return err
+		if asset.IsCover && book.GetString("cover_image") == "" {
+			cover, err := filesystem.NewFileFromBytes(asset.Data, name)
+			if err != nil {
+				return nil, err
+			}
+			book.Set("cover_image", cover)
+		}
+
+		file, err := filesystem.NewFileFromBytes(asset.Data, name)
+		if err != nil {
+			return nil, err
+		}
+
+		assetRecord := core.NewRecord(assetsCollection)
+		assetRecord.Set("book", book.Id)
+		assetRecord.Set("user", book.GetString("user"))
+		assetRecord.Set("href", asset.Href)
+		assetRecord.Set("file", file)
+
+		if err := app.Save(assetRecord); err != nil {
+			return nil, err
+		}
+
+		urls[asset.Href] = assetURL(assetRecord)
 	}
 
-	return nil
+	return urls, nil
+}
+
+// assetURL returns the root-relative path the asset is served from, which the
+// client resolves against wherever it reaches PocketBase.
+func assetURL(asset *core.Record) string {
+	return "/api/files/" + asset.Collection().Id + "/" + asset.Id + "/" + asset.GetString("file")
+}
+
+func setChatFields(chatRecord *core.Record, userId, bookId, title string) {
+	chatRecord.Set("user", userId)
+	chatRecord.Set("book", bookId)
+	chatRecord.Set("title", title)
 }
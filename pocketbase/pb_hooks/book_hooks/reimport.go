@@ -0,0 +1,440 @@
+package book_hooks
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/book_parsers"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/chapter_hooks"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/highlight_hooks"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/net/html"
+)
+
+type ReimportReport struct {
+	ChaptersAdded        int `json:"chaptersAdded"`
+	ChaptersUpdated      int `json:"chaptersUpdated"`
+	ChaptersUnchanged    int `json:"chaptersUnchanged"`
+	ChaptersRemoved      int `json:"chaptersRemoved"`
+	HighlightsReanchored int `json:"highlightsReanchored"`
+	HighlightsUnanchored int `json:"highlightsUnanchored"`
+}
+
+// reimportChapter is a parsed chapter together with the existing chapter
+// record it replaces, or a new record.
+type reimportChapter struct {
+	record      *core.Record
+	content     string
+	replaced    bool
+	dirty       bool
+	textChanged bool
+}
+
+func initReimport(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.POST("/api/books/{id}/reimport", func(e *core.RequestEvent) error {
+			book, err := e.App.FindRecordById("books", e.Request.PathValue("id"))
+			if err != nil || book.GetString("user") != e.Auth.Id {
+				return e.NotFoundError("Book not found.", err)
+			}
+
+			jobs, err := e.App.FindRecordsByFilter("ingest_jobs", "book = {:book}", "-created", 1, 0, dbx.Params{"book": book.Id})
+			if err == nil && len(jobs) > 0 {
+				switch jobs[0].GetString("status") {
+				case IngestQueued, IngestParsing, IngestChunking:
+					return e.BadRequestError("The book is still being imported.", nil)
+				}
+			}
+
+			job, err := queueIngestJob(e.App, book, IngestKindReimport)
+			if err != nil {
+				return e.InternalServerError("failed to queue reimport", err)
+			}
+
+			return e.JSON(http.StatusAccepted, job)
+		}).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+}
+
+// runReimportJob parses the book's file again and updates its chapters, then
+// waits for the vectors of changed chapters to be embedded like an import. The
+// report of what changed is stored on the job.
+func runReimportJob(app core.App, job *core.Record, book *core.Record) error {
+	job.Set("status", IngestParsing)
+	if err := app.Save(job); err != nil {
+		return err
+	}
+
+	parsedBook, err := parseBookFile(app, book)
+	if err != nil {
+		return err
+	}
+
+	var report *ReimportReport
+	err = app.RunInTransaction(func(txApp core.App) error {
+		report, err = reimportBook(txApp, book, parsedBook)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	total, err := app.CountRecords("vectors", dbx.HashExp{"book": book.Id})
+	if err != nil {
+		return err
+	}
+
+	chapters := len(book.GetStringSlice("chapters"))
+	job.Set("status", IngestEmbedding)
+	job.Set("chapters_total", chapters)
+	job.Set("chapters_done", chapters)
+	job.Set("vectors_total", total)
+	job.Set("report", report)
+	job.Set("error", "")
+	return app.Save(job)
+}
+
+// reimportBook updates the book's chapters from a new parse of its file.
+// Chapters are matched by href, or by order for formats without stable hrefs,
+// and only chapters whose content changed are rewritten. Highlights of
+// rewritten or removed chapters are re-anchored by their text, and vectors are
+// regenerated for chapters whose text changed.
+func reimportBook(app core.App, book *core.Record, parsedBook *book_parsers.Book) (*ReimportReport, error) {
+	report := &ReimportReport{}
+
+	chaptersCollection, err := app.FindCollectionByNameOrId("chapters")
+	if err != nil {
+		return nil, err
+	}
+
+	assetURLs, err := reimportAssets(app, book, parsedBook.Assets)
+	if err != nil {
+		return nil, err
+	}
+
+	oldChapters, err := app.FindRecordsByFilter("chapters", "book = {:book}", "order", 0, 0, dbx.Params{"book": book.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	byHref := make(map[string]*core.Record, len(oldChapters))
+	byOrder := make(map[int]*core.Record, len(oldChapters))
+	for _, chapter := range oldChapters {
+		if href := chapter.GetString("href"); href != "" {
+			byHref[href] = chapter
+		}
+		byOrder[chapter.GetInt("order")] = chapter
+	}
+
+	matched := make(map[string]bool, len(oldChapters))
+	chapters := make([]*reimportChapter, 0, len(parsedBook.Chapters))
+	for _, parsed := range parsedBook.Chapters {
+		content := book_parsers.RewriteAssetURLs(parsed.Content, assetURLs)
+
+		old := byHref[parsed.Href]
+		if old == nil || matched[old.Id] {
+			old = byOrder[parsed.Order]
+		}
+		if old == nil || matched[old.Id] {
+			record := core.NewRecord(chaptersCollection)
+			setChapterFields(record, &parsed, book.Id, book.GetString("user"))
+			chapters = append(chapters, &reimportChapter{record: record, content: content, dirty: true, textChanged: true})
+			report.ChaptersAdded++
+			continue
+		}
+		matched[old.Id] = true
+
+		chapter := &reimportChapter{record: old, content: old.GetString("content")}
+		chapters = append(chapters, chapter)
+
+		stripped, err := highlight_hooks.StripMarks(old.GetString("content"))
+		if err != nil {
+			return nil, err
+		}
+
+		if old.GetString("title") != parsed.Title || old.GetInt("order") != parsed.Order || old.GetString("href") != parsed.Href {
+			chapter.dirty = true
+		}
+
+		if normalizeHTML(stripped) != normalizeHTML(content) {
+			oldText, err := highlight_hooks.TextContent(stripped)
+			if err != nil {
+				return nil, err
+			}
+			newText, err := highlight_hooks.TextContent(content)
+			if err != nil {
+				return nil, err
+			}
+
+			chapter.content = content
+			chapter.replaced = true
+			chapter.dirty = true
+			chapter.textChanged = oldText != newText
+		}
+
+		// vectors carry the chapter title as well as its text
+		if old.GetString("title") != parsed.Title {
+			chapter.textChanged = true
+		}
+
+		if chapter.dirty {
+			setChapterFields(old, &parsed, book.Id, book.GetString("user"))
+			report.ChaptersUpdated++
+		} else {
+			report.ChaptersUnchanged++
+		}
+	}
+
+	var removed []*core.Record
+	for _, chapter := range oldChapters {
+		if !matched[chapter.Id] {
+			removed = append(removed, chapter)
+		}
+	}
+	report.ChaptersRemoved = len(removed)
+
+	// highlights of chapters whose content was replaced or that no longer exist
+	// are anchored again by searching for their text
+	type pendingHighlight struct {
+		record *core.Record
+		target *reimportChapter
+	}
+	var pending []pendingHighlight
+	for _, chapter := range chapters {
+		if !chapter.replaced {
+			continue
+		}
+		highlights, err := app.FindAllRecords("highlights", dbx.HashExp{"chapter": chapter.record.Id})
+		if err != nil {
+			return nil, err
+		}
+		for _, highlight := range highlights {
+			pending = append(pending, pendingHighlight{highlight, chapter})
+		}
+	}
+	for _, chapter := range removed {
+		highlights, err := app.FindAllRecords("highlights", dbx.HashExp{"chapter": chapter.Id})
+		if err != nil {
+			return nil, err
+		}
+		for _, highlight := range highlights {
+			pending = append(pending, pendingHighlight{highlight, closestChapter(chapters, chapter.GetInt("order"))})
+		}
+	}
+
+	for i := range pending {
+		highlight := pending[i].record
+
+		candidates := []*reimportChapter{pending[i].target}
+		for _, chapter := range chapters {
+			if chapter != pending[i].target {
+				candidates = append(candidates, chapter)
+			}
+		}
+
+		anchored := false
+		for _, chapter := range candidates {
+			if chapter == nil {
+				continue
+			}
+
+			anchor, err := highlight_hooks.FindAnchor(chapter.content, highlight.GetString("text"), highlight_hooks.AnchorFromRecord(highlight))
+			if err != nil {
+				return nil, err
+			}
+			if anchor != nil {
+				highlight_hooks.SetAnchor(highlight, anchor)
+				pending[i].target = chapter
+				anchored = true
+				break
+			}
+		}
+
+		if anchored {
+			report.HighlightsReanchored++
+		} else {
+			report.HighlightsUnanchored++
+		}
+	}
+
+	chapterIds := make([]string, 0, len(chapters))
+	for _, chapter := range chapters {
+		if chapter.dirty {
+			chapter.record.Set("content", chapter.content)
+			if err := app.Save(chapter.record); err != nil {
+				return nil, err
+			}
+		}
+		chapterIds = append(chapterIds, chapter.record.Id)
+	}
+
+	// the table of contents is rebuilt, as its entries point at chapters that
+	// may have been added or removed
+	if err := deleteTocEntries(app, book.Id); err != nil {
+		return nil, err
+	}
+	if err := saveTocEntries(app, book, parsedBook.Toc, chapterIds); err != nil {
+		return nil, err
+	}
+
+	for _, p := range pending {
+		if p.target == nil {
+			// the book has no chapters left to keep the highlight on
+			if err := app.Delete(p.record); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		p.record.Set("chapter", p.target.record.Id)
+		if err := app.Save(p.record); err != nil {
+			return nil, err
+		}
+	}
+
+	// chapters that were removed are replaced by the chapter now at their position
+	replacements := make(map[string]string, len(removed))
+	for _, chapter := range removed {
+		if replacement := closestChapter(chapters, chapter.GetInt("order")); replacement != nil {
+			replacements[chapter.Id] = replacement.record.Id
+		}
+
+		if err := deleteChapterVectors(app, chapter.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	// reading positions and bookmarks move to the start of the replacement
+	for _, collection := range []string{"reading_positions", "bookmarks"} {
+		locations, err := app.FindAllRecords(collection, dbx.HashExp{"book": book.Id})
+		if err != nil {
+			return nil, err
+		}
+		for _, location := range locations {
+			if replacement, ok := replacements[location.GetString("chapter")]; ok {
+				location.Set("chapter", replacement)
+				location.Set("path", "")
+				location.Set("node_index", 0)
+				location.Set("offset", 0)
+				location.Set("percentage", 0)
+				if err := app.Save(location); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// books imported before these fields existed get them on reimport, while
+	// the title and author the user may have edited are kept
+	setBookDetails(book, parsedBook)
+	book.Set("chapters", chapterIds)
+	chapterRecords := make([]*core.Record, 0, len(chapters))
+	for _, chapter := range chapters {
+		chapterRecords = append(chapterRecords, chapter.record)
+	}
+	chapter_hooks.SetBookLength(book, chapterRecords)
+	book.Set("import_error", "")
+	if err := app.Save(book); err != nil {
+		return nil, err
+	}
+
+	for _, chapter := range removed {
+		if err := app.Delete(chapter); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, chapter := range chapters {
+		if !chapter.textChanged {
+			continue
+		}
+
+		if err := deleteChapterVectors(app, chapter.record.Id); err != nil {
+			return nil, err
+		}
+		if _, err := chapter_hooks.CreateChapterVectors(app, chapter.record); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// reimportAssets keeps the assets that were already extracted, so their URLs in
+// unchanged chapters stay valid, and saves the ones that are new.
+func reimportAssets(app core.App, book *core.Record, assets []book_parsers.Asset) (map[string]string, error) {
+	existing, err := app.FindAllRecords("book_assets", dbx.HashExp{"book": book.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make(map[string]string, len(assets))
+	for _, asset := range existing {
+		urls[asset.GetString("href")] = assetURL(asset)
+	}
+
+	var missing []book_parsers.Asset
+	for _, asset := range assets {
+		if _, ok := urls[asset.Href]; !ok {
+			missing = append(missing, asset)
+		}
+	}
+
+	added, err := saveBookAssets(app, book, missing)
+	if err != nil {
+		return nil, err
+	}
+	for href, url := range added {
+		urls[href] = url
+	}
+
+	return urls, nil
+}
+
+func deleteChapterVectors(app core.App, chapterId string) error {
+	vectors, err := app.FindAllRecords("vectors", dbx.HashExp{"chapter": chapterId})
+	if err != nil {
+		return err
+	}
+
+	for _, vector := range vectors {
+		if err := app.Delete(vector); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// closestChapter returns the chapter at the given order, or the last one
+// before it.
+func closestChapter(chapters []*reimportChapter, order int) *reimportChapter {
+	var closest *reimportChapter
+	for _, chapter := range chapters {
+		if chapter.record.GetInt("order") > order && closest != nil {
+			break
+		}
+		closest = chapter
+	}
+	return closest
+}
+
+// normalizeHTML renders the content through the HTML parser so that markup
+// serialized by the editor compares equal to the parser's output.
+func normalizeHTML(content string) string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return content
+	}
+
+	var buf strings.Builder
+	if err := html.Render(&buf, doc); err != nil {
+		return content
+	}
+	return buf.String()
+}
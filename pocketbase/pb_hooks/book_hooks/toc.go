@@ -0,0 +1,65 @@
+package book_hooks
+
+import (
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/book_parsers"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// saveTocEntries saves the book's table of contents as a tree of toc_entries.
+// chapterIds holds the id of the record saved for each parsed chapter, in the
+// same order as the parsed book's chapters.
+func saveTocEntries(app core.App, book *core.Record, toc []book_parsers.TocEntry, chapterIds []string) error {
+	collection, err := app.FindCollectionByNameOrId("toc_entries")
+	if err != nil {
+		return err
+	}
+
+	order := 0
+	var save func(entries []book_parsers.TocEntry, parentId string, depth int) error
+	save = func(entries []book_parsers.TocEntry, parentId string, depth int) error {
+		for _, entry := range entries {
+			order++
+
+			record := core.NewRecord(collection)
+			record.Set("book", book.Id)
+			record.Set("user", book.GetString("user"))
+			record.Set("parent", parentId)
+			record.Set("depth", depth)
+			record.Set("order", order)
+			record.Set("label", entry.Label)
+			record.Set("fragment", entry.Fragment)
+			if entry.Chapter >= 0 && entry.Chapter < len(chapterIds) {
+				record.Set("chapter", chapterIds[entry.Chapter])
+			}
+
+			if err := app.Save(record); err != nil {
+				return err
+			}
+
+			if err := save(entry.Children, record.Id, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return save(toc, "", 0)
+}
+
+// deleteTocEntries deletes the book's table of contents, deepest entries first
+// so no entry is deleted twice through the cascade from its parent.
+func deleteTocEntries(app core.App, bookId string) error {
+	entries, err := app.FindRecordsByFilter("toc_entries", "book = {:book}", "-depth", 0, 0, dbx.Params{"book": bookId})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := app.Delete(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package book_parsers
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var imageRefRegex = regexp.MustCompile(`(?i)(<(?:img|image)\b[^>]*?\s(?:src|xlink:href|href)\s*=\s*)("[^"]*"|'[^']*')`)
+
+// rewriteImageRefs calls rewrite for the source of every <img> and SVG <image>
+// in content and replaces it with the result.
+func rewriteImageRefs(content string, rewrite func(src string) string) string {
+	return imageRefRegex.ReplaceAllStringFunc(content, func(match string) string {
+		parts := imageRefRegex.FindStringSubmatch(match)
+		quoted := parts[2]
+		src := html.UnescapeString(quoted[1 : len(quoted)-1])
+
+		rewritten := rewrite(src)
+		if rewritten == src {
+			return match
+		}
+
+		return parts[1] + `"` + html.EscapeString(rewritten) + `"`
+	})
+}
+
+// RewriteAssetURLs replaces the asset hrefs left in chapter content by the
+// parser with the URLs the stored assets are served from.
+func RewriteAssetURLs(content string, urls map[string]string) string {
+	if len(urls) == 0 {
+		return content
+	}
+
+	return rewriteImageRefs(content, func(src string) string {
+		if url, ok := urls[src]; ok {
+			return url
+		}
+		return src
+	})
+}
+
+func isExternalRef(src string) bool {
+	return strings.HasPrefix(src, "data:") || strings.Contains(src, "://") || strings.HasPrefix(src, "//")
+}
@@ -0,0 +1,129 @@
+package book_parsers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/timsims/pamphlet"
+)
+
+var pageStyleRegex = regexp.MustCompile(`(?s)^.*@page\s*\{[^}]*\}\s*`)
+
+type EpubParser struct{}
+
+func (p *EpubParser) Name() string {
+	return "epub"
+}
+
+func (p *EpubParser) Detect(src *Source) bool {
+	return src.HasMimeType(pamphlet.Mimetype) || (src.HasMimeType("application/zip") && src.Ext() == ".epub")
+}
+
+func (p *EpubParser) Parse(src *Source) (*Book, error) {
+	parser, err := pamphlet.OpenBytes(src.Data)
+	if err != nil {
+		return nil, err
+	}
+	defer parser.Close()
+
+	archive, err := openEpubArchive(src.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedBook := parser.GetBook()
+
+	book := &Book{
+		Title:       parsedBook.Title,
+		Author:      parsedBook.Author,
+		Description: parsedBook.Description,
+		Language:    parsedBook.Language,
+		Date:        parsedBook.Date,
+		Subject:     parsedBook.Subject,
+	}
+	archive.applyMetadata(book)
+
+	images := make(map[string]opfItem)
+	for _, item := range archive.opf.Manifest.Items {
+		if strings.HasPrefix(item.MediaType, "image/") {
+			images[archive.manifestPath(item)] = item
+		}
+	}
+
+	// image references are rewritten to their path inside the archive, which
+	// is also the href of the asset returned for them
+	usedImages := make(map[string]bool)
+	chapterIndex := make(map[string]int)
+	for _, chapter := range parsedBook.Chapters {
+		content, err := chapter.GetContent()
+		if err != nil {
+			continue
+		}
+
+		content = pageStyleRegex.ReplaceAllString(content, "")
+
+		chapterPath := resolveHref(archive.opfPath, chapter.Href)
+		content = rewriteImageRefs(content, func(src string) string {
+			if isExternalRef(src) {
+				return src
+			}
+			target := resolveHref(chapterPath, src)
+			if _, ok := images[target]; !ok {
+				return src
+			}
+			usedImages[target] = true
+			return target
+		})
+
+		// every spine item is kept in reading order, titled or not
+		chapterIndex[chapterPath] = len(book.Chapters)
+		book.Chapters = append(book.Chapters, Chapter{
+			Order:   len(book.Chapters) + 1,
+			Href:    chapter.Href,
+			Content: "<!DOCTYPE html>" + content,
+		})
+	}
+
+	book.Toc = archive.toc()
+	linkToc(book.Toc, chapterIndex, book.Chapters)
+
+	for i := range book.Chapters {
+		chapter := &book.Chapters[i]
+		if chapter.Title == "" {
+			chapter.Title = headingTitle(chapter.Content)
+		}
+		if chapter.Title == "" {
+			chapter.Title = fmt.Sprintf("Section %d", chapter.Order)
+		}
+	}
+
+	coverPath := ""
+	if cover, ok := archive.coverItem(); ok {
+		coverPath = archive.manifestPath(cover)
+		usedImages[coverPath] = true
+	}
+
+	hrefs := make([]string, 0, len(usedImages))
+	for href := range usedImages {
+		hrefs = append(hrefs, href)
+	}
+	sort.Strings(hrefs)
+
+	for _, href := range hrefs {
+		data, err := archive.readFile(href)
+		if err != nil {
+			continue
+		}
+
+		book.Assets = append(book.Assets, Asset{
+			Href:      href,
+			MediaType: images[href].MediaType,
+			Data:      data,
+			IsCover:   href == coverPath,
+		})
+	}
+
+	return book, nil
+}
@@ -0,0 +1,213 @@
+package book_parsers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+type HTMLParser struct{}
+
+type htmlSection struct {
+	title string
+	nodes []*html.Node
+}
+
+func (p *HTMLParser) Name() string {
+	return "html"
+}
+
+func (p *HTMLParser) Detect(src *Source) bool {
+	switch src.Ext() {
+	case ".html", ".htm", ".xhtml":
+		return true
+	}
+	return src.HasMimeType("text/html", "application/xhtml+xml")
+}
+
+func (p *HTMLParser) Parse(src *Source) (*Book, error) {
+	doc, err := html.Parse(bytes.NewReader(src.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	book := &Book{
+		Title:       collapseSpace(innerText(findElement(doc, "title"))),
+		Author:      metaContent(doc, "author"),
+		Description: metaContent(doc, "description"),
+		Subject:     metaContent(doc, "keywords"),
+	}
+	if root := findElement(doc, "html"); root != nil {
+		book.Language = attr(root, "lang")
+	}
+
+	body := findElement(doc, "body")
+	if body == nil {
+		body = doc
+	}
+
+	chapters, title, err := htmlChapters(body)
+	if err != nil {
+		return nil, err
+	}
+
+	book.Chapters = chapters
+	if book.Title == "" {
+		book.Title = title
+	}
+
+	return book, nil
+}
+
+// htmlChapters splits a document body into chapters on its <h1> headings, or
+// on <h2> when the document has a single title heading, which is returned as
+// the document title.
+func htmlChapters(body *html.Node) (chapters []Chapter, title string, err error) {
+	level := ""
+	if countElements(body, "h1") >= 2 {
+		level = "h1"
+	} else if countElements(body, "h2") >= 2 {
+		level = "h2"
+	}
+
+	sections := []*htmlSection{{}}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && level != "" {
+				if c.Data == level {
+					sections = append(sections, &htmlSection{title: collapseSpace(innerText(c))})
+				} else if countElements(c, level) > 0 {
+					walk(c)
+					continue
+				}
+			}
+			current := sections[len(sections)-1]
+			current.nodes = append(current.nodes, c)
+		}
+	}
+	walk(body)
+
+	// with a single <h1> it names the whole document rather than a chapter
+	if level != "h1" {
+		title = collapseSpace(innerText(findElement(body, "h1")))
+	}
+
+	if level == "" {
+		sections[0].title = title
+	} else if frontMatter := collapseSpace(nodesText(sections[0].nodes)); frontMatter == "" || frontMatter == title {
+		sections = sections[1:]
+	} else {
+		sections[0].title = "Front Matter"
+	}
+
+	for i, section := range sections {
+		var buf bytes.Buffer
+		for _, n := range section.nodes {
+			if err := html.Render(&buf, n); err != nil {
+				return nil, "", err
+			}
+		}
+
+		chapterTitle := section.title
+		if chapterTitle == "" {
+			chapterTitle = fmt.Sprintf("Section %d", i+1)
+		}
+
+		chapters = append(chapters, Chapter{
+			Title:   chapterTitle,
+			Order:   i + 1,
+			Href:    fmt.Sprintf("section-%d", i+1),
+			HasToc:  section.title != "",
+			Content: chapterDocument(chapterTitle, buf.String()),
+		})
+	}
+
+	return chapters, title, nil
+}
+
+func nodesText(nodes []*html.Node) string {
+	var text strings.Builder
+	for _, n := range nodes {
+		text.WriteString(innerText(n))
+	}
+	return text.String()
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	if n == nil {
+		return nil
+	}
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func countElements(n *html.Node, tag string) int {
+	count := 0
+	if n.Type == html.ElementNode && n.Data == tag {
+		count++
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		count += countElements(c, tag)
+	}
+	return count
+}
+
+func innerText(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var text strings.Builder
+	var extractText func(*html.Node)
+	extractText = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			text.WriteString(node.Data)
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			extractText(c)
+		}
+	}
+	extractText(n)
+	return text.String()
+}
+
+func metaContent(doc *html.Node, name string) string {
+	var content string
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if content != "" {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "meta" && strings.EqualFold(attr(n, "name"), name) {
+			content = strings.TrimSpace(attr(n, "content"))
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	return content
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,43 @@
+package book_parsers
+
+import (
+	"strings"
+
+	"gitlab.com/golang-commonmark/markdown"
+	"golang.org/x/net/html"
+)
+
+var md = markdown.New(markdown.HTML(true), markdown.Tables(true), markdown.XHTMLOutput(true))
+
+type MarkdownParser struct{}
+
+func (p *MarkdownParser) Name() string {
+	return "markdown"
+}
+
+func (p *MarkdownParser) Detect(src *Source) bool {
+	switch src.Ext() {
+	case ".md", ".markdown":
+		return true
+	}
+	return src.HasMimeType("text/markdown", "text/x-markdown")
+}
+
+func (p *MarkdownParser) Parse(src *Source) (*Book, error) {
+	text := normalizeText(src.Data)
+
+	body, err := html.Parse(strings.NewReader("<body>" + md.RenderToString([]byte(text)) + "</body>"))
+	if err != nil {
+		return nil, err
+	}
+
+	chapters, title, err := htmlChapters(findElement(body, "body"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Book{
+		Title:    title,
+		Chapters: chapters,
+	}, nil
+}
@@ -0,0 +1,205 @@
+package book_parsers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// applyMetadata adds the metadata of the OPF package that pamphlet doesn't
+// read: identifiers, publisher, rights, series and every creator and
+// contributor with their roles.
+func (a *epubArchive) applyMetadata(book *Book) {
+	metadata := a.opf.Metadata
+	refinements := a.refinements()
+
+	if len(metadata.Publishers) > 0 {
+		book.Publisher = strings.TrimSpace(metadata.Publishers[0])
+	}
+	if len(metadata.Rights) > 0 {
+		book.Rights = strings.TrimSpace(metadata.Rights[0])
+	}
+
+	for _, identifier := range metadata.Identifiers {
+		value := strings.TrimSpace(identifier.Value)
+		if value == "" {
+			continue
+		}
+
+		scheme := strings.ToLower(identifier.Scheme)
+		if scheme == "" {
+			scheme = identifierScheme(value, refinements[identifier.ID])
+		}
+
+		if isbn, ok := normalizeISBN(value); ok && (scheme == "isbn" || scheme == "") {
+			scheme = "isbn"
+			value = isbn
+			if book.ISBN == "" {
+				book.ISBN = isbn
+			}
+		}
+
+		book.Identifiers = append(book.Identifiers, Identifier{Scheme: scheme, Value: value})
+	}
+
+	var authors []string
+	addContributors := func(creators []opfCreator, defaultRole string) {
+		for _, creator := range creators {
+			name := strings.TrimSpace(creator.Name)
+			if name == "" {
+				continue
+			}
+
+			refined := refinements[creator.ID]
+			contributor := Contributor{
+				Name:   name,
+				Role:   firstNonEmpty(refined["role"], creator.Role, defaultRole),
+				FileAs: firstNonEmpty(refined["file-as"], creator.FileAs),
+			}
+			book.Contributors = append(book.Contributors, contributor)
+
+			if contributor.Role == "aut" {
+				authors = append(authors, name)
+			}
+		}
+	}
+	addContributors(metadata.Creators, "aut")
+	addContributors(metadata.Contributors, "ctb")
+
+	if len(authors) > 0 {
+		book.Author = strings.Join(authors, ", ")
+	}
+
+	book.Series, book.SeriesIndex = a.series(refinements)
+}
+
+// refinements returns the EPUB 3 <meta refines="#id"> properties by the id of
+// the element they refine.
+func (a *epubArchive) refinements() map[string]map[string]string {
+	refinements := make(map[string]map[string]string)
+	for _, meta := range a.opf.Metadata.Meta {
+		id, ok := strings.CutPrefix(meta.Refines, "#")
+		if !ok || meta.Property == "" {
+			continue
+		}
+
+		if refinements[id] == nil {
+			refinements[id] = make(map[string]string)
+		}
+		if _, exists := refinements[id][meta.Property]; !exists {
+			refinements[id][meta.Property] = strings.TrimSpace(meta.Value)
+		}
+	}
+	return refinements
+}
+
+// series returns the series the book belongs to, from an EPUB 3 collection
+// or the calibre:series metadata calibre adds to EPUB 2 files.
+func (a *epubArchive) series(refinements map[string]map[string]string) (string, float64) {
+	for _, meta := range a.opf.Metadata.Meta {
+		if meta.Property != "belongs-to-collection" || meta.Refines != "" {
+			continue
+		}
+
+		refined := refinements[meta.ID]
+		if collectionType := refined["collection-type"]; collectionType != "" && collectionType != "series" {
+			continue
+		}
+
+		if name := strings.TrimSpace(meta.Value); name != "" {
+			index, _ := strconv.ParseFloat(refined["group-position"], 64)
+			return name, index
+		}
+	}
+
+	var name string
+	var index float64
+	for _, meta := range a.opf.Metadata.Meta {
+		switch meta.Name {
+		case "calibre:series":
+			name = strings.TrimSpace(meta.Content)
+		case "calibre:series_index":
+			index, _ = strconv.ParseFloat(strings.TrimSpace(meta.Content), 64)
+		}
+	}
+	if name == "" {
+		return "", 0
+	}
+
+	return name, index
+}
+
+// identifierScheme guesses the scheme of an identifier without an
+// opf:scheme attribute from its URN prefix or its EPUB 3 identifier-type.
+func identifierScheme(value string, refined map[string]string) string {
+	lower := strings.ToLower(value)
+	if rest, ok := strings.CutPrefix(lower, "urn:"); ok {
+		if scheme, _, found := strings.Cut(rest, ":"); found {
+			return scheme
+		}
+	}
+
+	// ONIX code list 5: 02 is ISBN-10 and 15 is ISBN-13
+	switch refined["identifier-type"] {
+	case "02", "15":
+		return "isbn"
+	}
+
+	return ""
+}
+
+// normalizeISBN returns the digits of a valid ISBN-10 or ISBN-13, ignoring
+// a urn:isbn: prefix, hyphens and spaces.
+func normalizeISBN(value string) (string, bool) {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	lower = strings.TrimPrefix(lower, "urn:isbn:")
+	lower = strings.TrimPrefix(lower, "isbn:")
+
+	digits := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(lower))
+
+	switch len(digits) {
+	case 10:
+		sum := 0
+		for i, r := range digits {
+			var d int
+			switch {
+			case r >= '0' && r <= '9':
+				d = int(r - '0')
+			case r == 'X' && i == 9:
+				d = 10
+			default:
+				return "", false
+			}
+			sum += d * (10 - i)
+		}
+		return digits, sum%11 == 0
+	case 13:
+		sum := 0
+		for i, r := range digits {
+			if r < '0' || r > '9' {
+				return "", false
+			}
+			d := int(r - '0')
+			if i%2 == 1 {
+				d *= 3
+			}
+			sum += d
+		}
+		return digits, sum%10 == 0
+	}
+
+	return "", false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
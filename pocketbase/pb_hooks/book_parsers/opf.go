@@ -0,0 +1,193 @@
+package book_parsers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// epubArchive reads the parts of the OPF package document that pamphlet does
+// not expose, such as manifest properties and <meta> entries.
+type epubArchive struct {
+	files   map[string]*zip.File
+	opfPath string
+	opf     opfPackage
+}
+
+type opfPackage struct {
+	Metadata opfMetadata `xml:"metadata"`
+	Manifest struct {
+		Items []opfItem `xml:"item"`
+	} `xml:"manifest"`
+	Spine struct {
+		Toc string `xml:"toc,attr"`
+	} `xml:"spine"`
+}
+
+type opfMetadata struct {
+	Identifiers  []opfIdentifier `xml:"identifier"`
+	Creators     []opfCreator    `xml:"creator"`
+	Contributors []opfCreator    `xml:"contributor"`
+	Publishers   []string        `xml:"publisher"`
+	Rights       []string        `xml:"rights"`
+	Meta         []opfMeta       `xml:"meta"`
+}
+
+type opfIdentifier struct {
+	ID     string `xml:"id,attr"`
+	Scheme string `xml:"scheme,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// opfCreator is a dc:creator or dc:contributor. EPUB 2 gives the role and
+// sort name as attributes, EPUB 3 in <meta> elements refining the id.
+type opfCreator struct {
+	ID     string `xml:"id,attr"`
+	Role   string `xml:"role,attr"`
+	FileAs string `xml:"file-as,attr"`
+	Name   string `xml:",chardata"`
+}
+
+type opfMeta struct {
+	Name     string `xml:"name,attr"`
+	Content  string `xml:"content,attr"`
+	Property string `xml:"property,attr"`
+	Refines  string `xml:"refines,attr"`
+	ID       string `xml:"id,attr"`
+	Scheme   string `xml:"scheme,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type opfItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+type epubContainer struct {
+	RootFiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+func openEpubArchive(data []byte) (*epubArchive, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &epubArchive{files: make(map[string]*zip.File, len(reader.File))}
+	for _, f := range reader.File {
+		archive.files[f.Name] = f
+	}
+
+	raw, err := archive.readFile("META-INF/container.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	var container epubContainer
+	if err := xml.Unmarshal(raw, &container); err != nil {
+		return nil, err
+	}
+	if len(container.RootFiles) == 0 {
+		return nil, errors.New("epub container has no root file")
+	}
+	archive.opfPath = container.RootFiles[0].FullPath
+
+	raw, err = archive.readFile(archive.opfPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := xml.Unmarshal(raw, &archive.opf); err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+func (a *epubArchive) readFile(name string) ([]byte, error) {
+	f, ok := a.files[name]
+	if !ok {
+		// some archives differ in case from the paths referenced in their xml
+		for fileName, file := range a.files {
+			if strings.EqualFold(fileName, name) {
+				f, ok = file, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, errors.New("epub file not found: " + name)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// resolveHref turns an href found in a file at base into a path inside the archive.
+func resolveHref(base, href string) string {
+	if i := strings.IndexAny(href, "#?"); i >= 0 {
+		href = href[:i]
+	}
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	return path.Clean(path.Join(path.Dir(base), href))
+}
+
+// manifestPath returns the archive path of a manifest item.
+func (a *epubArchive) manifestPath(item opfItem) string {
+	return resolveHref(a.opfPath, item.Href)
+}
+
+// coverItem finds the cover image declared in the manifest (EPUB 3), in the
+// metadata (EPUB 2), or failing both an image that is named like a cover.
+func (a *epubArchive) coverItem() (opfItem, bool) {
+	items := a.opf.Manifest.Items
+
+	for _, item := range items {
+		if hasProperty(item.Properties, "cover-image") {
+			return item, true
+		}
+	}
+
+	for _, meta := range a.opf.Metadata.Meta {
+		if meta.Name != "cover" {
+			continue
+		}
+		for _, item := range items {
+			if item.ID == meta.Content && strings.HasPrefix(item.MediaType, "image/") {
+				return item, true
+			}
+		}
+	}
+
+	for _, item := range items {
+		if strings.HasPrefix(item.MediaType, "image/") && (strings.Contains(strings.ToLower(item.ID), "cover") || strings.Contains(strings.ToLower(item.Href), "cover")) {
+			return item, true
+		}
+	}
+
+	return opfItem{}, false
+}
+
+func hasProperty(properties, property string) bool {
+	for _, p := range strings.Fields(properties) {
+		if p == property {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package book_parsers
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported book format")
+	ErrNoChapters        = errors.New("book has no readable chapters")
+)
+
+// BookParser turns the raw bytes of an uploaded book into metadata, ordered
+// chapters with HTML content and any embedded assets.
+type BookParser interface {
+	Name() string
+	Detect(src *Source) bool
+	Parse(src *Source) (*Book, error)
+}
+
+type Source struct {
+	Filename string
+	MimeType string
+	Data     []byte
+}
+
+type Book struct {
+	Title       string
+	Author      string
+	Description string
+	Language    string
+	Date        string
+	Subject     string
+	Publisher   string
+	Rights      string
+	ISBN        string
+	Series      string
+	SeriesIndex float64
+	// Identifiers and Contributors are only known for EPUBs. Author holds the
+	// names of the contributors with the author role.
+	Identifiers  []Identifier
+	Contributors []Contributor
+	Chapters     []Chapter
+	Toc          []TocEntry
+	Assets       []Asset
+}
+
+type Identifier struct {
+	Scheme string `json:"scheme"`
+	Value  string `json:"value"`
+}
+
+// Contributor is a person credited in the book. Role is a MARC relator code
+// such as "aut", "edt" or "trl".
+type Contributor struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	FileAs string `json:"fileAs,omitempty"`
+}
+
+type Chapter struct {
+	Title   string
+	Order   int
+	Href    string
+	HasToc  bool
+	Content string
+	// what was removed from Content when it was sanitized
+	Sanitized SanitizeReport
+}
+
+type Asset struct {
+	Href      string
+	MediaType string
+	Data      []byte
+	IsCover   bool
+}
+
+var parsers = []BookParser{
+	&EpubParser{},
+	&PDFParser{},
+	&HTMLParser{},
+	&MarkdownParser{},
+	&TextParser{},
+}
+
+// Register adds a parser to the registry. Parsers are tried in registration
+// order, so more specific formats should be registered first.
+func Register(parser BookParser) {
+	parsers = append(parsers, parser)
+}
+
+func NewSource(filename string, data []byte) *Source {
+	return &Source{
+		Filename: filename,
+		MimeType: mimetype.Detect(data).String(),
+		Data:     data,
+	}
+}
+
+// Detect returns the first registered parser that accepts the source.
+func Detect(src *Source) (BookParser, error) {
+	for _, parser := range parsers {
+		if parser.Detect(src) {
+			return parser, nil
+		}
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+func Parse(src *Source) (*Book, error) {
+	parser, err := Detect(src)
+	if err != nil {
+		return nil, err
+	}
+	book, err := parser.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(book.Chapters) == 0 {
+		return nil, ErrNoChapters
+	}
+
+	for i := range book.Chapters {
+		book.Chapters[i].Content, book.Chapters[i].Sanitized = SanitizeChapter(book.Chapters[i].Content)
+	}
+
+	if len(book.Toc) == 0 {
+		book.Toc = flatToc(book.Chapters)
+	}
+
+	return book, nil
+}
+
+func (s *Source) Ext() string {
+	return strings.ToLower(filepath.Ext(s.Filename))
+}
+
+func (s *Source) HasMimeType(mimeTypes ...string) bool {
+	return mimetype.EqualsAny(s.MimeType, mimeTypes...)
+}
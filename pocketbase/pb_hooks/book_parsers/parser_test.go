@@ -0,0 +1,373 @@
+package book_parsers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// readFixture returns the content of a file in testdata. EPUBs are kept
+// unpacked in a directory and zipped here, with the mimetype entry first and
+// stored as the format requires.
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	dir := filepath.Join("testdata", strings.TrimSuffix(name, ".epub"))
+	if filepath.Ext(name) != ".epub" {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	mimetype, err := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mimetype.Write([]byte("application/epub+zip")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() == "mimetype" {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f, err := w.Create(filepath.ToSlash(name))
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		filename string
+		data     []byte
+		parser   string
+	}{
+		{"book.epub", readFixture(t, "epub.epub"), "epub"},
+		{"book.pdf", readFixture(t, "book.pdf"), "pdf"},
+		// PDFs are recognized by their content whatever the file is called
+		{"download", readFixture(t, "book.pdf"), "pdf"},
+		{"book.html", readFixture(t, "book.html"), "html"},
+		{"book.xhtml", readFixture(t, "book.html"), "html"},
+		{"book.md", readFixture(t, "book.md"), "markdown"},
+		{"book.markdown", readFixture(t, "book.md"), "markdown"},
+		{"book.txt", readFixture(t, "book.txt"), "text"},
+		{"README", readFixture(t, "book.txt"), "text"},
+		{"cover.png", readFixture(t, "epub/OEBPS/images/cover.png"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			parser, err := Detect(NewSource(tt.filename, tt.data))
+			if tt.parser == "" {
+				if !errors.Is(err, ErrUnsupportedFormat) {
+					t.Fatalf("expected ErrUnsupportedFormat, got %v (%v)", err, parser)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parser.Name() != tt.parser {
+				t.Fatalf("expected the %s parser, got %s", tt.parser, parser.Name())
+			}
+		})
+	}
+}
+
+type testParser struct{}
+
+func (p *testParser) Name() string { return "test" }
+
+func (p *testParser) Detect(src *Source) bool { return src.Ext() == ".test" }
+
+func (p *testParser) Parse(src *Source) (*Book, error) {
+	return &Book{Chapters: []Chapter{{Title: "Only", Order: 1, HasToc: true, Content: "<p onclick=\"x()\">text</p>"}}}, nil
+}
+
+func TestRegister(t *testing.T) {
+	registered := parsers
+	t.Cleanup(func() { parsers = registered })
+
+	Register(&testParser{})
+
+	book, err := Parse(NewSource("book.test", []byte{0x01, 0x02}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.Chapters[0].Content != "<p>text</p>" {
+		t.Fatalf("expected registered parsers' chapters to be sanitized, got %q", book.Chapters[0].Content)
+	}
+	if len(book.Toc) != 1 || book.Toc[0].Label != "Only" {
+		t.Fatalf("expected a table of contents from the chapter titles, got %+v", book.Toc)
+	}
+
+	// registered parsers come after the built-in ones
+	parser, err := Detect(NewSource("book.txt", []byte("text")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parser.Name() != "text" {
+		t.Fatalf("expected the text parser, got %s", parser.Name())
+	}
+}
+
+func TestParseNoChapters(t *testing.T) {
+	_, err := Parse(NewSource("empty.txt", []byte("\n\n")))
+	if !errors.Is(err, ErrNoChapters) {
+		t.Fatalf("expected ErrNoChapters, got %v", err)
+	}
+}
+
+type expectedChapter struct {
+	title  string
+	hasToc bool
+	// text the sanitized content has and doesn't have
+	contains []string
+	excludes []string
+	// what the sanitizer removed, as element, attribute or URL scheme names
+	sanitized []string
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		title    string
+		author   string
+		date     string
+		toc      []string
+		chapters []expectedChapter
+	}{
+		{
+			fixture: "epub.epub",
+			title:   "The Keeper's Log",
+			author:  "Ada Marsh",
+			toc:     []string{"One: Arrival", "  The First Night"},
+			chapters: []expectedChapter{
+				{
+					// a cover wrapped in an <svg> keeps its image
+					title:     "Section 1",
+					contains:  []string{`viewBox="0 0 600 800"`, `<image width="600" height="800" xlink:href="OEBPS/images/cover.png">`},
+					excludes:  []string{`version=`},
+					sanitized: []string{"version"},
+				},
+				{
+					title:     "One: Arrival",
+					hasToc:    true,
+					contains:  []string{`<h2 id="night">The First Night</h2>`, `<p>The lamp would not light.</p>`},
+					excludes:  []string{`style=`},
+					sanitized: []string{"style"},
+				},
+				{
+					// chapters outside the table of contents are named by their heading
+					title:    "Departure",
+					contains: []string{`<p>He rowed back in spring.</p>`},
+				},
+			},
+		},
+		{
+			fixture: "book.pdf",
+			title:   "The Keeper's Almanac",
+			author:  "Ada Marsh",
+			date:    "2001-03-04",
+			toc:     []string{"Part One", "Part Two"},
+			chapters: []expectedChapter{
+				{title: "Front Matter", contains: []string{"<p>Front page</p>"}},
+				{title: "Part One", hasToc: true, contains: []string{"<h1>Part One</h1>", "The keeper kept the light."}},
+				{title: "Part Two", hasToc: true, contains: []string{"<h1>Part Two</h1>", "The light kept the keeper."}},
+			},
+		},
+		{
+			// an outline whose last entry points back at the first is ignored
+			fixture: "cyclic-outline.pdf",
+			title:   "The Endless Outline",
+			author:  "Ada Marsh",
+			chapters: []expectedChapter{
+				{title: "Pages 1-3", contains: []string{"<p>Front page</p>", "The keeper kept the light.", "The light kept the keeper."}},
+			},
+		},
+		{
+			// the single <h1> names the book and the chapters are split on <h2>
+			fixture: "book.html",
+			title:   "The Lighthouse Keeper",
+			author:  "Ada Marsh",
+			toc:     []string{"The Storm", "The Calm"},
+			chapters: []expectedChapter{
+				{
+					title:     "The Storm",
+					hasToc:    true,
+					contains:  []string{"<p>The wind came in from the sea.</p>"},
+					excludes:  []string{"<script", "onclick"},
+					sanitized: []string{"script", "onclick"},
+				},
+				{
+					title:     "The Calm",
+					hasToc:    true,
+					contains:  []string{"<a>still</a>"},
+					excludes:  []string{"javascript:"},
+					sanitized: []string{"javascript"},
+				},
+			},
+		},
+		{
+			fixture: "book.md",
+			toc:     []string{"First Light", "Second Watch"},
+			chapters: []expectedChapter{
+				{title: "First Light", hasToc: true, contains: []string{"<h1>First Light</h1>", "<p>The keeper woke before dawn.</p>"}},
+				{
+					title:     "Second Watch",
+					hasToc:    true,
+					contains:  []string{"<p>He climbed the stairs again.</p>"},
+					excludes:  []string{"<iframe"},
+					sanitized: []string{"iframe"},
+				},
+			},
+		},
+		{
+			// the Project Gutenberg header is metadata and headings are
+			// joined with their subtitles
+			fixture: "book.txt",
+			title:   "The Tide Tables",
+			author:  "Ada Marsh",
+			date:    "2001-03-04",
+			toc:     []string{"CHAPTER I. The Ebb", "CHAPTER II. The Flood"},
+			chapters: []expectedChapter{
+				{title: "CHAPTER I. The Ebb", hasToc: true, contains: []string{"<p>The water drew back from the rocks.</p>"}, excludes: []string{"Release Date", "PROJECT GUTENBERG"}},
+				{title: "CHAPTER II. The Flood", hasToc: true, contains: []string{"&lt;higher&gt;"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			book, err := Parse(NewSource(tt.fixture, readFixture(t, tt.fixture)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if book.Title != tt.title {
+				t.Errorf("expected title %q, got %q", tt.title, book.Title)
+			}
+			if book.Author != tt.author {
+				t.Errorf("expected author %q, got %q", tt.author, book.Author)
+			}
+			if book.Date != tt.date {
+				t.Errorf("expected date %q, got %q", tt.date, book.Date)
+			}
+
+			if toc := tocLabels(book.Toc, ""); strings.Join(toc, "|") != strings.Join(tt.toc, "|") {
+				t.Errorf("expected table of contents %q, got %q", tt.toc, toc)
+			}
+
+			if len(book.Chapters) != len(tt.chapters) {
+				t.Fatalf("expected %d chapters, got %d", len(tt.chapters), len(book.Chapters))
+			}
+			for i, expected := range tt.chapters {
+				chapter := book.Chapters[i]
+
+				if chapter.Order != i+1 {
+					t.Errorf("chapter %d: expected order %d, got %d", i, i+1, chapter.Order)
+				}
+				if chapter.Title != expected.title {
+					t.Errorf("chapter %d: expected title %q, got %q", i, expected.title, chapter.Title)
+				}
+				if chapter.HasToc != expected.hasToc {
+					t.Errorf("chapter %d: expected HasToc %v, got %v", i, expected.hasToc, chapter.HasToc)
+				}
+				for _, s := range expected.contains {
+					if !strings.Contains(chapter.Content, s) {
+						t.Errorf("chapter %d: expected the content to contain %q, got %s", i, s, chapter.Content)
+					}
+				}
+				for _, s := range expected.excludes {
+					if strings.Contains(chapter.Content, s) {
+						t.Errorf("chapter %d: expected the content not to contain %q, got %s", i, s, chapter.Content)
+					}
+				}
+
+				removed := reportNames(chapter.Sanitized)
+				if strings.Join(removed, "|") != strings.Join(expected.sanitized, "|") {
+					t.Errorf("chapter %d: expected %q to be removed, got %q", i, expected.sanitized, removed)
+				}
+			}
+		})
+	}
+}
+
+func TestParseEpubAssets(t *testing.T) {
+	book, err := Parse(NewSource("book.epub", readFixture(t, "epub.epub")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(book.Assets) != 1 {
+		t.Fatalf("expected 1 asset, got %d", len(book.Assets))
+	}
+	cover := book.Assets[0]
+	if cover.Href != "OEBPS/images/cover.png" || cover.MediaType != "image/png" || !cover.IsCover {
+		t.Fatalf("expected the cover image, got %s %s %v", cover.Href, cover.MediaType, cover.IsCover)
+	}
+
+	// the stored content points the cover's <image> at the saved asset
+	content := RewriteAssetURLs(book.Chapters[0].Content, map[string]string{cover.Href: "/api/files/assets/abc/cover.png"})
+	content, report := SanitizeChapter(content)
+	if !strings.Contains(content, `xlink:href="/api/files/assets/abc/cover.png"`) {
+		t.Fatalf("expected the cover to point at the asset, got %s", content)
+	}
+	if !report.Empty() {
+		t.Fatalf("expected nothing more to be removed, got %+v", report)
+	}
+}
+
+// tocLabels lists the labels of the entries, with children indented.
+func tocLabels(entries []TocEntry, indent string) []string {
+	var labels []string
+	for _, entry := range entries {
+		labels = append(labels, indent+entry.Label)
+		labels = append(labels, tocLabels(entry.Children, indent+"  ")...)
+	}
+	return labels
+}
+
+func reportNames(report SanitizeReport) []string {
+	var names []string
+	for _, counts := range []map[string]int{report.Elements, report.Attributes, report.URLs} {
+		keys := make([]string, 0, len(counts))
+		for name := range counts {
+			keys = append(keys, name)
+		}
+		sort.Strings(keys)
+		names = append(names, keys...)
+	}
+	return names
+}
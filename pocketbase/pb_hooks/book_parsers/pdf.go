@@ -0,0 +1,289 @@
+package book_parsers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+const pdfPagesPerChapter = 10
+
+// the most top-level outline entries read, so that a long /Next chain can't
+// keep an import busy
+const pdfMaxOutlineEntries = 10000
+
+var pdfMagic = []byte("%PDF-")
+
+type PDFParser struct{}
+
+type pdfOutlineEntry struct {
+	Title string
+	Page  int
+}
+
+func (p *PDFParser) Name() string {
+	return "pdf"
+}
+
+func (p *PDFParser) Detect(src *Source) bool {
+	return src.HasMimeType("application/pdf") || bytes.HasPrefix(bytes.TrimLeft(src.Data, "\x00\t\r\n "), pdfMagic)
+}
+
+func (p *PDFParser) Parse(src *Source) (book *Book, err error) {
+	data := src.Data
+
+	// the pdf reader panics on malformed objects instead of returning errors
+	defer func() {
+		if r := recover(); r != nil {
+			book = nil
+			err = fmt.Errorf("failed to parse pdf: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	numPages := reader.NumPage()
+	if numPages == 0 {
+		return nil, errors.New("pdf has no pages")
+	}
+
+	pages := make([]string, numPages)
+	fonts := make(map[string]*pdf.Font)
+	hasText := false
+	for i := 1; i <= numPages; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				f := page.Font(name)
+				fonts[name] = &f
+			}
+		}
+
+		text, err := page.GetPlainText(fonts)
+		if err != nil {
+			continue
+		}
+
+		pages[i-1] = text
+		if strings.TrimSpace(text) != "" {
+			hasText = true
+		}
+	}
+
+	if !hasText {
+		return nil, errors.New("pdf contains no extractable text")
+	}
+
+	info := reader.Trailer().Key("Info")
+	book = &Book{
+		Title:       strings.TrimSpace(info.Key("Title").Text()),
+		Author:      strings.TrimSpace(info.Key("Author").Text()),
+		Description: strings.TrimSpace(info.Key("Subject").Text()),
+		Subject:     strings.TrimSpace(info.Key("Keywords").Text()),
+		Date:        parsePDFDate(info.Key("CreationDate").Text()),
+	}
+
+	outline := pdfOutline(reader, pages)
+	if len(outline) > 0 {
+		book.Chapters = pdfChaptersFromOutline(outline, pages)
+	} else {
+		book.Chapters = pdfChaptersFromPageRanges(pages)
+	}
+
+	return book, nil
+}
+
+// pdfOutline resolves the top-level outline entries to page numbers, either
+// through their explicit destination or by searching for the title text. An
+// outline whose /Next chain loops back on itself is ignored, so the book is
+// split into page ranges instead.
+func pdfOutline(reader *pdf.Reader, pages []string) []pdfOutlineEntry {
+	pageNumbers := make(map[string]int, len(pages))
+	for i := 1; i <= len(pages); i++ {
+		page := reader.Page(i)
+		if !page.V.IsNull() {
+			pageNumbers[page.V.String()] = i
+		}
+	}
+
+	var entries []pdfOutlineEntry
+	lastPage := 1
+	root := reader.Trailer().Key("Root").Key("Outlines")
+	// a dictionary prints the references it holds rather than following them,
+	// so an entry seen twice prints the same
+	visited := make(map[string]bool)
+	for item := root.Key("First"); item.Kind() == pdf.Dict; item = item.Key("Next") {
+		key := item.String()
+		if visited[key] || len(visited) >= pdfMaxOutlineEntries {
+			return nil
+		}
+		visited[key] = true
+
+		title := strings.TrimSpace(item.Key("Title").Text())
+		if title == "" {
+			continue
+		}
+
+		dest := item.Key("Dest")
+		if dest.IsNull() && item.Key("A").Key("S").Name() == "GoTo" {
+			dest = item.Key("A").Key("D")
+		}
+
+		page := 0
+		if dest.Kind() == pdf.Array {
+			page = pageNumbers[dest.Index(0).String()]
+		}
+		if page == 0 {
+			page = findPDFPageWithText(pages, title, lastPage)
+		}
+		if page == 0 || page < lastPage {
+			continue
+		}
+
+		entries = append(entries, pdfOutlineEntry{Title: title, Page: page})
+		lastPage = page
+	}
+
+	return entries
+}
+
+func findPDFPageWithText(pages []string, text string, from int) int {
+	needle := strings.ToLower(strings.Join(strings.Fields(text), " "))
+	for i := from; i <= len(pages); i++ {
+		haystack := strings.ToLower(strings.Join(strings.Fields(pages[i-1]), " "))
+		if strings.Contains(haystack, needle) {
+			return i
+		}
+	}
+	return 0
+}
+
+func pdfChaptersFromOutline(outline []pdfOutlineEntry, pages []string) []Chapter {
+	var chapters []Chapter
+
+	// pages before the first outline entry (cover, front matter) become their own chapter
+	if outline[0].Page > 1 {
+		chapters = append(chapters, newPDFChapter("Front Matter", len(chapters)+1, 1, outline[0].Page-1, pages, false))
+	}
+
+	for i, entry := range outline {
+		end := len(pages)
+		if i+1 < len(outline) {
+			end = outline[i+1].Page - 1
+		}
+		if end < entry.Page {
+			end = entry.Page
+		}
+		chapters = append(chapters, newPDFChapter(entry.Title, len(chapters)+1, entry.Page, end, pages, true))
+	}
+
+	return chapters
+}
+
+func pdfChaptersFromPageRanges(pages []string) []Chapter {
+	var chapters []Chapter
+	for start := 1; start <= len(pages); start += pdfPagesPerChapter {
+		end := min(start+pdfPagesPerChapter-1, len(pages))
+		title := fmt.Sprintf("Pages %d-%d", start, end)
+		if start == end {
+			title = fmt.Sprintf("Page %d", start)
+		}
+		chapters = append(chapters, newPDFChapter(title, len(chapters)+1, start, end, pages, false))
+	}
+	return chapters
+}
+
+func newPDFChapter(title string, order, start, end int, pages []string, hasToc bool) Chapter {
+	return Chapter{
+		Title:   title,
+		Order:   order,
+		Href:    fmt.Sprintf("page-%d", start),
+		HasToc:  hasToc,
+		Content: pdfPagesToHTML(title, pages[start-1:end]),
+	}
+}
+
+func pdfPagesToHTML(title string, pages []string) string {
+	var b strings.Builder
+	b.WriteString("<h1>" + html.EscapeString(title) + "</h1>")
+
+	for _, page := range pages {
+		for _, paragraph := range pdfParagraphs(page) {
+			b.WriteString("<p>" + html.EscapeString(paragraph) + "</p>")
+		}
+	}
+
+	return chapterDocument(title, b.String())
+}
+
+// pdfParagraphs joins the visual lines of a page back into paragraphs. A line
+// ends a paragraph when it is blank, or noticeably shorter than the longest
+// line on the page and ends with terminal punctuation.
+func pdfParagraphs(page string) []string {
+	lines := strings.Split(page, "\n")
+	longest := 0
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+		longest = max(longest, len(lines[i]))
+	}
+
+	var paragraphs []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			paragraphs = append(paragraphs, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, line := range lines {
+		if line == "" {
+			flush()
+			continue
+		}
+
+		if current.Len() > 0 {
+			text := current.String()
+			if strings.HasSuffix(text, "-") {
+				current.Reset()
+				current.WriteString(strings.TrimSuffix(text, "-"))
+			} else {
+				current.WriteString(" ")
+			}
+		}
+		current.WriteString(line)
+
+		if len(line)*4 < longest*3 && strings.ContainsAny(line[len(line)-1:], ".!?:\"'") {
+			flush()
+		}
+	}
+	flush()
+
+	return paragraphs
+}
+
+// parsePDFDate converts a PDF date string (D:YYYYMMDDHHmmSS...) to YYYY-MM-DD.
+func parsePDFDate(value string) string {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "D:")
+	for _, layout := range []string{"20060102150405", "200601021504", "20060102", "200601", "2006"} {
+		if len(value) < len(layout) {
+			continue
+		}
+		if t, err := time.Parse(layout, value[:len(layout)]); err == nil {
+			return t.Format(time.DateOnly)
+		}
+	}
+	return ""
+}
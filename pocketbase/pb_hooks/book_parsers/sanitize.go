@@ -0,0 +1,231 @@
+package book_parsers
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// SanitizeReport counts what the sanitizer removed from a chapter: elements by
+// tag, attributes by name and URLs by scheme.
+type SanitizeReport struct {
+	Elements   map[string]int `json:"elements,omitempty"`
+	Attributes map[string]int `json:"attributes,omitempty"`
+	URLs       map[string]int `json:"urls,omitempty"`
+}
+
+func (r *SanitizeReport) Empty() bool {
+	return len(r.Elements) == 0 && len(r.Attributes) == 0 && len(r.URLs) == 0
+}
+
+// Merge adds the counts of other to the report.
+func (r *SanitizeReport) Merge(other SanitizeReport) {
+	for tag, n := range other.Elements {
+		r.Elements = increment(r.Elements, tag, n)
+	}
+	for name, n := range other.Attributes {
+		r.Attributes = increment(r.Attributes, name, n)
+	}
+	for scheme, n := range other.URLs {
+		r.URLs = increment(r.URLs, scheme, n)
+	}
+}
+
+func increment(counts map[string]int, key string, n int) map[string]int {
+	if counts == nil {
+		counts = make(map[string]int)
+	}
+	counts[key] += n
+	return counts
+}
+
+// elements that are kept, with their allowed attributes on top of
+// globalAttributes
+var allowedElements = map[string][]string{
+	"html": {"xmlns", "xmlns:epub", "xmlns:xlink"}, "head": nil, "title": nil, "body": nil, "meta": {"charset"},
+	"p": nil, "div": nil, "span": nil, "br": nil, "hr": nil, "center": nil,
+	"section": nil, "article": nil, "aside": nil, "header": nil, "footer": nil, "nav": nil, "main": nil, "address": nil,
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil, "hgroup": nil,
+	"figure": nil, "figcaption": nil, "img": {"src", "alt", "width", "height"},
+	"blockquote": {"cite"}, "q": {"cite"}, "pre": nil, "code": nil,
+	"ul": nil, "ol": {"start", "reversed", "type"}, "li": {"value"}, "dl": nil, "dt": nil, "dd": nil,
+	"table": nil, "caption": nil, "thead": nil, "tbody": nil, "tfoot": nil, "tr": nil,
+	"th": {"colspan", "rowspan", "headers", "scope", "abbr"}, "td": {"colspan", "rowspan", "headers"},
+	"colgroup": {"span"}, "col": {"span"},
+	"a":  {"href", "rel", "hreflang"},
+	"em": nil, "strong": nil, "b": nil, "i": nil, "u": nil, "s": nil, "strike": nil, "small": nil, "big": nil,
+	"sub": nil, "sup": nil, "mark": nil, "abbr": nil, "cite": nil, "dfn": nil, "kbd": nil, "samp": nil, "var": nil,
+	"del": {"cite", "datetime"}, "ins": {"cite", "datetime"}, "time": {"datetime"},
+	"ruby": nil, "rb": nil, "rt": nil, "rp": nil, "bdi": nil, "bdo": nil, "wbr": nil,
+	"details": nil, "summary": nil,
+}
+
+// SVG elements that are kept, which is only what a cover wrapped in an <svg>
+// needs. Other SVG and MathML elements are removed with their content.
+var allowedSVGElements = map[string][]string{
+	"svg":   {"xmlns", "xmlns:xlink", "width", "height", "viewbox", "preserveaspectratio"},
+	"image": {"width", "height", "preserveaspectratio", "href", "xlink:href"},
+}
+
+// elements that are removed together with their content. Any other element
+// not in allowedElements is unwrapped, keeping its content.
+var droppedElements = map[string]bool{
+	"script": true, "noscript": true, "template": true, "style": true, "link": true, "base": true,
+	"iframe": true, "frame": true, "frameset": true, "object": true, "embed": true, "applet": true, "param": true,
+	"math": true, "canvas": true, "audio": true, "video": true, "source": true, "track": true,
+	"input": true, "button": true, "select": true, "textarea": true,
+}
+
+var globalAttributes = []string{"id", "class", "title", "lang", "dir", "xml:lang", "epub:type"}
+
+// URL schemes allowed in each URL attribute; relative URLs are always allowed
+var allowedSchemes = map[string][]string{
+	"href": {"http", "https", "mailto"},
+	"src":  {"http", "https", "data"},
+	"cite": {"http", "https"},
+}
+
+// SanitizeChapter removes everything from chapter HTML that isn't on the
+// allowlist: scripts, embedded content, event handlers, inline styles and
+// javascript: or other unsafe URLs. Full documents keep their document shape,
+// anything else is sanitized as a body fragment.
+func SanitizeChapter(content string) (string, SanitizeReport) {
+	var report SanitizeReport
+
+	trimmed := strings.ToLower(strings.TrimSpace(content))
+	isDocument := strings.HasPrefix(trimmed, "<!doctype") || strings.HasPrefix(trimmed, "<?xml") || strings.HasPrefix(trimmed, "<html")
+
+	var buf bytes.Buffer
+	if isDocument {
+		// parsing only fails on read errors, which a strings.Reader never returns
+		doc, _ := html.Parse(strings.NewReader(content))
+		sanitizeNode(doc, &report)
+		html.Render(&buf, doc)
+		return buf.String(), report
+	}
+
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, _ := html.ParseFragment(strings.NewReader(content), body)
+	for _, node := range nodes {
+		body.AppendChild(node)
+	}
+	sanitizeNode(body, &report)
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		html.Render(&buf, c)
+	}
+
+	return buf.String(), report
+}
+
+func sanitizeNode(n *html.Node, report *SanitizeReport) {
+	var next *html.Node
+	for c := n.FirstChild; c != nil; c = next {
+		next = c.NextSibling
+
+		switch c.Type {
+		case html.CommentNode:
+			n.RemoveChild(c)
+		case html.ElementNode:
+			tag := strings.ToLower(c.Data)
+			allowedAttributes, allowed := allowedElements[tag]
+			if c.Namespace == "svg" {
+				allowedAttributes, allowed = allowedSVGElements[tag]
+			}
+
+			switch {
+			case droppedElements[tag] || c.Namespace != "" && !allowed:
+				n.RemoveChild(c)
+				report.Elements = increment(report.Elements, tag, 1)
+			case !allowed:
+				sanitizeNode(c, report)
+				for c.FirstChild != nil {
+					child := c.FirstChild
+					c.RemoveChild(child)
+					n.InsertBefore(child, c)
+				}
+				n.RemoveChild(c)
+				report.Elements = increment(report.Elements, tag, 1)
+			default:
+				c.Attr = sanitizeAttributes(c, allowedAttributes, report)
+				sanitizeNode(c, report)
+			}
+		}
+	}
+}
+
+func sanitizeAttributes(n *html.Node, allowedAttributes []string, report *SanitizeReport) []html.Attribute {
+	kept := n.Attr[:0]
+	for _, a := range n.Attr {
+		name := strings.ToLower(a.Key)
+		if a.Namespace != "" {
+			name = strings.ToLower(a.Namespace) + ":" + name
+		}
+
+		if !slices.Contains(globalAttributes, name) && !slices.Contains(allowedAttributes, name) {
+			report.Attributes = increment(report.Attributes, name, 1)
+			continue
+		}
+
+		schemes, ok := allowedSchemes[name]
+		if n.Namespace == "svg" && (name == "href" || name == "xlink:href") {
+			// the source of an SVG <image> is checked like that of an <img>
+			schemes, ok = allowedSchemes["src"], true
+		}
+		if ok {
+			if scheme, safe := safeURL(a.Val, schemes); !safe {
+				report.URLs = increment(report.URLs, scheme, 1)
+				continue
+			}
+		}
+
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// safeURL reports whether the URL is relative or uses one of the schemes.
+// Browsers ignore whitespace and control characters inside a scheme, so they
+// are removed before it is read. data: URLs are only allowed for raster images.
+func safeURL(value string, schemes []string) (string, bool) {
+	url := strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value))
+
+	i := strings.IndexAny(url, ":/?#")
+	if i < 0 || url[i] != ':' {
+		return "", true
+	}
+
+	scheme := url[:i]
+	if !slices.Contains(schemes, scheme) {
+		return scheme, false
+	}
+	if scheme == "data" {
+		for _, mediaType := range []string{"image/png", "image/jpeg", "image/gif", "image/webp"} {
+			if strings.HasPrefix(url, "data:"+mediaType+";") || strings.HasPrefix(url, "data:"+mediaType+",") {
+				return scheme, true
+			}
+		}
+		return scheme, false
+	}
+
+	return scheme, true
+}
+
+// chapterDocument wraps a chapter body in the same document shape the EPUB
+// importer stores, so the reader and chapter_hooks treat every format alike.
+func chapterDocument(title, body string) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html><html><head><title>")
+	b.WriteString(html.EscapeString(title))
+	b.WriteString("</title></head><body>")
+	b.WriteString(body)
+	b.WriteString("</body></html>")
+	return b.String()
+}
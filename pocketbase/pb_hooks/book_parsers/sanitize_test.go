@@ -0,0 +1,105 @@
+package book_parsers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeChapter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		removed []string
+	}{
+		{
+			name:    "allowed markup",
+			content: `<h1 id="top">Title</h1><p class="x">A <em>b</em> <a href="https://example.com">c</a></p>`,
+			want:    `<h1 id="top">Title</h1><p class="x">A <em>b</em> <a href="https://example.com">c</a></p>`,
+		},
+		{
+			name:    "scripts and handlers",
+			content: `<p onclick="x()">a</p><script>alert(1)</script><style>p{}</style>`,
+			want:    `<p>a</p>`,
+			removed: []string{"script", "style", "onclick"},
+		},
+		{
+			name:    "unknown elements are unwrapped",
+			content: `<p><font color="red">red</font></p>`,
+			want:    `<p>red</p>`,
+			removed: []string{"font"},
+		},
+		{
+			name:    "unsafe URLs",
+			content: `<a href=" java&#x09;script:alert(1)">a</a><img src="data:text/html,x"><img src="data:image/png;base64,AA">`,
+			want:    `<a>a</a><img/><img src="data:image/png;base64,AA"/>`,
+			removed: []string{"data", "javascript"},
+		},
+		{
+			name:    "comments",
+			content: `<p>a<!-- b --></p>`,
+			want:    `<p>a</p>`,
+		},
+		{
+			name:    "svg cover",
+			content: `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 600 800" preserveAspectRatio="xMidYMid meet"><image width="600" height="800" xlink:href="/api/files/a/b/cover.jpg"/></svg>`,
+			want:    `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 600 800" preserveAspectRatio="xMidYMid meet"><image width="600" height="800" xlink:href="/api/files/a/b/cover.jpg"></image></svg>`,
+		},
+		{
+			name:    "svg image href",
+			content: `<svg><image href="cover.jpg"/></svg>`,
+			want:    `<svg><image href="cover.jpg"></image></svg>`,
+		},
+		{
+			name:    "svg image sources are checked like img",
+			content: `<svg><image href="javascript:alert(1)"/><image xlink:href="data:image/svg+xml,x"/><image href="mailto:a@b.c"/></svg>`,
+			want:    `<svg><image></image><image></image><image></image></svg>`,
+			removed: []string{"data", "javascript", "mailto"},
+		},
+		{
+			name:    "other svg content",
+			content: `<svg onload="x()"><script>alert(1)</script><a href="https://example.com"><text>a</text></a><foreignObject><p>b</p></foreignObject></svg>`,
+			want:    `<svg></svg>`,
+			removed: []string{"a", "foreignobject", "script", "onload"},
+		},
+		{
+			name:    "math",
+			content: `<p>x</p><math><mi>x</mi></math>`,
+			want:    `<p>x</p>`,
+			removed: []string{"math"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, report := SanitizeChapter(tt.content)
+			if got != tt.want {
+				t.Fatalf("expected\n%s\ngot\n%s", tt.want, got)
+			}
+
+			removed := reportNames(report)
+			if strings.Join(removed, "|") != strings.Join(tt.removed, "|") {
+				t.Fatalf("expected %q to be removed, got %q", tt.removed, removed)
+			}
+
+			// sanitized content is left as it is
+			again, report := SanitizeChapter(got)
+			if again != got || !report.Empty() {
+				t.Fatalf("expected sanitizing again to change nothing, got %s %+v", again, report)
+			}
+		})
+	}
+}
+
+func TestSanitizeChapterDocument(t *testing.T) {
+	content := `<!DOCTYPE html><html xmlns="http://www.w3.org/1999/xhtml" xmlns:xlink="http://www.w3.org/1999/xlink"><head><title>T</title><link rel="stylesheet" href="a.css"/></head><body><p>a</p></body></html>`
+
+	got, report := SanitizeChapter(content)
+	want := `<!DOCTYPE html><html xmlns="http://www.w3.org/1999/xhtml" xmlns:xlink="http://www.w3.org/1999/xlink"><head><title>T</title></head><body><p>a</p></body></html>`
+	if got != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+	if removed := reportNames(report); strings.Join(removed, "|") != "link" {
+		t.Fatalf("expected the stylesheet link to be removed, got %q", removed)
+	}
+}
@@ -0,0 +1,187 @@
+package book_parsers
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+const textParagraphsPerSection = 100
+
+var (
+	numberWords = `one|two|three|four|five|six|seven|eight|nine|ten|eleven|twelve|thirteen|fourteen|fifteen|sixteen|seventeen|eighteen|nineteen|twenty|thirty|forty|fifty|sixty|seventy|eighty|ninety|hundred`
+
+	// e.g. "CHAPTER IV", "Chapter 12. The Storm", "BOOK TWO", "Part Twenty-One"
+	textHeadingRegex = regexp.MustCompile(`^(?i:chapter|book|part|letter|stave|canto)\s+([0-9]+|[IVXLCDM]+|(?i:(` + numberWords + `)(-(` + numberWords + `))?))\b[.:]?(\s.*)?$`)
+	textSectionRegex = regexp.MustCompile(`(?i)^(prologue|epilogue|preface|foreword|introduction|afterword|conclusion)[.:]?$`)
+	textMetaRegex    = regexp.MustCompile(`^(Title|Author|Language|Release Date):\s*(.+)$`)
+)
+
+type TextParser struct{}
+
+func (p *TextParser) Name() string {
+	return "text"
+}
+
+func (p *TextParser) Detect(src *Source) bool {
+	return src.Ext() == ".txt" || src.HasMimeType("text/plain")
+}
+
+func (p *TextParser) Parse(src *Source) (*Book, error) {
+	text := normalizeText(src.Data)
+	book := &Book{}
+
+	// Project Gutenberg texts carry their metadata and license outside of these markers
+	lines := strings.Split(text, "\n")
+	start, end := 0, len(lines)
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "*** START OF") {
+			start = i + 1
+		} else if strings.HasPrefix(line, "*** END OF") {
+			end = i
+			break
+		}
+	}
+
+	for _, line := range lines[:start] {
+		matches := textMetaRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+		switch matches[1] {
+		case "Title":
+			book.Title = matches[2]
+		case "Author":
+			book.Author = matches[2]
+		case "Language":
+			book.Language = matches[2]
+		case "Release Date":
+			date := strings.TrimSpace(strings.Split(matches[2], "[")[0])
+			if t, err := time.Parse("January 2, 2006", date); err == nil {
+				book.Date = t.Format(time.DateOnly)
+			}
+		}
+	}
+
+	sections := textSections(textParagraphs(lines[start:end]))
+	for i, section := range sections {
+		var b strings.Builder
+		if section.title != "" {
+			b.WriteString("<h2>" + html.EscapeString(section.title) + "</h2>")
+		}
+		for _, paragraph := range section.paragraphs {
+			b.WriteString("<p>" + html.EscapeString(paragraph) + "</p>")
+		}
+
+		title := section.title
+		if title == "" {
+			title = fmt.Sprintf("Section %d", i+1)
+		}
+
+		book.Chapters = append(book.Chapters, Chapter{
+			Title:   title,
+			Order:   i + 1,
+			Href:    fmt.Sprintf("section-%d", i+1),
+			HasToc:  section.title != "",
+			Content: chapterDocument(title, b.String()),
+		})
+	}
+
+	return book, nil
+}
+
+type textSection struct {
+	title      string
+	paragraphs []string
+}
+
+// textParagraphs joins runs of non-blank lines into single paragraphs.
+func textParagraphs(lines []string) []string {
+	var paragraphs []string
+	var current []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if len(current) > 0 {
+				paragraphs = append(paragraphs, strings.Join(current, " "))
+				current = nil
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		paragraphs = append(paragraphs, strings.Join(current, " "))
+	}
+	return paragraphs
+}
+
+// textSections groups paragraphs under heading-like paragraphs. Texts without
+// recognizable headings are split into fixed-size sections instead.
+func textSections(paragraphs []string) []textSection {
+	sections := []textSection{{}}
+	headings := 0
+	for i := 0; i < len(paragraphs); i++ {
+		paragraph := paragraphs[i]
+		if isTextHeading(paragraph) {
+			// a short line right after the heading is its subtitle, e.g. "CHAPTER I" / "Down the Rabbit-Hole"
+			if i+1 < len(paragraphs) && isTextSubtitle(paragraphs[i+1]) {
+				paragraph = strings.TrimRight(paragraph, ".:") + ". " + paragraphs[i+1]
+				i++
+			}
+			sections = append(sections, textSection{title: paragraph})
+			headings++
+			continue
+		}
+		sections[len(sections)-1].paragraphs = append(sections[len(sections)-1].paragraphs, paragraph)
+	}
+
+	if headings == 0 {
+		sections = nil
+		for start := 0; start < len(paragraphs); start += textParagraphsPerSection {
+			end := min(start+textParagraphsPerSection, len(paragraphs))
+			sections = append(sections, textSection{paragraphs: paragraphs[start:end]})
+		}
+		return sections
+	}
+
+	// text before the first heading is usually a title page or table of contents,
+	// and headings without text are table of contents entries
+	sections[0].title = "Front Matter"
+	var result []textSection
+	for _, section := range sections {
+		if len(section.paragraphs) > 0 {
+			result = append(result, section)
+		}
+	}
+	return result
+}
+
+func isTextHeading(paragraph string) bool {
+	return len(paragraph) <= 80 && (textHeadingRegex.MatchString(paragraph) || textSectionRegex.MatchString(paragraph))
+}
+
+func isTextSubtitle(paragraph string) bool {
+	return len(paragraph) <= 60 && !isTextHeading(paragraph) && !strings.ContainsAny(paragraph[len(paragraph)-1:], ".!?,;\"'")
+}
+
+// normalizeText decodes the data as UTF-8, falling back to Windows-1252 for
+// older texts, and normalizes line endings.
+func normalizeText(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		if decoded, err := charmap.Windows1252.NewDecoder().Bytes(data); err == nil {
+			data = decoded
+		}
+	}
+
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
@@ -0,0 +1,230 @@
+package book_parsers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// TocEntry is an entry of the book's table of contents. Chapter is the index
+// in Book.Chapters of the chapter it points to, or -1 for entries that only
+// group other entries.
+type TocEntry struct {
+	Label    string
+	Href     string
+	Fragment string
+	Chapter  int
+	Children []TocEntry
+}
+
+type ncxDocument struct {
+	NavPoints []ncxNavPoint `xml:"navMap>navPoint"`
+}
+
+type ncxNavPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	NavPoints []ncxNavPoint `xml:"navPoint"`
+}
+
+// toc reads the table of contents from the EPUB 3 navigation document, or
+// from the NCX file of EPUB 2. Hrefs are paths inside the archive.
+func (a *epubArchive) toc() []TocEntry {
+	for _, item := range a.opf.Manifest.Items {
+		if !hasProperty(item.Properties, "nav") {
+			continue
+		}
+		navPath := a.manifestPath(item)
+		raw, err := a.readFile(navPath)
+		if err != nil {
+			break
+		}
+		if entries := parseNavDocument(raw, navPath); len(entries) > 0 {
+			return entries
+		}
+		break
+	}
+
+	for _, item := range a.opf.Manifest.Items {
+		if item.ID != a.opf.Spine.Toc && item.MediaType != "application/x-dtbncx+xml" {
+			continue
+		}
+		ncxPath := a.manifestPath(item)
+		raw, err := a.readFile(ncxPath)
+		if err != nil {
+			return nil
+		}
+
+		var ncx ncxDocument
+		if err := xml.Unmarshal(raw, &ncx); err != nil {
+			return nil
+		}
+		return ncxEntries(ncx.NavPoints, ncxPath)
+	}
+
+	return nil
+}
+
+func ncxEntries(navPoints []ncxNavPoint, ncxPath string) []TocEntry {
+	entries := make([]TocEntry, 0, len(navPoints))
+	for _, navPoint := range navPoints {
+		entry := newTocEntry(navPoint.Label, navPoint.Content.Src, ncxPath)
+		entry.Children = ncxEntries(navPoint.NavPoints, ncxPath)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// parseNavDocument reads the <nav epub:type="toc"> list of an EPUB 3
+// navigation document.
+func parseNavDocument(raw []byte, navPath string) []TocEntry {
+	doc, err := html.Parse(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+
+	var navs []*html.Node
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "nav" {
+			navs = append(navs, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(doc)
+	if len(navs) == 0 {
+		return nil
+	}
+
+	nav := navs[0]
+	for _, n := range navs {
+		if hasProperty(attr(n, "epub:type"), "toc") {
+			nav = n
+			break
+		}
+	}
+
+	list := firstChildElement(nav, "ol")
+	if list == nil {
+		return nil
+	}
+	return navListEntries(list, navPath)
+}
+
+func navListEntries(list *html.Node, navPath string) []TocEntry {
+	var entries []TocEntry
+	for li := list.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.Data != "li" {
+			continue
+		}
+
+		var entry TocEntry
+		if a := firstChildElement(li, "a"); a != nil {
+			entry = newTocEntry(innerText(a), attr(a, "href"), navPath)
+		} else {
+			entry = newTocEntry(innerText(firstChildElement(li, "span")), "", navPath)
+		}
+
+		if children := firstChildElement(li, "ol"); children != nil {
+			entry.Children = navListEntries(children, navPath)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func newTocEntry(label, href, base string) TocEntry {
+	entry := TocEntry{
+		Label:   collapseSpace(label),
+		Chapter: -1,
+	}
+	if href == "" || isExternalRef(href) {
+		return entry
+	}
+
+	if i := strings.Index(href, "#"); i >= 0 {
+		entry.Fragment = href[i+1:]
+	}
+	entry.Href = resolveHref(base, href)
+	return entry
+}
+
+// linkToc sets the chapter of every entry from the chapters' archive paths and
+// gives chapters the label of the first entry pointing at them as their title.
+func linkToc(entries []TocEntry, chapterIndex map[string]int, chapters []Chapter) {
+	for i := range entries {
+		entry := &entries[i]
+		if index, ok := chapterIndex[entry.Href]; ok {
+			entry.Chapter = index
+			entry.Href = chapters[index].Href
+			if !chapters[index].HasToc && entry.Label != "" {
+				chapters[index].Title = entry.Label
+				chapters[index].HasToc = true
+			}
+		}
+		linkToc(entry.Children, chapterIndex, chapters)
+	}
+}
+
+// headingTitle returns the text of the first heading in the content, which
+// names chapters the table of contents doesn't.
+func headingTitle(content string) string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return ""
+	}
+
+	var title string
+	var find func(*html.Node) bool
+	find = func(n *html.Node) bool {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				title = collapseSpace(innerText(n))
+				if title != "" {
+					return true
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if find(c) {
+				return true
+			}
+		}
+		return false
+	}
+	find(doc)
+
+	return title
+}
+
+// flatToc lists the titled chapters of formats without a separate table of
+// contents.
+func flatToc(chapters []Chapter) []TocEntry {
+	var entries []TocEntry
+	for i, chapter := range chapters {
+		if chapter.HasToc {
+			entries = append(entries, TocEntry{Label: chapter.Title, Href: chapter.Href, Chapter: i})
+		}
+	}
+	return entries
+}
+
+func firstChildElement(n *html.Node, tag string) *html.Node {
+	if n == nil {
+		return nil
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == tag {
+			return c
+		}
+	}
+	return nil
+}
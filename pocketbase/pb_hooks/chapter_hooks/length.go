@@ -0,0 +1,247 @@
+package chapter_hooks
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// average silent reading speed of adults for non-fiction, in words per minute
+const wordsPerMinute = 238
+
+type BookLength struct {
+	Words      int             `json:"words"`
+	Characters int             `json:"characters"`
+	Minutes    int             `json:"minutes"`
+	Chapters   []ChapterLength `json:"chapters"`
+
+	// only set when the request has a chapter
+	ChapterMinutesLeft *int `json:"chapterMinutesLeft,omitempty"`
+	BookMinutesLeft    *int `json:"bookMinutesLeft,omitempty"`
+}
+
+type ChapterLength struct {
+	Id         string `json:"id"`
+	Title      string `json:"title"`
+	Order      int    `json:"order"`
+	Words      int    `json:"words"`
+	Characters int    `json:"characters"`
+	Minutes    int    `json:"minutes"`
+}
+
+func initLength(app *pocketbase.PocketBase) {
+	app.OnRecordCreate("chapters").BindFunc(func(e *core.RecordEvent) error {
+		setChapterLength(e.Record)
+		return e.Next()
+	})
+
+	app.OnRecordUpdate("chapters").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetString("content") != e.Record.Original().GetString("content") {
+			setChapterLength(e.Record)
+		}
+		return e.Next()
+	})
+
+	// edits made in the reader change the length of the book as well
+	app.OnRecordUpdateRequest("chapters").BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		book, err := e.App.FindRecordById("books", e.Record.GetString("book"))
+		if err != nil {
+			return nil
+		}
+		if err := updateBookLength(e.App, book); err != nil {
+			e.App.Logger().Error("failed to update book length", "book", book.Id, "error", err)
+		}
+
+		return nil
+	})
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		// ?chapter= and ?progress=, the fraction of the chapter already read,
+		// add the minutes left in the chapter and in the book
+		se.Router.GET("/api/books/{id}/length", func(e *core.RequestEvent) error {
+			book, err := e.App.FindRecordById("books", e.Request.PathValue("id"))
+			if err != nil || book.GetString("user") != e.Auth.Id {
+				return e.NotFoundError("Book not found.", err)
+			}
+
+			chapters, err := e.App.FindRecordsByFilter("chapters", "book = {:book}", "order", 0, 0, dbx.Params{"book": book.Id})
+			if err != nil {
+				return e.InternalServerError("failed to find chapters", err)
+			}
+
+			// chapters imported before lengths were counted get them on first request
+			if err := backfillBookLength(e.App, book, chapters); err != nil {
+				return e.InternalServerError("failed to count book length", err)
+			}
+
+			length := BookLength{
+				Words:      book.GetInt("word_count"),
+				Characters: book.GetInt("character_count"),
+				Minutes:    book.GetInt("reading_minutes"),
+				Chapters:   make([]ChapterLength, 0, len(chapters)),
+			}
+			for _, chapter := range chapters {
+				length.Chapters = append(length.Chapters, ChapterLength{
+					Id:         chapter.Id,
+					Title:      chapter.GetString("title"),
+					Order:      chapter.GetInt("order"),
+					Words:      chapter.GetInt("word_count"),
+					Characters: chapter.GetInt("character_count"),
+					Minutes:    chapter.GetInt("reading_minutes"),
+				})
+			}
+
+			if chapterId := e.Request.URL.Query().Get("chapter"); chapterId != "" {
+				progress := 0.0
+				if raw := e.Request.URL.Query().Get("progress"); raw != "" {
+					progress, err = strconv.ParseFloat(raw, 64)
+					if err != nil || progress < 0 || progress > 1 {
+						return e.BadRequestError("progress must be a number between 0 and 1.", err)
+					}
+				}
+
+				chapterMinutesLeft, bookMinutesLeft, ok := minutesLeft(length.Chapters, chapterId, progress)
+				if !ok {
+					return e.BadRequestError("The chapter is not part of the book.", nil)
+				}
+				length.ChapterMinutesLeft = &chapterMinutesLeft
+				length.BookMinutesLeft = &bookMinutesLeft
+			}
+
+			return e.JSON(http.StatusOK, length)
+		}).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+}
+
+// chapterTextLength counts the words and characters of the chapter text, as
+// extracted for its vectors. Characters of scripts written without spaces,
+// such as Chinese and Japanese, count as a word each.
+func chapterTextLength(content string) (words int, characters int) {
+	textNodes, err := parseHTMLIntoTextNodes(content)
+	if err != nil {
+		return 0, 0
+	}
+
+	for _, text := range textNodes {
+		fields := strings.Fields(text)
+		characters += utf8.RuneCountInString(strings.Join(fields, " "))
+
+		for _, field := range fields {
+			inWord := false
+			for _, r := range field {
+				if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) {
+					words++
+					inWord = false
+				} else if !inWord {
+					words++
+					inWord = true
+				}
+			}
+		}
+	}
+
+	return words, characters
+}
+
+func readingMinutes(words int) int {
+	return int(math.Ceil(float64(words) / wordsPerMinute))
+}
+
+func setChapterLength(chapter *core.Record) {
+	words, characters := chapterTextLength(chapter.GetString("content"))
+	chapter.Set("word_count", words)
+	chapter.Set("character_count", characters)
+	chapter.Set("reading_minutes", readingMinutes(words))
+}
+
+// SetBookLength sets the book's length to the total of its chapters. The book
+// isn't saved.
+func SetBookLength(book *core.Record, chapters []*core.Record) {
+	words, characters := 0, 0
+	for _, chapter := range chapters {
+		words += chapter.GetInt("word_count")
+		characters += chapter.GetInt("character_count")
+	}
+
+	book.Set("word_count", words)
+	book.Set("character_count", characters)
+	book.Set("reading_minutes", readingMinutes(words))
+}
+
+func updateBookLength(app core.App, book *core.Record) error {
+	chapters, err := app.FindAllRecords("chapters", dbx.HashExp{"book": book.Id})
+	if err != nil {
+		return err
+	}
+
+	words := book.GetInt("word_count")
+	SetBookLength(book, chapters)
+	if book.GetInt("word_count") == words {
+		return nil
+	}
+
+	return app.Save(book)
+}
+
+func backfillBookLength(app core.App, book *core.Record, chapters []*core.Record) error {
+	var counted []*core.Record
+	for _, chapter := range chapters {
+		if chapter.GetInt("word_count") != 0 {
+			continue
+		}
+		// chapters without text, such as a cover, are counted again each time
+		setChapterLength(chapter)
+		if chapter.GetInt("word_count") != 0 {
+			counted = append(counted, chapter)
+		}
+	}
+
+	words := book.GetInt("word_count")
+	SetBookLength(book, chapters)
+	if len(counted) == 0 && book.GetInt("word_count") == words {
+		return nil
+	}
+
+	return app.RunInTransaction(func(txApp core.App) error {
+		for _, chapter := range counted {
+			if err := txApp.Save(chapter); err != nil {
+				return err
+			}
+		}
+		return txApp.Save(book)
+	})
+}
+
+// minutesLeft returns the reading minutes left in the chapter from the
+// progress onwards, and in the book from there to its last chapter.
+func minutesLeft(chapters []ChapterLength, chapterId string, progress float64) (int, int, bool) {
+	for i, chapter := range chapters {
+		if chapter.Id != chapterId {
+			continue
+		}
+
+		chapterWords := float64(chapter.Words) * (1 - progress)
+		bookWords := chapterWords
+		for _, next := range chapters[i+1:] {
+			bookWords += float64(next.Words)
+		}
+
+		return int(math.Ceil(chapterWords / wordsPerMinute)), int(math.Ceil(bookWords / wordsPerMinute)), true
+	}
+
+	return 0, 0, false
+}
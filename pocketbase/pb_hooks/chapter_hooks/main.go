@@ -6,102 +6,83 @@ import (
 	"log"
 	"strings"
 
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/progress"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
-	"github.com/pocketbase/pocketbase/tools/routine"
 	"github.com/tmc/langchaingo/documentloaders"
 	"github.com/tmc/langchaingo/textsplitter"
 	"golang.org/x/net/html"
 )
 
 func Init(app *pocketbase.PocketBase) error {
-	app.OnRecordAfterCreateSuccess("chapters").BindFunc(func(e *core.RecordEvent) error {
-		vectorCollection, err := app.FindCollectionByNameOrId("vectors")
-		if err != nil {
-			return err
+	app.OnRecordViewRequest("chapters").BindFunc(func(e *core.RecordRequestEvent) error {
+		if e.Auth == nil {
+			return e.Next()
 		}
 
-		content := e.Record.GetString("content")
-		title := e.Record.GetString("title")
-		book := e.Record.GetString("book")
-
-		textNodes, err := parseHTMLIntoTextNodes(content)
+		book, err := e.App.FindRecordById("books", e.Record.GetString("book"))
 		if err != nil {
 			return err
 		}
 
-		routine.FireAndForget(func() {
-			vectorIndex := 0
-			for _, textContent := range textNodes {
-				p := documentloaders.NewText(strings.NewReader(textContent))
-
-				split := textsplitter.NewRecursiveCharacter()
-				split.ChunkSize = 600
-				split.ChunkOverlap = 100
-				docs, err := p.LoadAndSplit(context.Background(), split)
-
-				if err != nil {
-					fmt.Println("Error loading document: ", err)
-				}
-
-				for _, chunk := range docs {
-					vector := core.NewRecord(vectorCollection)
-					vector.Set("title", title)
-					vector.Set("content", chunk.PageContent)
-					vector.Set("chapter", e.Record.Id)
-					vector.Set("book", book)
-					vector.Set("index", vectorIndex)
-
-					if err := e.App.Save(vector); err != nil {
-						e.App.Logger().Error("Error saving vector record:", "error", err.Error())
-						return
-					}
-					vectorIndex++
-				}
-			}
-		})
+		if err := progress.OpenBook(e.App, e.Auth.Id, book, e.Record.Id); err != nil {
+			e.App.Logger().Error("failed to save reading position", "chapter", e.Record.Id, "error", err)
+		}
 
 		return e.Next()
 	})
 
-	app.OnRecordViewRequest("chapters").BindFunc(func(e *core.RecordRequestEvent) error {
-		if e.Auth == nil {
-			return e.Next()
-		}
+	initSanitize(app)
+	initLength(app)
 
-		user := e.Auth.Id
-		book := e.Record.GetString("book")
+	return nil
+}
 
-		bookRecord, err := e.App.FindRecordById("books", book)
-		if err != nil {
-			return err
-		}
+// CreateChapterVectors splits the chapter's text into chunks and saves a vector
+// record for each one, returning the number of vectors created. Embeddings are
+// generated for the new records by the vector_search hooks.
+func CreateChapterVectors(app core.App, chapter *core.Record) (int, error) {
+	vectorCollection, err := app.FindCollectionByNameOrId("vectors")
+	if err != nil {
+		return 0, err
+	}
 
-		bookRecord.Set("current_chapter", e.Record.Id)
-		err = app.Save(bookRecord)
-		if err != nil {
-			return e.Next()
-		}
+	title := chapter.GetString("title")
+	book := chapter.GetString("book")
+
+	textNodes, err := parseHTMLIntoTextNodes(chapter.GetString("content"))
+	if err != nil {
+		return 0, err
+	}
+
+	vectorIndex := 0
+	for _, textContent := range textNodes {
+		p := documentloaders.NewText(strings.NewReader(textContent))
 
-		lastRead, err := e.App.FindFirstRecordByData("last_read", "user", user)
+		split := textsplitter.NewRecursiveCharacter()
+		split.ChunkSize = 600
+		split.ChunkOverlap = 100
+		docs, err := p.LoadAndSplit(context.Background(), split)
 		if err != nil {
-			return e.Next()
+			return vectorIndex, fmt.Errorf("failed to split chapter text: %w", err)
 		}
 
-		if lastRead != nil {
-			lastRead.Set("book", book)
-			lastRead.Set("chapter", e.Record.Id)
+		for _, chunk := range docs {
+			vector := core.NewRecord(vectorCollection)
+			vector.Set("title", title)
+			vector.Set("content", chunk.PageContent)
+			vector.Set("chapter", chapter.Id)
+			vector.Set("book", book)
+			vector.Set("index", vectorIndex)
 
-			err = e.App.Save(lastRead)
-			if err != nil {
-				return e.Next()
+			if err := app.Save(vector); err != nil {
+				return vectorIndex, err
 			}
+			vectorIndex++
 		}
+	}
 
-		return e.Next()
-	})
-
-	return nil
+	return vectorIndex, nil
 }
 
 func parseHTMLIntoTextNodes(htmlContent string) ([]string, error) {
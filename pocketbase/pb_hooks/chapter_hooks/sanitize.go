@@ -0,0 +1,121 @@
+package chapter_hooks
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/book_parsers"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+const sanitizeBatchSize = 100
+
+func initSanitize(app *pocketbase.PocketBase) {
+	// every save is sanitized, whether it comes from the API, an import, a
+	// sync or a command
+	app.OnRecordCreate("chapters").BindFunc(func(e *core.RecordEvent) error {
+		sanitizeChapterRecord(e.Record)
+		return e.Next()
+	})
+
+	app.OnRecordUpdate("chapters").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetString("content") != e.Record.Original().GetString("content") {
+			sanitizeChapterRecord(e.Record)
+		}
+		return e.Next()
+	})
+
+	app.RootCmd.AddCommand(sanitizeCommand(app))
+}
+
+// sanitizeChapterRecord sanitizes the chapter's content. A report set by
+// whatever sanitized the content before the save, such as the import, is kept
+// unless more had to be removed.
+func sanitizeChapterRecord(chapter *core.Record) {
+	content, report := book_parsers.SanitizeChapter(chapter.GetString("content"))
+	chapter.Set("content", content)
+	if report.Empty() && chapter.GetString("sanitize_report") != chapter.Original().GetString("sanitize_report") {
+		return
+	}
+	SetSanitizeReport(chapter, report)
+}
+
+// SetSanitizeReport stores what was removed from the chapter's content when it
+// was last written, or clears the report if nothing was.
+func SetSanitizeReport(chapter *core.Record, report book_parsers.SanitizeReport) {
+	if report.Empty() {
+		chapter.Set("sanitize_report", nil)
+		return
+	}
+	chapter.Set("sanitize_report", report)
+}
+
+// sanitizeCommand re-sanitizes the chapters imported before chapter content
+// was sanitized, or after the allowlist changed.
+func sanitizeCommand(app core.App) *cobra.Command {
+	var dryRun bool
+
+	command := &cobra.Command{
+		Use:          "sanitize-chapters",
+		Short:        "Removes unsafe HTML from the content of existing chapters",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			var total book_parsers.SanitizeReport
+			sanitized := 0
+
+			for offset := 0; ; offset += sanitizeBatchSize {
+				chapters, err := app.FindRecordsByFilter("chapters", "", "id", sanitizeBatchSize, offset)
+				if err != nil {
+					return err
+				}
+
+				for _, chapter := range chapters {
+					content, report := book_parsers.SanitizeChapter(chapter.GetString("content"))
+					if report.Empty() {
+						continue
+					}
+
+					sanitized++
+					total.Merge(report)
+					fmt.Printf("chapter %s of book %s: %s\n", chapter.Id, chapter.GetString("book"), formatReport(report))
+
+					if dryRun {
+						continue
+					}
+
+					chapter.Set("content", content)
+					SetSanitizeReport(chapter, report)
+					if err := app.Save(chapter); err != nil {
+						return fmt.Errorf("failed to save chapter %s: %w", chapter.Id, err)
+					}
+				}
+
+				if len(chapters) < sanitizeBatchSize {
+					break
+				}
+			}
+
+			if dryRun {
+				fmt.Printf("%d chapters would be sanitized: %s\n", sanitized, formatReport(total))
+			} else {
+				fmt.Printf("%d chapters sanitized: %s\n", sanitized, formatReport(total))
+			}
+
+			return nil
+		},
+	}
+
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "report what would be removed without saving the chapters")
+
+	return command
+}
+
+func formatReport(report book_parsers.SanitizeReport) string {
+	raw, err := json.Marshal(report)
+	if err != nil {
+		return err.Error()
+	}
+	return string(raw)
+}
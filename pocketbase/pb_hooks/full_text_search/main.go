@@ -79,7 +79,7 @@ func Init(app *pocketbase.PocketBase, collections ...string) error {
 				return e.NoContent(204)
 			}
 
-			processedQuery := processSearchQuery(q)
+			processedQuery := ProcessSearchQuery(q)
 
 			var query strings.Builder
 			query.WriteString("SELECT * ")
@@ -258,7 +258,9 @@ func syncCollection(app *pocketbase.PocketBase, target string) error {
 	return nil
 }
 
-func processSearchQuery(query string) string {
+// ProcessSearchQuery turns the words of a search into an FTS5 query that
+// matches rows containing every word as a prefix.
+func ProcessSearchQuery(query string) string {
 	if query == "" {
 		return query
 	}
@@ -282,11 +284,15 @@ func collectionFields(collection *core.Collection, id string, collectionName str
 
 	if collectionName == "books" {
 		allowedFields := map[string]bool{
-			"title":       true,
-			"author":      true,
-			"description": true,
-			"subject":     true,
-			"created":     true,
+			"title":        true,
+			"author":       true,
+			"description":  true,
+			"subject":      true,
+			"publisher":    true,
+			"series":       true,
+			"isbn":         true,
+			"contributors": true,
+			"created":      true,
 		}
 
 		for _, field := range collection.Fields {
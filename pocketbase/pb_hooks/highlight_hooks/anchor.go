@@ -0,0 +1,452 @@
+package highlight_hooks
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// how much of the text around a highlight is kept to find it again
+const contextLength = 32
+
+// CharactersPerLocation is the length of a location in the text of a book,
+// close to how a Kindle counts them.
+const CharactersPerLocation = 150
+
+// Anchor locates a highlight in the text of its chapter, like the text
+// position and text quote selectors of the W3C Web Annotation model. Start and
+// End are offsets into the chapter's text in UTF-16 code units, as JavaScript
+// counts them, Path is the element the highlight starts in, and Prefix and
+// Suffix are the text right before and after it.
+type Anchor struct {
+	Path   string `json:"path"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Prefix string `json:"prefix"`
+	Suffix string `json:"suffix"`
+}
+
+// Mark is a highlight to render in a chapter.
+type Mark struct {
+	Id    string
+	Start int
+	End   int
+	Color string
+}
+
+// chapterText is the text of a chapter's content, every rune of its text
+// nodes in order, with where each rune came from.
+type chapterText struct {
+	doc   *html.Node
+	nodes []*html.Node
+	runes []rune
+	// the text node each rune is in
+	runeNodes []int
+	// the UTF-16 offset of each rune, followed by the length of the text
+	units []int
+}
+
+func parseChapterText(content string) (*chapterText, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	text := &chapterText{doc: doc, nodes: textNodes(doc)}
+	offset := 0
+	for i, node := range text.nodes {
+		for _, r := range node.Data {
+			text.runes = append(text.runes, r)
+			text.runeNodes = append(text.runeNodes, i)
+			text.units = append(text.units, offset)
+			offset += utf16.RuneLen(r)
+		}
+	}
+	text.units = append(text.units, offset)
+
+	return text, nil
+}
+
+// runeIndex returns the index of the rune at the UTF-16 offset, or the length
+// of the text for its end.
+func (t *chapterText) runeIndex(offset int) (int, bool) {
+	i := sort.SearchInts(t.units, offset)
+	return i, i < len(t.units) && t.units[i] == offset
+}
+
+// anchor returns the anchor of the runes from start to end.
+func (t *chapterText) anchor(start, end int) *Anchor {
+	return &Anchor{
+		Path:   elementPath(t.nodes[t.runeNodes[start]].Parent),
+		Start:  t.units[start],
+		End:    t.units[end],
+		Prefix: string(t.runes[max(0, start-contextLength):start]),
+		Suffix: string(t.runes[end:min(len(t.runes), end+contextLength)]),
+	}
+}
+
+// stripped returns the runes of the text that aren't whitespace, with their
+// index in it.
+func (t *chapterText) stripped() ([]rune, []int) {
+	var runes []rune
+	var positions []int
+	for i, r := range t.runes {
+		if !unicode.IsSpace(r) {
+			runes = append(runes, r)
+			positions = append(positions, i)
+		}
+	}
+	return runes, positions
+}
+
+// occurrences returns the start and end rune index of every occurrence of the
+// quote in the text, ignoring whitespace.
+func (t *chapterText) occurrences(quote string) [][2]int {
+	target := []rune(stripSpace(quote))
+	if len(target) == 0 {
+		return nil
+	}
+
+	stripped, positions := t.stripped()
+	var found [][2]int
+	for i := indexRunes(stripped, target, 0); i >= 0; i = indexRunes(stripped, target, i+1) {
+		found = append(found, [2]int{positions[i], positions[i+len(target)-1] + 1})
+	}
+	return found
+}
+
+// FindAnchor finds the quote in the content and returns its anchor, or nil if
+// the quote isn't in the content. A quote still at the offsets of the previous
+// anchor keeps them. Otherwise the occurrence whose surrounding text best
+// matches the previous prefix and suffix is chosen, then the one closest to
+// the previous start. Whitespace is ignored when matching, since the editor
+// drops the breaks between blocks from selected text.
+func FindAnchor(content, quote string, previous Anchor) (*Anchor, error) {
+	target := []rune(stripSpace(quote))
+	if len(target) == 0 {
+		return nil, nil
+	}
+
+	text, err := parseChapterText(content)
+	if err != nil {
+		return nil, err
+	}
+
+	start, startFound := text.runeIndex(previous.Start)
+	end, endFound := text.runeIndex(previous.End)
+	if startFound && endFound && end > start && stripSpace(string(text.runes[start:end])) == string(target) {
+		return text.anchor(start, end), nil
+	}
+
+	stripped, positions := text.stripped()
+
+	prefix := []rune(stripSpace(previous.Prefix))
+	suffix := []rune(stripSpace(previous.Suffix))
+
+	best, bestScore, bestDistance := -1, 0, 0
+	for i := indexRunes(stripped, target, 0); i >= 0; i = indexRunes(stripped, target, i+1) {
+		score := commonSuffixLength(stripped[:i], prefix) + commonPrefixLength(stripped[i+len(target):], suffix)
+		distance := text.units[positions[i]] - previous.Start
+		if distance < 0 {
+			distance = -distance
+		}
+
+		if best < 0 || score > bestScore || score == bestScore && distance < bestDistance {
+			best, bestScore, bestDistance = i, score, distance
+		}
+	}
+	if best < 0 {
+		return nil, nil
+	}
+
+	return text.anchor(positions[best], positions[best+len(target)-1]+1), nil
+}
+
+// RenderHighlights wraps the text of each mark in the content in <mark> tags,
+// which carry the ids of the highlights they belong to and their color.
+// Overlapping highlights share the <mark> tags of the text they have in
+// common, which take the color of the last mark.
+func RenderHighlights(content string, marks []Mark) (string, error) {
+	if len(marks) == 0 {
+		return content, nil
+	}
+
+	text, err := parseChapterText(content)
+	if err != nil {
+		return "", err
+	}
+
+	first := 0
+	for _, node := range text.nodes {
+		if node.Data == "" {
+			continue
+		}
+
+		// the runes of each node follow the ones of the node before it
+		last := first + len([]rune(node.Data))
+		from, to := text.units[first], text.units[last]
+		first = last
+
+		cuts := []int{from, to}
+		for _, mark := range marks {
+			if mark.Start < to && mark.End > from {
+				cuts = append(cuts, max(mark.Start, from), min(mark.End, to))
+			}
+		}
+		if len(cuts) == 2 {
+			continue
+		}
+		sort.Ints(cuts)
+
+		var segments []*html.Node
+		marked := false
+		for j := 1; j < len(cuts); j++ {
+			if cuts[j] == cuts[j-1] {
+				continue
+			}
+			data := unitSlice(node.Data, cuts[j-1]-from, cuts[j]-from)
+
+			var ids []string
+			color := ""
+			for _, mark := range marks {
+				if mark.Start <= cuts[j-1] && mark.End >= cuts[j] {
+					ids = append(ids, mark.Id)
+					if mark.Color != "" {
+						color = mark.Color
+					}
+				}
+			}
+
+			if len(ids) == 0 || strings.TrimSpace(data) == "" {
+				segments = append(segments, &html.Node{Type: html.TextNode, Data: data})
+				continue
+			}
+
+			mark := &html.Node{
+				Type:     html.ElementNode,
+				Data:     "mark",
+				DataAtom: atom.Mark,
+				Attr: []html.Attribute{
+					{Key: "class", Val: "slate-highlight"},
+					{Key: "data-highlight", Val: strings.Join(ids, " ")},
+				},
+			}
+			if color != "" {
+				mark.Attr = append(mark.Attr, html.Attribute{Key: "data-color", Val: color})
+			}
+			mark.AppendChild(&html.Node{Type: html.TextNode, Data: data})
+			segments = append(segments, mark)
+			marked = true
+		}
+		if !marked {
+			continue
+		}
+
+		for _, segment := range segments {
+			node.Parent.InsertBefore(segment, node)
+		}
+		node.Parent.RemoveChild(node)
+	}
+
+	return renderHTML(text.doc)
+}
+
+// StripMarks removes the <mark> tags added for highlights, keeping their text.
+func StripMarks(content string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+
+	for _, mark := range markNodes(doc) {
+		for mark.FirstChild != nil {
+			child := mark.FirstChild
+			mark.RemoveChild(child)
+			mark.Parent.InsertBefore(child, mark)
+		}
+		mark.Parent.RemoveChild(mark)
+	}
+
+	return renderHTML(doc)
+}
+
+// TextContent returns the text of the HTML content with whitespace removed,
+// which is how highlight text is compared against chapter content.
+func TextContent(content string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	for _, node := range textNodes(doc) {
+		text.WriteString(stripSpace(node.Data))
+	}
+	return text.String(), nil
+}
+
+// TextLength returns the length of the content's text in UTF-16 code units,
+// the unit of anchor offsets.
+func TextLength(content string) (int, error) {
+	text, err := parseChapterText(content)
+	if err != nil {
+		return 0, err
+	}
+	return text.units[len(text.units)-1], nil
+}
+
+// markedRanges returns the UTF-16 ranges of the content's text that are
+// inside <mark> tags.
+func markedRanges(content string) ([][2]int, error) {
+	text, err := parseChapterText(content)
+	if err != nil {
+		return nil, err
+	}
+
+	marked := make(map[*html.Node]bool)
+	for _, mark := range markNodes(text.doc) {
+		for _, node := range textNodes(mark) {
+			marked[node] = true
+		}
+	}
+
+	var ranges [][2]int
+	for i := range text.runes {
+		if !marked[text.nodes[text.runeNodes[i]]] {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1][1] == text.units[i] {
+			ranges[n-1][1] = text.units[i+1]
+		} else {
+			ranges = append(ranges, [2]int{text.units[i], text.units[i+1]})
+		}
+	}
+	return ranges, nil
+}
+
+func markNodes(doc *html.Node) []*html.Node {
+	var marks []*html.Node
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "mark" {
+			marks = append(marks, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(doc)
+	return marks
+}
+
+func textNodes(doc *html.Node) []*html.Node {
+	var nodes []*html.Node
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "head" || n.Data == "script" || n.Data == "style") {
+			return
+		}
+		if n.Type == html.TextNode {
+			nodes = append(nodes, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(doc)
+	return nodes
+}
+
+// elementPath returns the indexes of the element and its ancestors among
+// their sibling elements, from the body down, such as /4/2/1.
+func elementPath(n *html.Node) string {
+	var indexes []string
+	for ; n != nil && n.Type == html.ElementNode && n.DataAtom != atom.Body && n.DataAtom != atom.Html; n = n.Parent {
+		index := 0
+		for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+			if s.Type == html.ElementNode {
+				index++
+			}
+		}
+		indexes = append(indexes, strconv.Itoa(index))
+	}
+
+	var path strings.Builder
+	for i := len(indexes) - 1; i >= 0; i-- {
+		path.WriteString("/" + indexes[i])
+	}
+	return path.String()
+}
+
+// unitSlice returns the part of s between two UTF-16 offsets.
+func unitSlice(s string, from, to int) string {
+	start, end := len(s), len(s)
+	offset := 0
+	for i, r := range s {
+		if offset == from {
+			start = i
+		}
+		if offset == to {
+			end = i
+			break
+		}
+		offset += utf16.RuneLen(r)
+	}
+	return s[start:end]
+}
+
+func indexRunes(haystack, needle []rune, from int) int {
+	for i := from; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j := range needle {
+			if haystack[i+j] != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// commonSuffixLength returns how many runes at the end of a and b are equal.
+func commonSuffixLength(a, b []rune) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	return n
+}
+
+// commonPrefixLength returns how many runes at the start of a and b are equal.
+func commonPrefixLength(a, b []rune) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func stripSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func renderHTML(doc *html.Node) (string, error) {
+	var buf strings.Builder
+	if err := html.Render(&buf, doc); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,214 @@
+package highlight_hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Clipping is a highlight read from the export of another reader.
+type Clipping struct {
+	Title   string
+	Author  string
+	Text    string
+	Note    string
+	Chapter string
+	Color   string
+	// Kindle location where the highlight starts and ends, 0 if unknown
+	Location    int
+	EndLocation int
+	// page of the highlight and the number of pages in the book, 0 if unknown
+	Page  int
+	Pages int
+}
+
+// the closest of the colors highlights can have to KOReader's other colors
+var koreaderColors = map[string]string{
+	"red":    "pink",
+	"orange": "yellow",
+	"olive":  "green",
+	"cyan":   "blue",
+}
+
+var (
+	clippingTitleRegex    = regexp.MustCompile(`^(.*?)\s*\(([^()]*)\)$`)
+	clippingLocationRegex = regexp.MustCompile(`(?i)\bloc(?:ation|\.)?\s+(\d+)(?:-(\d+))?`)
+	clippingPageRegex     = regexp.MustCompile(`(?i)\bpage\s+(\d+)`)
+)
+
+// ParseClippings reads the highlights of a KOReader JSON export, or else of a
+// Kindle "My Clippings.txt". Notes are attached to the highlight they were
+// written on. Notes that aren't on any highlight are returned as clippings
+// without text.
+func ParseClippings(data []byte) []Clipping {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\ufeff")))
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		if clippings, ok := parseKOReader(trimmed); ok {
+			return clippings
+		}
+	}
+	return parseKindle(string(data))
+}
+
+type koreaderExport struct {
+	koreaderDocument
+	Documents []koreaderDocument `json:"documents"`
+}
+
+type koreaderDocument struct {
+	Title   string          `json:"title"`
+	Author  string          `json:"author"`
+	Pages   int             `json:"number_of_pages"`
+	Entries []koreaderEntry `json:"entries"`
+}
+
+type koreaderEntry struct {
+	Text    string `json:"text"`
+	Note    string `json:"note"`
+	Chapter string `json:"chapter"`
+	Color   string `json:"color"`
+	// a number, or a position in the document for reflowable books
+	Page any `json:"page"`
+}
+
+// parseKOReader reads the JSON KOReader exports highlights to, with a single
+// book at the top level or several in documents.
+func parseKOReader(data []byte) ([]Clipping, bool) {
+	var documents []koreaderDocument
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &documents); err != nil {
+			return nil, false
+		}
+	} else {
+		var export koreaderExport
+		if err := json.Unmarshal(data, &export); err != nil {
+			return nil, false
+		}
+		documents = append(export.Documents, export.koreaderDocument)
+	}
+
+	clippings := []Clipping{}
+	for _, document := range documents {
+		for _, entry := range document.Entries {
+			if strings.TrimSpace(entry.Text) == "" {
+				continue
+			}
+
+			clipping := Clipping{
+				Title:   strings.TrimSpace(document.Title),
+				Author:  strings.TrimSpace(document.Author),
+				Text:    strings.TrimSpace(entry.Text),
+				Note:    strings.TrimSpace(entry.Note),
+				Chapter: strings.TrimSpace(entry.Chapter),
+				Color:   koreaderColor(entry.Color),
+				Pages:   document.Pages,
+			}
+			if page, ok := entry.Page.(float64); ok {
+				clipping.Page = int(page)
+			}
+
+			clippings = append(clippings, clipping)
+		}
+	}
+
+	return clippings, true
+}
+
+func koreaderColor(color string) string {
+	color = strings.ToLower(color)
+	if mapped, ok := koreaderColors[color]; ok {
+		return mapped
+	}
+	for _, c := range Colors {
+		if c == color {
+			return c
+		}
+	}
+	return ""
+}
+
+// parseKindle reads the entries of a "My Clippings.txt". Every entry has the
+// title and author of the book, a line with the kind of entry, its location
+// and when it was added, and the highlighted text or the note after a blank
+// line. Entries end with a line of "=" signs. Bookmarks are skipped.
+func parseKindle(content string) []Clipping {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\ufeff", "")
+
+	clippings := []Clipping{}
+	for _, entry := range strings.Split(content, "==========") {
+		lines := strings.Split(strings.TrimSpace(entry), "\n")
+		if len(lines) < 3 {
+			continue
+		}
+
+		meta := strings.TrimSpace(lines[1])
+		text := strings.TrimSpace(strings.Join(lines[2:], "\n"))
+		if !strings.HasPrefix(meta, "-") || text == "" {
+			continue
+		}
+
+		clipping := Clipping{Title: strings.TrimSpace(lines[0])}
+		if match := clippingTitleRegex.FindStringSubmatch(clipping.Title); match != nil {
+			clipping.Title, clipping.Author = match[1], strings.TrimSpace(match[2])
+		}
+		if match := clippingLocationRegex.FindStringSubmatch(meta); match != nil {
+			clipping.Location, _ = strconv.Atoi(match[1])
+			clipping.EndLocation = clipping.Location
+			if match[2] != "" {
+				clipping.EndLocation = endLocation(match[1], match[2])
+			}
+		}
+		if match := clippingPageRegex.FindStringSubmatch(meta); match != nil {
+			clipping.Page, _ = strconv.Atoi(match[1])
+		}
+
+		kind := strings.ToLower(strings.SplitN(meta, "|", 2)[0])
+		switch {
+		case strings.Contains(kind, "note"):
+			// a note comes after the highlight it was written on, which ends
+			// where the note is
+			if highlight := noteHighlight(clippings, clipping); highlight != nil {
+				highlight.Note = text
+			} else {
+				clipping.Note = text
+				clippings = append(clippings, clipping)
+			}
+		case strings.Contains(kind, "highlight"):
+			clipping.Text = text
+			clippings = append(clippings, clipping)
+		}
+	}
+
+	return clippings
+}
+
+// endLocation returns the end of a location range, which older Kindles
+// shorten to its last digits, as in 1234-36.
+func endLocation(start, end string) int {
+	if len(end) < len(start) {
+		end = start[:len(start)-len(end)] + end
+	}
+	location, _ := strconv.Atoi(end)
+	return location
+}
+
+// noteHighlight returns the last highlight in the same book that the note's
+// location is in.
+func noteHighlight(clippings []Clipping, note Clipping) *Clipping {
+	for i := len(clippings) - 1; i >= 0; i-- {
+		c := &clippings[i]
+		if c.Text == "" || c.Title != note.Title || c.Author != note.Author {
+			continue
+		}
+		if note.Location > 0 && c.Location <= note.Location && note.Location <= c.EndLocation {
+			return c
+		}
+		if note.Location == 0 && note.Page > 0 && c.Page == note.Page {
+			return c
+		}
+	}
+	return nil
+}
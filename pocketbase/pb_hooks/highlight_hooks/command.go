@@ -0,0 +1,130 @@
+package highlight_hooks
+
+import (
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+const anchorBatchSize = 100
+
+// anchorCommand moves the highlights saved before they were anchored out of
+// the chapter content. The <mark> tags in a chapter tell which occurrence of a
+// highlight's text was highlighted, and are removed once its highlights are
+// anchored.
+func anchorCommand(app core.App) *cobra.Command {
+	var dryRun bool
+
+	command := &cobra.Command{
+		Use:          "anchor-highlights",
+		Short:        "Anchors the highlights stored as <mark> tags in chapter content",
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			chapters, anchored, unanchored := 0, 0, 0
+
+			for offset := 0; ; offset += anchorBatchSize {
+				records, err := app.FindRecordsByFilter("chapters", "content ~ '<mark'", "id", anchorBatchSize, offset)
+				if err != nil {
+					return err
+				}
+
+				for _, chapter := range records {
+					found, missing, err := anchorChapter(app, chapter, dryRun)
+					if err != nil {
+						return fmt.Errorf("failed to anchor the highlights of chapter %s: %w", chapter.Id, err)
+					}
+
+					chapters++
+					anchored += found
+					unanchored += missing
+					if missing > 0 {
+						fmt.Printf("chapter %s of book %s: %d highlights not found\n", chapter.Id, chapter.GetString("book"), missing)
+					}
+				}
+
+				if len(records) < anchorBatchSize {
+					break
+				}
+			}
+
+			if dryRun {
+				fmt.Printf("%d chapters would be cleaned, %d highlights anchored and %d not found\n", chapters, anchored, unanchored)
+			} else {
+				fmt.Printf("%d chapters cleaned, %d highlights anchored and %d not found\n", chapters, anchored, unanchored)
+			}
+
+			return nil
+		},
+	}
+
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "report what would be anchored without saving anything")
+
+	return command
+}
+
+// anchorChapter anchors the highlights of the chapter at the occurrence of
+// their text that is most covered by <mark> tags, then removes the tags.
+func anchorChapter(app core.App, chapter *core.Record, dryRun bool) (int, int, error) {
+	content := chapter.GetString("content")
+
+	ranges, err := markedRanges(content)
+	if err != nil {
+		return 0, 0, err
+	}
+	stripped, err := StripMarks(content)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	text, err := parseChapterText(stripped)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	highlights, err := app.FindAllRecords("highlights", dbx.HashExp{"chapter": chapter.Id})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	anchored, unanchored := 0, 0
+	for _, highlight := range highlights {
+		var best *Anchor
+		bestCovered := -1
+		for _, occurrence := range text.occurrences(highlight.GetString("text")) {
+			anchor := text.anchor(occurrence[0], occurrence[1])
+
+			covered := 0
+			for _, r := range ranges {
+				covered += max(0, min(r[1], anchor.End)-max(r[0], anchor.Start))
+			}
+			if covered > bestCovered {
+				best, bestCovered = anchor, covered
+			}
+		}
+
+		if best == nil {
+			unanchored++
+			continue
+		}
+		anchored++
+
+		if dryRun {
+			continue
+		}
+		SetAnchor(highlight, best)
+		if err := app.Save(highlight); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if !dryRun {
+		chapter.Set("content", stripped)
+		if err := app.Save(chapter); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return anchored, unanchored, nil
+}
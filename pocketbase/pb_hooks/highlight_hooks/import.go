@@ -0,0 +1,411 @@
+package highlight_hooks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const maxClippingsSize = 32 << 20
+
+// how many characters at each end of a quote have to match when the rest of
+// it doesn't
+const fuzzyEndLength = 16
+
+const (
+	ClippingImported  = "imported"
+	ClippingDuplicate = "duplicate"
+	ClippingUnmatched = "unmatched"
+)
+
+type ClippingResult struct {
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	Text      string `json:"text"`
+	Status    string `json:"status"`
+	Book      string `json:"book,omitempty"`
+	Highlight string `json:"highlight,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ClippingsReport struct {
+	Imported  int              `json:"imported"`
+	Duplicate int              `json:"duplicate"`
+	Unmatched int              `json:"unmatched"`
+	Results   []ClippingResult `json:"results"`
+}
+
+// bookText is the text of every chapter of a book, to find quotes in.
+type bookText struct {
+	chapters []*core.Record
+	texts    []*chapterText
+	// where each chapter starts in the text of the book, in UTF-16 code units
+	offsets []int
+	length  int
+}
+
+// quoteMatch is where a quote was found, as rune indexes in a chapter's text.
+type quoteMatch struct {
+	chapter    int
+	start, end int
+}
+
+func initImport(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		// a book in the form imports every highlight into it instead of the
+		// book matching its title
+		se.Router.POST("/api/highlights/import", func(e *core.RequestEvent) error {
+			file, _, err := e.Request.FormFile("file")
+			if err != nil {
+				return e.BadRequestError("A clippings file is required.", err)
+			}
+			defer file.Close()
+
+			data, err := io.ReadAll(file)
+			if err != nil {
+				return e.BadRequestError("Failed to read the clippings file.", err)
+			}
+
+			var book *core.Record
+			if bookId := e.Request.FormValue("book"); bookId != "" {
+				book, err = e.App.FindRecordById("books", bookId)
+				if err != nil || book.GetString("user") != e.Auth.Id {
+					return e.NotFoundError("Book not found.", err)
+				}
+			}
+
+			report, err := ImportClippings(e.App, e.Auth.Id, ParseClippings(data), book)
+			if err != nil {
+				return e.InternalServerError("failed to import highlights", err)
+			}
+
+			return e.JSON(http.StatusOK, report)
+		}).Bind(apis.RequireAuth(), apis.BodyLimit(maxClippingsSize))
+
+		return se.Next()
+	})
+}
+
+// ImportClippings creates a highlight for every clipping whose text is found
+// in the user's book with its title and author, or in book if it isn't nil.
+// Clippings already imported are skipped, so importing the same file again
+// changes nothing. The highlights are all created or, on error, none are.
+func ImportClippings(app core.App, userId string, clippings []Clipping, book *core.Record) (*ClippingsReport, error) {
+	var report *ClippingsReport
+	err := app.RunInTransaction(func(txApp core.App) error {
+		var err error
+		report, err = importClippings(txApp, userId, clippings, book)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func importClippings(app core.App, userId string, clippings []Clipping, book *core.Record) (*ClippingsReport, error) {
+	collection, err := app.FindCollectionByNameOrId("highlights")
+	if err != nil {
+		return nil, err
+	}
+
+	var books []*core.Record
+	if book != nil {
+		books = []*core.Record{book}
+	} else {
+		books, err = app.FindRecordsByFilter("books", "user = {:user}", "created", 0, 0, dbx.Params{"user": userId})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	texts := make(map[string]*bookText)
+	report := &ClippingsReport{Results: []ClippingResult{}}
+	for _, clipping := range clippings {
+		result := ClippingResult{Title: clipping.Title, Author: clipping.Author, Text: clipping.Text}
+
+		matched := book
+		if matched == nil {
+			matched = matchBook(books, clipping.Title, clipping.Author)
+		}
+
+		var match *quoteMatch
+		var text *bookText
+		switch {
+		case clipping.Text == "":
+			result.Text = clipping.Note
+			result.Error = "note without a highlight"
+		case matched == nil:
+			result.Error = "book not found"
+		default:
+			result.Book = matched.Id
+
+			text = texts[matched.Id]
+			if text == nil {
+				text, err = loadBookText(app, matched)
+				if err != nil {
+					return nil, err
+				}
+				texts[matched.Id] = text
+			}
+
+			match = text.find(clipping)
+			if match == nil {
+				result.Error = "text not found in the book"
+			}
+		}
+		if match == nil {
+			result.Status = ClippingUnmatched
+			report.Unmatched++
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		chapter := text.chapters[match.chapter]
+		anchor := text.texts[match.chapter].anchor(match.start, match.end)
+
+		// the highlight has the text as it is in the chapter, so it can be
+		// found again when the chapter changes
+		quote := string(text.texts[match.chapter].runes[match.start:match.end])
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s-%s-%d-%d-%s", matched.Id, chapter.Id, anchor.Start, anchor.End, quote)))
+		hash := hex.EncodeToString(sum[:])
+
+		existing, err := app.FindAllRecords("highlights", dbx.HashExp{
+			"user":    userId,
+			"book":    matched.Id,
+			"chapter": chapter.Id,
+			"start":   anchor.Start,
+			"end":     anchor.End,
+			"hash":    hash,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) > 0 {
+			result.Status = ClippingDuplicate
+			result.Highlight = existing[0].Id
+			report.Duplicate++
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		highlight := core.NewRecord(collection)
+		highlight.Set("user", userId)
+		highlight.Set("book", matched.Id)
+		highlight.Set("chapter", chapter.Id)
+		highlight.Set("text", quote)
+		highlight.Set("hash", hash)
+		highlight.Set("color", clipping.Color)
+		highlight.Set("note", clipping.Note)
+		SetAnchor(highlight, anchor)
+		if err := app.Save(highlight); err != nil {
+			return nil, err
+		}
+
+		result.Status = ClippingImported
+		result.Highlight = highlight.Id
+		report.Imported++
+		report.Results = append(report.Results, result)
+	}
+
+	return report, nil
+}
+
+// matchBook returns the book whose title is the clipping's, or starts with it
+// or is the start of it, such as when one has a subtitle and the other
+// doesn't. Books by the same author are preferred.
+func matchBook(books []*core.Record, title, author string) *core.Record {
+	title = looseWords(title)
+	if title == "" {
+		return nil
+	}
+	authorWords := strings.Fields(looseWords(author))
+
+	var best *core.Record
+	bestScore := 0
+	for _, book := range books {
+		bookTitle := looseWords(book.GetString("title"))
+
+		score := 0
+		switch {
+		case bookTitle == title:
+			score = 4
+		case strings.HasPrefix(bookTitle, title+" "), strings.HasPrefix(title, bookTitle+" "):
+			score = 2
+		default:
+			continue
+		}
+
+		// authors are written as "First Last" or "Last, First"
+		for _, word := range strings.Fields(looseWords(book.GetString("author"))) {
+			if len([]rune(word)) > 1 && slices.Contains(authorWords, word) {
+				score++
+				break
+			}
+		}
+
+		if score > bestScore {
+			best, bestScore = book, score
+		}
+	}
+
+	return best
+}
+
+func loadBookText(app core.App, book *core.Record) (*bookText, error) {
+	chapters, err := app.FindRecordsByFilter("chapters", "book = {:book}", "order", 0, 0, dbx.Params{"book": book.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	text := &bookText{chapters: chapters}
+	for _, chapter := range chapters {
+		chapterText, err := parseChapterText(chapter.GetString("content"))
+		if err != nil {
+			return nil, err
+		}
+		text.texts = append(text.texts, chapterText)
+		text.offsets = append(text.offsets, text.length)
+		text.length += chapterText.units[len(chapterText.units)-1]
+	}
+
+	return text, nil
+}
+
+// find returns where the clipping's text is in the book. The text is matched
+// ignoring whitespace, then also ignoring case and punctuation, which other
+// readers and editions may differ in, and then by its start and end alone.
+// When the text is in the book more than once, the occurrence in the chapter
+// with the clipping's chapter title and closest to its location or page is
+// chosen.
+func (b *bookText) find(clipping Clipping) *quoteMatch {
+	var matches []quoteMatch
+	for _, find := range []func(*chapterText, string) [][2]int{
+		(*chapterText).occurrences,
+		(*chapterText).looseOccurrences,
+		(*chapterText).fuzzyOccurrences,
+	} {
+		for i, text := range b.texts {
+			for _, occurrence := range find(text, clipping.Text) {
+				matches = append(matches, quoteMatch{chapter: i, start: occurrence[0], end: occurrence[1]})
+			}
+		}
+		if len(matches) > 0 {
+			break
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	if clipping.Chapter != "" {
+		var inChapter []quoteMatch
+		for _, match := range matches {
+			if looseWords(b.chapters[match.chapter].GetString("title")) == looseWords(clipping.Chapter) {
+				inChapter = append(inChapter, match)
+			}
+		}
+		if len(inChapter) > 0 {
+			matches = inChapter
+		}
+	}
+
+	// where the clipping is estimated to be in the text of the book
+	position := -1
+	switch {
+	case clipping.Location > 0:
+		position = (clipping.Location - 1) * CharactersPerLocation
+	case clipping.Page > 0 && clipping.Pages > 0:
+		position = b.length * (clipping.Page - 1) / clipping.Pages
+	}
+
+	best := matches[0]
+	if position >= 0 {
+		bestDistance := -1
+		for _, match := range matches {
+			distance := b.offsets[match.chapter] + b.texts[match.chapter].units[match.start] - position
+			if distance < 0 {
+				distance = -distance
+			}
+			if bestDistance < 0 || distance < bestDistance {
+				best, bestDistance = match, distance
+			}
+		}
+	}
+
+	return &best
+}
+
+// loose returns the letters and digits of the text in lower case, with their
+// index in it.
+func (t *chapterText) loose() ([]rune, []int) {
+	var runes []rune
+	var positions []int
+	for i, r := range t.runes {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes = append(runes, unicode.ToLower(r))
+			positions = append(positions, i)
+		}
+	}
+	return runes, positions
+}
+
+// looseOccurrences returns the start and end rune index of every occurrence of
+// the quote in the text, ignoring case and everything but letters and digits.
+func (t *chapterText) looseOccurrences(quote string) [][2]int {
+	target := []rune(strings.ReplaceAll(looseWords(quote), " ", ""))
+	if len(target) == 0 {
+		return nil
+	}
+
+	loose, positions := t.loose()
+	var found [][2]int
+	for i := indexRunes(loose, target, 0); i >= 0; i = indexRunes(loose, target, i+1) {
+		found = append(found, [2]int{positions[i], positions[i+len(target)-1] + 1})
+	}
+	return found
+}
+
+// fuzzyOccurrences returns the places in the text that start and end like the
+// quote and are about as long, ignoring case and everything but letters and
+// digits. The text in between may differ, such as by a footnote marker or a
+// word changed between editions.
+func (t *chapterText) fuzzyOccurrences(quote string) [][2]int {
+	target := []rune(strings.ReplaceAll(looseWords(quote), " ", ""))
+	if len(target) < 3*fuzzyEndLength {
+		return nil
+	}
+	head := target[:fuzzyEndLength]
+	tail := target[len(target)-fuzzyEndLength:]
+	slack := len(target) / 5
+
+	loose, positions := t.loose()
+	var found [][2]int
+	for i := indexRunes(loose, head, 0); i >= 0; i = indexRunes(loose, head, i+1) {
+		expected := i + len(target) - fuzzyEndLength
+		j := indexRunes(loose, tail, max(i+fuzzyEndLength, expected-slack))
+		if j < 0 || j > expected+slack {
+			continue
+		}
+		found = append(found, [2]int{positions[i], positions[j+fuzzyEndLength-1] + 1})
+	}
+	return found
+}
+
+// looseWords returns the words of s in lower case, without punctuation.
+func looseWords(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
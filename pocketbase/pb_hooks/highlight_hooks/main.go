@@ -1,137 +1,252 @@
 package highlight_hooks
 
 import (
+	"database/sql"
+	"errors"
 	"strings"
+	"sync"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
-	"golang.org/x/net/html"
 )
 
+// ErrNotAnchored is returned when a highlight's text isn't in its chapter.
+var ErrNotAnchored = errors.New("the highlighted text wasn't found in the chapter")
+
+// the chapters collected by each run of the enrich hooks, by its event
+var enrichBatches sync.Map
+
 func Init(app *pocketbase.PocketBase) error {
-	app.OnRecordDeleteRequest("highlights").BindFunc(func(e *core.RecordRequestEvent) error {
-		chapterId := e.Record.GetString("chapter")
-		chapter, err := e.App.FindRecordById("chapters", chapterId)
-		if err != nil {
+	app.OnRecordCreateRequest("highlights").BindFunc(func(e *core.RecordRequestEvent) error {
+		if err := anchorRequest(e); err != nil {
 			return err
 		}
+		return e.Next()
+	})
 
-		highlightText := e.Record.GetString("text")
-		htmlContent := chapter.GetString("content")
+	app.OnRecordUpdateRequest("highlights").BindFunc(func(e *core.RecordRequestEvent) error {
+		for _, field := range []string{"chapter", "text", "start", "end"} {
+			if e.Record.GetString(field) != e.Record.Original().GetString(field) {
+				if err := anchorRequest(e); err != nil {
+					return err
+				}
+				break
+			}
+		}
+		return e.Next()
+	})
 
-		updatedHTML, err := removeMarkTagWithText(htmlContent, highlightText)
+	// chapter content is never written with highlights in it, they are added
+	// to the content returned to their owner instead
+	app.OnRecordUpdateRequest("chapters").BindFunc(func(e *core.RecordRequestEvent) error {
+		if e.Record.GetString("content") == e.Record.Original().GetString("content") {
+			return e.Next()
+		}
+
+		content, err := StripMarks(e.Record.GetString("content"))
 		if err != nil {
+			return e.BadRequestError("invalid chapter content", err)
+		}
+		e.Record.Set("content", content)
+
+		return e.Next()
+	})
+
+	// the chapters enriched together, such as a page of a list, are collected
+	// as the hook goes down the chain of records and rendered at once when it
+	// comes back to the first of them
+	app.OnRecordEnrich("chapters").BindFunc(func(e *core.RecordEnrichEvent) error {
+		if e.RequestInfo == nil || e.RequestInfo.Auth == nil || !contentRequested(e.RequestInfo) {
+			return e.Next()
+		}
+
+		value, loaded := enrichBatches.LoadOrStore(e, &[]*core.Record{})
+		batch := value.(*[]*core.Record)
+		*batch = append(*batch, e.Record)
+
+		err := e.Next()
+		if loaded {
 			return err
 		}
+		enrichBatches.Delete(e)
+		if err != nil {
+			return err
+		}
+
+		return renderChapters(e.App, e.RequestInfo.Auth.Id, *batch)
+	})
 
-		chapter.Set("content", updatedHTML)
-		if err := e.App.Save(chapter); err != nil {
+	// highlights follow the text of a chapter when its content changes
+	app.OnRecordUpdate("chapters").BindFunc(func(e *core.RecordEvent) error {
+		changed := e.Record.GetString("content") != e.Record.Original().GetString("content")
+		if err := e.Next(); err != nil || !changed {
 			return err
 		}
 
-		return e.Next()
+		return reanchorChapter(e.App, e.Record)
 	})
 
+	initTags(app)
+	initImport(app)
+
+	app.RootCmd.AddCommand(anchorCommand(app))
+
 	return nil
 }
 
-func removeMarkTagWithText(htmlContent, targetText string) (string, error) {
-	doc, err := html.Parse(strings.NewReader(htmlContent))
+// AnchorHighlight finds the highlight's text in its chapter and stores where
+// it is, starting from the anchor the highlight already has. It returns
+// ErrNotAnchored if the text isn't in the chapter.
+func AnchorHighlight(app core.App, highlight *core.Record) error {
+	chapter, err := app.FindRecordById("chapters", highlight.GetString("chapter"))
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	var markTags []*html.Node
-	var collectMarkTags func(*html.Node)
-	collectMarkTags = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "mark" {
-			markTags = append(markTags, n)
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			collectMarkTags(c)
-		}
+	return anchorInChapter(highlight, chapter)
+}
+
+func anchorInChapter(highlight *core.Record, chapter *core.Record) error {
+	anchor, err := FindAnchor(chapter.GetString("content"), highlight.GetString("text"), AnchorFromRecord(highlight))
+	if err != nil {
+		return err
 	}
-	collectMarkTags(doc)
-
-	extractText := func(node *html.Node) string {
-		var textContent strings.Builder
-		var traverse func(*html.Node)
-		traverse = func(n *html.Node) {
-			if n.Type == html.TextNode {
-				textContent.WriteString(n.Data)
-			}
-			for c := n.FirstChild; c != nil; c = c.NextSibling {
-				traverse(c)
-			}
+	if anchor == nil {
+		return ErrNotAnchored
+	}
+
+	SetAnchor(highlight, anchor)
+	return nil
+}
+
+func AnchorFromRecord(highlight *core.Record) Anchor {
+	return Anchor{
+		Path:   highlight.GetString("path"),
+		Start:  highlight.GetInt("start"),
+		End:    highlight.GetInt("end"),
+		Prefix: highlight.GetString("prefix"),
+		Suffix: highlight.GetString("suffix"),
+	}
+}
+
+func SetAnchor(highlight *core.Record, anchor *Anchor) {
+	highlight.Set("path", anchor.Path)
+	highlight.Set("start", anchor.Start)
+	highlight.Set("end", anchor.End)
+	highlight.Set("prefix", anchor.Prefix)
+	highlight.Set("suffix", anchor.Suffix)
+}
+
+// anchorRequest anchors the highlight in a request to the chapter it is on,
+// which has to be one of the user's.
+func anchorRequest(e *core.RecordRequestEvent) error {
+	chapter, err := e.App.FindRecordById("chapters", e.Record.GetString("chapter"))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return e.NotFoundError("Chapter not found.", err)
+	case err != nil:
+		return e.InternalServerError("failed to get the chapter", err)
+	case !e.HasSuperuserAuth() && (e.Auth == nil || chapter.GetString("user") != e.Auth.Id):
+		return e.NotFoundError("Chapter not found.", nil)
+	}
+
+	err = anchorInChapter(e.Record, chapter)
+	switch {
+	case errors.Is(err, ErrNotAnchored):
+		return e.BadRequestError("The highlighted text wasn't found in the chapter.", err)
+	case err != nil:
+		return e.InternalServerError("failed to anchor the highlight", err)
+	}
+	return nil
+}
+
+// contentRequested reports whether the chapter's content is in the response,
+// which it isn't when the fields query parameter leaves it out.
+func contentRequested(info *core.RequestInfo) bool {
+	fields := info.Query["fields"]
+	if fields == "" {
+		return true
+	}
+
+	for _, field := range strings.Split(fields, ",") {
+		// fields can have a modifier, as in content:excerpt(200)
+		name := strings.TrimSpace(strings.SplitN(field, ":", 2)[0])
+		if name == "*" || name == "content" || strings.HasSuffix(name, ".*") || strings.HasSuffix(name, ".content") {
+			return true
 		}
-		traverse(node)
-		return textContent.String()
 	}
 
-	targetTextNormalized := strings.TrimSpace(strings.ReplaceAll(targetText, "\n", " "))
-	targetTextNormalized = strings.ReplaceAll(targetTextNormalized, "\r", "")
+	return false
+}
 
-	var marksToRemove []*html.Node
+// renderChapters puts the user's highlights in the content of the chapters,
+// loading the highlights of all of them with one query.
+func renderChapters(app core.App, userId string, chapters []*core.Record) error {
+	ids := make([]any, len(chapters))
+	for i, chapter := range chapters {
+		ids[i] = chapter.Id
+	}
 
-	for _, markTag := range markTags {
-		markText := strings.TrimSpace(extractText(markTag))
-		markTextNormalized := strings.ReplaceAll(markText, "\n", " ")
-		markTextNormalized = strings.ReplaceAll(markTextNormalized, "\r", "")
+	highlights := []*core.Record{}
+	err := app.RecordQuery("highlights").
+		AndWhere(dbx.HashExp{"user": userId, "chapter": ids}).
+		OrderBy("created ASC").
+		All(&highlights)
+	if err != nil {
+		return err
+	}
 
-		if strings.Contains(targetTextNormalized, markTextNormalized) && markTextNormalized != "" {
-			marksToRemove = append(marksToRemove, markTag)
+	marks := make(map[string][]Mark, len(chapters))
+	for _, highlight := range highlights {
+		if highlight.GetInt("end") > highlight.GetInt("start") {
+			chapterId := highlight.GetString("chapter")
+			marks[chapterId] = append(marks[chapterId], Mark{
+				Id:    highlight.Id,
+				Start: highlight.GetInt("start"),
+				End:   highlight.GetInt("end"),
+				Color: highlight.GetString("color"),
+			})
 		}
 	}
 
-	if len(marksToRemove) == 0 {
-		for i := 0; i < len(markTags); i++ {
-			var combinedText strings.Builder
-			var sequence []*html.Node
-
-			for j := i; j < len(markTags); j++ {
-				markText := strings.TrimSpace(extractText(markTags[j]))
-				if markText != "" {
-					if combinedText.Len() > 0 {
-						combinedText.WriteString(" ")
-					}
-					combinedText.WriteString(markText)
-					sequence = append(sequence, markTags[j])
-
-					combinedNormalized := strings.ReplaceAll(combinedText.String(), "\n", " ")
-					combinedNormalized = strings.ReplaceAll(combinedNormalized, "\r", "")
-
-					if strings.Contains(combinedNormalized, targetTextNormalized) ||
-						strings.Contains(targetTextNormalized, combinedNormalized) {
-						marksToRemove = append(marksToRemove, sequence...)
-						break
-					}
-				}
-			}
-			if len(marksToRemove) > 0 {
-				break
-			}
+	for _, chapter := range chapters {
+		if len(marks[chapter.Id]) == 0 {
+			continue
 		}
+
+		content, err := RenderHighlights(chapter.GetString("content"), marks[chapter.Id])
+		if err != nil {
+			return err
+		}
+		chapter.Set("content", content)
 	}
 
-	for _, markTag := range marksToRemove {
-		textContent := extractText(markTag)
-		if textContent != "" {
-			textNode := &html.Node{
-				Type: html.TextNode,
-				Data: textContent,
-			}
-			if markTag.Parent != nil {
-				markTag.Parent.InsertBefore(textNode, markTag)
-				markTag.Parent.RemoveChild(markTag)
-			}
-		} else {
-			if markTag.Parent != nil {
-				markTag.Parent.RemoveChild(markTag)
-			}
+	return nil
+}
+
+// reanchorChapter finds the highlights of the chapter again in its content.
+// Highlights whose text is no longer in the chapter keep their old anchor.
+func reanchorChapter(app core.App, chapter *core.Record) error {
+	highlights, err := app.FindAllRecords("highlights", dbx.HashExp{"chapter": chapter.Id})
+	if err != nil {
+		return err
+	}
+
+	for _, highlight := range highlights {
+		anchor, err := FindAnchor(chapter.GetString("content"), highlight.GetString("text"), AnchorFromRecord(highlight))
+		if err != nil {
+			return err
+		}
+		if anchor == nil || *anchor == AnchorFromRecord(highlight) {
+			continue
+		}
+
+		SetAnchor(highlight, anchor)
+		if err := app.Save(highlight); err != nil {
+			return err
 		}
 	}
 
-	var buf strings.Builder
-	html.Render(&buf, doc)
-	return buf.String(), nil
+	return nil
 }
@@ -0,0 +1,268 @@
+package highlight_hooks
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/list"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	defaultHighlightsPerPage = 50
+	maxHighlightsPerPage     = 200
+)
+
+// the colors a highlight can have, the same as the values of its color field
+var Colors = []string{"yellow", "green", "blue", "pink", "purple"}
+
+// ErrTagNotFound is returned when a highlight has a tag that doesn't exist or
+// isn't the user's.
+var ErrTagNotFound = errors.New("tag not found")
+
+type Tag struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// TagCount is one of the user's tags with the number of highlights that have
+// it.
+type TagCount struct {
+	Id    string `json:"id" db:"id"`
+	Name  string `json:"name" db:"name"`
+	Count int    `json:"count" db:"count"`
+}
+
+// LibraryHighlight is a highlight with the titles of its book and chapter.
+type LibraryHighlight struct {
+	Id           string         `json:"id"`
+	Book         string         `json:"book"`
+	BookTitle    string         `json:"bookTitle"`
+	Chapter      string         `json:"chapter"`
+	ChapterTitle string         `json:"chapterTitle"`
+	Text         string         `json:"text"`
+	Color        string         `json:"color"`
+	Note         string         `json:"note"`
+	Tags         []Tag          `json:"tags"`
+	Created      types.DateTime `json:"created"`
+}
+
+type HighlightList struct {
+	Page       int                `json:"page"`
+	PerPage    int                `json:"perPage"`
+	TotalItems int                `json:"totalItems"`
+	Items      []LibraryHighlight `json:"items"`
+}
+
+func initTags(app *pocketbase.PocketBase) {
+	checkRequestTags := func(e *core.RecordRequestEvent) error {
+		err := CheckTags(e.App, e.Record.GetString("user"), e.Record.GetStringSlice("tags"))
+		switch {
+		case errors.Is(err, ErrTagNotFound):
+			return e.BadRequestError("Tag not found.", nil)
+		case err != nil:
+			return e.InternalServerError("failed to check tags", err)
+		}
+		return e.Next()
+	}
+	app.OnRecordCreateRequest("highlights").BindFunc(checkRequestTags)
+	app.OnRecordUpdateRequest("highlights").BindFunc(checkRequestTags)
+
+	trimName := func(e *core.RecordRequestEvent) error {
+		e.Record.Set("name", strings.TrimSpace(e.Record.GetString("name")))
+		return e.Next()
+	}
+	app.OnRecordCreateRequest("tags").BindFunc(trimName)
+	app.OnRecordUpdateRequest("tags").BindFunc(trimName)
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.GET("/api/highlights", listHighlights).Bind(apis.RequireAuth())
+		se.Router.GET("/api/tags", listTags).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+}
+
+// CheckTags returns ErrTagNotFound unless all the tags are the user's.
+func CheckTags(app core.App, userId string, tagIds []string) error {
+	// the relation field drops repeated and empty ids, so they aren't an
+	// error here
+	tagIds = list.ToUniqueStringSlice(tagIds)
+	if len(tagIds) == 0 {
+		return nil
+	}
+
+	tags, err := app.FindRecordsByIds("tags", tagIds)
+	if err != nil {
+		return err
+	}
+	if len(tags) != len(tagIds) {
+		return ErrTagNotFound
+	}
+	for _, tag := range tags {
+		if tag.GetString("user") != userId {
+			return ErrTagNotFound
+		}
+	}
+
+	return nil
+}
+
+// listHighlights returns the user's highlights across their library, newest
+// first. They can be filtered by ?book=, by ?color=, where any of the colors
+// given matches, and by ?tag=, where a highlight needs all the tags given.
+func listHighlights(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+
+	page, err := queryInt(query.Get("page"), 1)
+	if err != nil || page < 1 {
+		return e.BadRequestError("page must be a positive number.", err)
+	}
+	perPage, err := queryInt(query.Get("perPage"), defaultHighlightsPerPage)
+	if err != nil || perPage < 1 || perPage > maxHighlightsPerPage {
+		return e.BadRequestError("perPage must be a number between 1 and 200.", err)
+	}
+
+	colors := query["color"]
+	for _, color := range colors {
+		if !slices.Contains(Colors, color) {
+			return e.BadRequestError("color must be one of "+strings.Join(Colors, ", ")+".", nil)
+		}
+	}
+
+	matches := func() *dbx.SelectQuery {
+		q := e.App.RecordQuery("highlights").AndWhere(dbx.HashExp{"highlights.user": e.Auth.Id})
+		if book := query.Get("book"); book != "" {
+			q.AndWhere(dbx.HashExp{"highlights.book": book})
+		}
+		if len(colors) > 0 {
+			values := make([]any, len(colors))
+			for i, color := range colors {
+				values[i] = color
+			}
+			q.AndWhere(dbx.In("highlights.color", values...))
+		}
+		for i, tag := range query["tag"] {
+			param := fmt.Sprintf("tag%d", i)
+			q.AndWhere(dbx.NewExp(
+				"EXISTS (SELECT 1 FROM json_each([[highlights.tags]]) WHERE [[value]] = {:"+param+"})",
+				dbx.Params{param: tag},
+			))
+		}
+		return q
+	}
+
+	var total int
+	if err := matches().Select("COUNT(*)").Row(&total); err != nil {
+		return e.InternalServerError("failed to load highlights", err)
+	}
+
+	highlights := []*core.Record{}
+	err = matches().
+		OrderBy("highlights.created DESC", "highlights.id DESC").
+		Limit(int64(perPage)).
+		Offset(int64((page - 1) * perPage)).
+		All(&highlights)
+	if err != nil {
+		return e.InternalServerError("failed to load highlights", err)
+	}
+
+	items, err := libraryHighlights(e.App, highlights)
+	if err != nil {
+		return e.InternalServerError("failed to load highlights", err)
+	}
+
+	return e.JSON(http.StatusOK, HighlightList{
+		Page:       page,
+		PerPage:    perPage,
+		TotalItems: total,
+		Items:      items,
+	})
+}
+
+// listTags returns the user's tags by name, with how many highlights have
+// each one.
+func listTags(e *core.RequestEvent) error {
+	tags := []TagCount{}
+	err := e.App.DB().
+		NewQuery(`SELECT [[tags.id]] AS id, [[tags.name]] AS name, (
+			SELECT COUNT(*) FROM {{highlights}}
+			WHERE [[highlights.user]] = [[tags.user]]
+			AND EXISTS (SELECT 1 FROM json_each([[highlights.tags]]) WHERE [[value]] = [[tags.id]])
+		) AS count
+		FROM {{tags}}
+		WHERE [[tags.user]] = {:user}
+		ORDER BY [[tags.name]] COLLATE NOCASE`).
+		Bind(dbx.Params{"user": e.Auth.Id}).
+		All(&tags)
+	if err != nil {
+		return e.InternalServerError("failed to load tags", err)
+	}
+
+	return e.JSON(http.StatusOK, tags)
+}
+
+func libraryHighlights(app core.App, highlights []*core.Record) ([]LibraryHighlight, error) {
+	titles := make(map[string]string)
+	title := func(collection, id string) string {
+		if t, ok := titles[id]; ok {
+			return t
+		}
+		if record, err := app.FindRecordById(collection, id); err == nil {
+			titles[id] = record.GetString("title")
+		}
+		return titles[id]
+	}
+
+	var tagIds []string
+	for _, highlight := range highlights {
+		tagIds = append(tagIds, highlight.GetStringSlice("tags")...)
+	}
+	tagRecords, err := app.FindRecordsByIds("tags", tagIds)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]Tag, len(tagRecords))
+	for _, tag := range tagRecords {
+		tags[tag.Id] = Tag{Id: tag.Id, Name: tag.GetString("name")}
+	}
+
+	items := make([]LibraryHighlight, 0, len(highlights))
+	for _, highlight := range highlights {
+		item := LibraryHighlight{
+			Id:           highlight.Id,
+			Book:         highlight.GetString("book"),
+			BookTitle:    title("books", highlight.GetString("book")),
+			Chapter:      highlight.GetString("chapter"),
+			ChapterTitle: title("chapters", highlight.GetString("chapter")),
+			Text:         highlight.GetString("text"),
+			Color:        highlight.GetString("color"),
+			Note:         highlight.GetString("note"),
+			Tags:         []Tag{},
+			Created:      highlight.GetDateTime("created"),
+		}
+		for _, id := range highlight.GetStringSlice("tags") {
+			if tag, ok := tags[id]; ok {
+				item.Tags = append(item.Tags, tag)
+			}
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func queryInt(raw string, fallback int) (int, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(raw)
+}
@@ -1,11 +1,30 @@
 package message_hooks
 
 import (
+	"errors"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/quota"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
 
 func Init(app *pocketbase.PocketBase) error {
+	app.OnRecordCreateRequest("messages").BindFunc(func(e *core.RecordRequestEvent) error {
+		if e.Auth == nil || e.HasSuperuserAuth() || e.Record.GetString("role") != "user" {
+			return e.Next()
+		}
+
+		if err := quota.CheckMessages(e.App, e.Auth, 1); err != nil {
+			var exceeded *quota.ExceededError
+			if errors.As(err, &exceeded) {
+				return e.ForbiddenError(exceeded.Message, nil)
+			}
+			return e.InternalServerError("failed to check message quota", err)
+		}
+
+		return e.Next()
+	})
+
 	app.OnRecordAfterCreateSuccess("messages").BindFunc(func(e *core.RecordEvent) error {
 		record, err := e.App.FindRecordById("chats", e.Record.GetString("chat"))
 		if err != nil {
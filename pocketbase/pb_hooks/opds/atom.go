@@ -0,0 +1,187 @@
+package opds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// OPDS 1.2 catalog, https://specs.opds.io/opds-1.2
+
+const (
+	acquisitionFeedType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	openSearchType      = "application/opensearchdescription+xml"
+)
+
+type atomFeed struct {
+	XMLName         xml.Name    `xml:"feed"`
+	Xmlns           string      `xml:"xmlns,attr"`
+	XmlnsDC         string      `xml:"xmlns:dc,attr"`
+	XmlnsOPDS       string      `xml:"xmlns:opds,attr"`
+	XmlnsOpenSearch string      `xml:"xmlns:opensearch,attr"`
+	Id              string      `xml:"id"`
+	Title           string      `xml:"title"`
+	Updated         string      `xml:"updated"`
+	TotalResults    int         `xml:"opensearch:totalResults"`
+	ItemsPerPage    int         `xml:"opensearch:itemsPerPage"`
+	StartIndex      int         `xml:"opensearch:startIndex"`
+	Links           []atomLink  `xml:"link"`
+	Entries         []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Id         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Authors    []atomAuthor   `xml:"author"`
+	Identifier string         `xml:"dc:identifier,omitempty"`
+	Publisher  string         `xml:"dc:publisher,omitempty"`
+	Language   string         `xml:"dc:language,omitempty"`
+	Issued     string         `xml:"dc:issued,omitempty"`
+	Summary    *atomText      `xml:"summary"`
+	Categories []atomCategory `xml:"category"`
+	Links      []atomLink     `xml:"link"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type atomLink struct {
+	Rel   string `xml:"rel,attr"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type openSearchDescription struct {
+	XMLName        xml.Name      `xml:"OpenSearchDescription"`
+	Xmlns          string        `xml:"xmlns,attr"`
+	ShortName      string        `xml:"ShortName"`
+	Description    string        `xml:"Description"`
+	InputEncoding  string        `xml:"InputEncoding"`
+	OutputEncoding string        `xml:"OutputEncoding"`
+	Url            openSearchUrl `xml:"Url"`
+}
+
+type openSearchUrl struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+func writeAtomFeed(e *core.RequestEvent, p *page) error {
+	feed := atomFeed{
+		Xmlns:           "http://www.w3.org/2005/Atom",
+		XmlnsDC:         "http://purl.org/dc/terms/",
+		XmlnsOPDS:       "http://opds-spec.org/2010/catalog",
+		XmlnsOpenSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		Id:              "urn:ai-reader:opds:" + e.Auth.Id,
+		Title:           "Library",
+		Updated:         time.Now().UTC().Format(time.RFC3339),
+		TotalResults:    p.total,
+		ItemsPerPage:    perPage,
+		StartIndex:      (p.number-1)*perPage + 1,
+		Entries:         make([]atomEntry, 0, len(p.books)),
+	}
+	if p.query != "" {
+		feed.Id += ":search"
+		feed.Title = fmt.Sprintf("Search results for %q", p.query)
+	}
+
+	feed.Links = []atomLink{
+		{Rel: "self", Href: pageURL(p, "", "q", p.number), Type: acquisitionFeedType},
+		{Rel: "start", Href: p.base, Type: acquisitionFeedType},
+		{Rel: "search", Href: p.base + "/opensearch.xml", Type: openSearchType},
+		{Rel: "search", Href: p.base + "/search?q={searchTerms}", Type: acquisitionFeedType},
+		{Rel: "first", Href: pageURL(p, "", "q", 1), Type: acquisitionFeedType},
+		{Rel: "last", Href: pageURL(p, "", "q", p.lastNumber()), Type: acquisitionFeedType},
+	}
+	if p.number > 1 {
+		feed.Links = append(feed.Links, atomLink{Rel: "previous", Href: pageURL(p, "", "q", p.number-1), Type: acquisitionFeedType})
+	}
+	if p.number < p.lastNumber() {
+		feed.Links = append(feed.Links, atomLink{Rel: "next", Href: pageURL(p, "", "q", p.number+1), Type: acquisitionFeedType})
+	}
+
+	for _, book := range p.books {
+		feed.Entries = append(feed.Entries, atomBookEntry(p, book))
+	}
+
+	return writeXML(e, acquisitionFeedType, feed)
+}
+
+func atomBookEntry(p *page, book *core.Record) atomEntry {
+	entry := atomEntry{
+		Id:        "urn:ai-reader:book:" + book.Id,
+		Title:     book.GetString("title"),
+		Updated:   book.GetDateTime("updated").Time().UTC().Format(time.RFC3339),
+		Language:  book.GetString("language"),
+		Publisher: book.GetString("publisher"),
+	}
+
+	if isbn := book.GetString("isbn"); isbn != "" {
+		entry.Identifier = "urn:isbn:" + isbn
+	}
+	if author := book.GetString("author"); author != "" {
+		entry.Authors = []atomAuthor{{Name: author}}
+	}
+	if date := book.GetDateTime("date"); !date.IsZero() {
+		entry.Issued = date.Time().Format(time.DateOnly)
+	}
+	if description := book.GetString("description"); description != "" {
+		entry.Summary = &atomText{Type: "text", Text: description}
+	}
+	if subject := book.GetString("subject"); subject != "" {
+		entry.Categories = []atomCategory{{Term: subject, Label: subject}}
+	}
+
+	entry.Links = []atomLink{{
+		Rel:  "http://opds-spec.org/acquisition",
+		Href: bookURL(p, book, "file"),
+		Type: fileType(book.GetString("file")),
+	}}
+	if cover := book.GetString("cover_image"); cover != "" {
+		entry.Links = append(entry.Links,
+			atomLink{Rel: "http://opds-spec.org/image", Href: bookURL(p, book, "cover"), Type: fileType(cover)},
+			atomLink{Rel: "http://opds-spec.org/image/thumbnail", Href: bookURL(p, book, "cover"), Type: fileType(cover)},
+		)
+	}
+
+	return entry
+}
+
+func writeOpenSearch(e *core.RequestEvent, base string) error {
+	return writeXML(e, openSearchType, openSearchDescription{
+		Xmlns:          "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:      "AI Reader",
+		Description:    "Search your library",
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		Url: openSearchUrl{
+			Type:     acquisitionFeedType,
+			Template: base + "/search?q={searchTerms}",
+		},
+	})
+}
+
+func writeXML(e *core.RequestEvent, contentType string, data any) error {
+	body, err := xml.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return e.InternalServerError("failed to render feed", err)
+	}
+
+	return e.Blob(http.StatusOK, contentType+";charset=utf-8", append([]byte(xml.Header), body...))
+}
@@ -0,0 +1,617 @@
+package opds
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/book_hooks"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+const maxFeedSize = 10 << 20
+
+// maxDownloadSize caps downloads when no other limit is given, at the size a
+// file field allows by default.
+const maxDownloadSize = core.DefaultFileFieldMaxSize
+
+const maxRedirects = 5
+
+// ErrPrivateAddress is returned for catalogs on loopback, private, link-local
+// and other addresses that aren't on the internet, unless they are allowed.
+var ErrPrivateAddress = errors.New("the catalog is on a private network address")
+
+// addresses that aren't covered by the checks of netip.Addr but aren't on the
+// internet either
+var reservedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// acquisitionExtensions gives a file name extension to downloads whose URL
+// and Content-Disposition don't have one, as is common with catalog servers.
+var acquisitionExtensions = map[string]string{
+	"application/epub+zip":  ".epub",
+	"application/pdf":       ".pdf",
+	"text/plain":            ".txt",
+	"text/markdown":         ".md",
+	"text/html":             ".html",
+	"application/xhtml+xml": ".xhtml",
+}
+
+// Client reads remote OPDS 1.2 and 2.0 catalogs, such as a Calibre content
+// server, with optional HTTP basic auth. Catalogs can only be on the internet,
+// or in AllowedNetworks.
+type Client struct {
+	HTTPClient      *http.Client
+	Username        string
+	Password        string
+	AllowedNetworks []netip.Prefix
+}
+
+// AllowedNetworks returns the networks in OPDS_ALLOWED_NETWORKS, a comma
+// separated list of addresses and CIDR ranges, such as 192.168.1.0/24, which
+// catalogs on the local network can be read from.
+func AllowedNetworks() []netip.Prefix {
+	var networks []netip.Prefix
+	for _, value := range strings.Split(os.Getenv("OPDS_ALLOWED_NETWORKS"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			networks = append(networks, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(value); err == nil {
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return networks
+}
+
+// RemoteFeed is a page of a remote catalog, in the same shape for both
+// versions of OPDS. All URLs are absolute.
+type RemoteFeed struct {
+	URL      string        `json:"url"`
+	Title    string        `json:"title"`
+	Entries  []RemoteEntry `json:"entries"`
+	Start    string        `json:"start,omitempty"`
+	Next     string        `json:"next,omitempty"`
+	Previous string        `json:"previous,omitempty"`
+	// Search is a URL template with a {searchTerms} placeholder.
+	Search string `json:"search,omitempty"`
+}
+
+// RemoteEntry is either a book with the links it can be acquired from, or a
+// link to another feed of the catalog.
+type RemoteEntry struct {
+	Id           string       `json:"id"`
+	Title        string       `json:"title"`
+	Author       string       `json:"author,omitempty"`
+	Summary      string       `json:"summary,omitempty"`
+	Cover        string       `json:"cover,omitempty"`
+	Acquisitions []RemoteLink `json:"acquisitions"`
+	Navigation   string       `json:"navigation,omitempty"`
+}
+
+type RemoteLink struct {
+	Href string `json:"href"`
+	Type string `json:"type"`
+}
+
+type remoteAtomFeed struct {
+	Title   string            `xml:"title"`
+	Links   []remoteAtomLink  `xml:"link"`
+	Entries []remoteAtomEntry `xml:"entry"`
+}
+
+type remoteAtomEntry struct {
+	Id      string `xml:"id"`
+	Title   string `xml:"title"`
+	Authors []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Summary string           `xml:"summary"`
+	Content string           `xml:"content"`
+	Links   []remoteAtomLink `xml:"link"`
+}
+
+type remoteAtomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type remoteOpenSearch struct {
+	Urls []struct {
+		Type     string `xml:"type,attr"`
+		Template string `xml:"template,attr"`
+	} `xml:"Url"`
+}
+
+type remoteJSONFeed struct {
+	Metadata struct {
+		Title string `json:"title"`
+	} `json:"metadata"`
+	Links        []remoteJSONLink `json:"links"`
+	Navigation   []remoteJSONLink `json:"navigation"`
+	Publications []struct {
+		Metadata struct {
+			Identifier  string          `json:"identifier"`
+			Title       string          `json:"title"`
+			Author      json.RawMessage `json:"author"`
+			Description string          `json:"description"`
+		} `json:"metadata"`
+		Links  []remoteJSONLink `json:"links"`
+		Images []remoteJSONLink `json:"images"`
+	} `json:"publications"`
+}
+
+type remoteJSONLink struct {
+	Rel   json.RawMessage `json:"rel"`
+	Href  string          `json:"href"`
+	Type  string          `json:"type"`
+	Title string          `json:"title"`
+}
+
+// rels returns the link's relations, which OPDS 2.0 allows to be a string or
+// a list of strings.
+func (l remoteJSONLink) rels() []string {
+	var rel string
+	if json.Unmarshal(l.Rel, &rel) == nil {
+		return []string{rel}
+	}
+	var rels []string
+	json.Unmarshal(l.Rel, &rels)
+	return rels
+}
+
+func (l remoteJSONLink) hasRel(prefix string) bool {
+	for _, rel := range l.rels() {
+		if strings.HasPrefix(rel, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Browse fetches and parses the catalog feed at feedURL.
+func (c *Client) Browse(ctx context.Context, feedURL string) (*RemoteFeed, error) {
+	res, err := c.get(ctx, feedURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxFeedSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// the final URL after redirects, which relative links are resolved against
+	base := res.Request.URL
+
+	contentType := res.Header.Get("Content-Type")
+	if strings.Contains(contentType, "json") || strings.HasPrefix(strings.TrimSpace(string(body)), "{") {
+		return parseJSONFeed(base, body)
+	}
+
+	feed, searchDescription, err := parseAtomFeed(base, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// OPDS 1.2 catalogs usually link to an OpenSearch description rather than
+	// to the search URL itself
+	if feed.Search == "" && searchDescription != "" {
+		feed.Search, err = c.openSearchTemplate(ctx, searchDescription)
+		if err != nil {
+			feed.Search = ""
+		}
+	}
+
+	return feed, nil
+}
+
+// Download fetches a book from an acquisition link, refusing files larger
+// than maxSize, or than maxDownloadSize if maxSize isn't positive.
+func (c *Client) Download(ctx context.Context, fileURL string, maxSize int64) (*filesystem.File, error) {
+	if maxSize <= 0 {
+		maxSize = maxDownloadSize
+	}
+
+	res, err := c.get(ctx, fileURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.ContentLength > maxSize {
+		return nil, errors.New("file is too large")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errors.New("file is too large")
+	}
+
+	return filesystem.NewFileFromBytes(data, downloadName(res))
+}
+
+func (c *Client) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("invalid catalog URL")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/atom+xml, application/opds+json, application/json;q=0.9, */*;q=0.8")
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("catalog responded with status %d", res.StatusCode)
+	}
+
+	return res, nil
+}
+
+// httpClient returns the client to make requests with. Hosts are resolved
+// and checked when connecting, so every redirect is checked as well, and
+// connections go to the checked address rather than resolving the host again.
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would be connected to instead of the catalog
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if !c.allowed(addr) {
+				return nil, ErrPrivateAddress
+			}
+		}
+
+		var dialErr error
+		for _, addr := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			dialErr = err
+		}
+		return nil, dialErr
+	}
+
+	return &http.Client{
+		Timeout:   60 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("invalid catalog URL")
+			}
+			return nil
+		},
+	}
+}
+
+// allowed reports whether the address is on the internet or in one of the
+// allowed networks.
+func (c *Client) allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, network := range c.AllowedNetworks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Client) openSearchTemplate(ctx context.Context, descriptionURL string) (string, error) {
+	res, err := c.get(ctx, descriptionURL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var description remoteOpenSearch
+	if err := xml.NewDecoder(io.LimitReader(res.Body, maxFeedSize)).Decode(&description); err != nil {
+		return "", err
+	}
+
+	var template string
+	for _, u := range description.Urls {
+		if strings.Contains(u.Type, "atom") {
+			template = u.Template
+			break
+		}
+		if template == "" {
+			template = u.Template
+		}
+	}
+	if template == "" {
+		return "", errors.New("no search URL in the OpenSearch description")
+	}
+
+	return resolveTemplate(res.Request.URL, template), nil
+}
+
+func parseAtomFeed(base *url.URL, body []byte) (*RemoteFeed, string, error) {
+	var atom remoteAtomFeed
+	if err := xml.Unmarshal(body, &atom); err != nil {
+		return nil, "", fmt.Errorf("not an OPDS feed: %w", err)
+	}
+
+	feed := &RemoteFeed{
+		URL:     base.String(),
+		Title:   strings.TrimSpace(atom.Title),
+		Entries: make([]RemoteEntry, 0, len(atom.Entries)),
+	}
+
+	var searchDescription string
+	for _, link := range atom.Links {
+		switch link.Rel {
+		case "start":
+			feed.Start = resolve(base, link.Href)
+		case "next":
+			feed.Next = resolve(base, link.Href)
+		case "previous", "prev":
+			feed.Previous = resolve(base, link.Href)
+		case "search":
+			if strings.Contains(link.Href, "{searchTerms}") {
+				feed.Search = resolveTemplate(base, link.Href)
+			} else {
+				searchDescription = resolve(base, link.Href)
+			}
+		}
+	}
+
+	for _, e := range atom.Entries {
+		entry := RemoteEntry{
+			Id:           strings.TrimSpace(e.Id),
+			Title:        strings.TrimSpace(e.Title),
+			Summary:      strings.TrimSpace(e.Summary),
+			Acquisitions: []RemoteLink{},
+		}
+		if entry.Summary == "" {
+			entry.Summary = strings.TrimSpace(e.Content)
+		}
+
+		var authors []string
+		for _, author := range e.Authors {
+			if name := strings.TrimSpace(author.Name); name != "" {
+				authors = append(authors, name)
+			}
+		}
+		entry.Author = strings.Join(authors, ", ")
+
+		for _, link := range e.Links {
+			switch {
+			case strings.HasPrefix(link.Rel, "http://opds-spec.org/acquisition"):
+				entry.Acquisitions = append(entry.Acquisitions, RemoteLink{Href: resolve(base, link.Href), Type: link.Type})
+			case link.Rel == "http://opds-spec.org/image" || link.Rel == "x-stanza-cover-image":
+				entry.Cover = resolve(base, link.Href)
+			case link.Rel == "http://opds-spec.org/image/thumbnail" && entry.Cover == "":
+				entry.Cover = resolve(base, link.Href)
+			case strings.Contains(link.Type, "profile=opds-catalog") && entry.Navigation == "":
+				entry.Navigation = resolve(base, link.Href)
+			}
+		}
+
+		// books also link to related feeds, such as other books by the author
+		if len(entry.Acquisitions) > 0 {
+			entry.Navigation = ""
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return feed, searchDescription, nil
+}
+
+func parseJSONFeed(base *url.URL, body []byte) (*RemoteFeed, error) {
+	var remote remoteJSONFeed
+	if err := json.Unmarshal(body, &remote); err != nil {
+		return nil, fmt.Errorf("not an OPDS feed: %w", err)
+	}
+
+	feed := &RemoteFeed{
+		URL:     base.String(),
+		Title:   remote.Metadata.Title,
+		Entries: make([]RemoteEntry, 0, len(remote.Navigation)+len(remote.Publications)),
+	}
+
+	for _, link := range remote.Links {
+		switch {
+		case link.hasRel("start"):
+			feed.Start = resolve(base, link.Href)
+		case link.hasRel("next"):
+			feed.Next = resolve(base, link.Href)
+		case link.hasRel("previous"), link.hasRel("prev"):
+			feed.Previous = resolve(base, link.Href)
+		case link.hasRel("search"):
+			feed.Search = resolveTemplate(base, link.Href)
+		}
+	}
+
+	for _, link := range remote.Navigation {
+		feed.Entries = append(feed.Entries, RemoteEntry{
+			Id:           resolve(base, link.Href),
+			Title:        link.Title,
+			Acquisitions: []RemoteLink{},
+			Navigation:   resolve(base, link.Href),
+		})
+	}
+
+	for _, publication := range remote.Publications {
+		entry := RemoteEntry{
+			Id:           publication.Metadata.Identifier,
+			Title:        publication.Metadata.Title,
+			Author:       contributorNames(publication.Metadata.Author),
+			Summary:      publication.Metadata.Description,
+			Acquisitions: []RemoteLink{},
+		}
+
+		for _, link := range publication.Links {
+			if link.hasRel("http://opds-spec.org/acquisition") {
+				entry.Acquisitions = append(entry.Acquisitions, RemoteLink{Href: resolve(base, link.Href), Type: link.Type})
+			}
+		}
+		if len(publication.Images) > 0 {
+			entry.Cover = resolve(base, publication.Images[0].Href)
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return feed, nil
+}
+
+// contributorNames returns the names of an OPDS 2.0 contributor, which can be
+// a string, an object with a name or a list of either.
+func contributorNames(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) != nil {
+		list = []json.RawMessage{raw}
+	}
+
+	var names []string
+	for _, item := range list {
+		var name string
+		if json.Unmarshal(item, &name) == nil {
+			names = append(names, name)
+			continue
+		}
+
+		var contributor struct {
+			Name json.RawMessage `json:"name"`
+		}
+		if json.Unmarshal(item, &contributor) != nil {
+			continue
+		}
+		if json.Unmarshal(contributor.Name, &name) == nil {
+			names = append(names, name)
+			continue
+		}
+
+		// a name translated into several languages
+		var translations map[string]string
+		if json.Unmarshal(contributor.Name, &translations) == nil {
+			for _, translation := range translations {
+				names = append(names, translation)
+				break
+			}
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func resolve(base *url.URL, href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return base.ResolveReference(u).String()
+}
+
+// resolveTemplate resolves a search URL template against base and turns the
+// {?query} form used by OPDS 2.0 into a {searchTerms} placeholder.
+func resolveTemplate(base *url.URL, template string) string {
+	if i := strings.Index(template, "{?query}"); i >= 0 {
+		prefix := template[:i]
+		separator := "?"
+		if strings.Contains(prefix, "?") {
+			separator = "&"
+		}
+		template = prefix + separator + "query={searchTerms}" + template[i+len("{?query}"):]
+	}
+
+	// keep the placeholder out of the URL parser, which would escape its braces
+	const placeholder = "SEARCHTERMS"
+	resolved := resolve(base, strings.ReplaceAll(template, "{searchTerms}", placeholder))
+	return strings.ReplaceAll(resolved, placeholder, "{searchTerms}")
+}
+
+// downloadName returns the name of a downloaded file, from its
+// Content-Disposition or URL, with an extension matching its content type.
+func downloadName(res *http.Response) string {
+	var name string
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil {
+		name = path.Base(params["filename"])
+	}
+	if name == "" || name == "." || name == "/" {
+		name = path.Base(res.Request.URL.Path)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "book"
+	}
+
+	if !book_hooks.IsBookFile(name) {
+		mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+		if ext, ok := acquisitionExtensions[mediaType]; ok {
+			name += ext
+		}
+	}
+
+	return name
+}
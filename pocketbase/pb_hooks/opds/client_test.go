@@ -0,0 +1,204 @@
+package opds
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+const testCatalog = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Test Catalog</title>
+  <link rel="start" href="/opds" type="application/atom+xml;profile=opds-catalog"/>
+  <link rel="next" href="/opds?page=2" type="application/atom+xml;profile=opds-catalog"/>
+  <link rel="search" href="/opds/search.xml" type="application/opensearchdescription+xml"/>
+  <entry>
+    <id>urn:book:1</id>
+    <title>A Book</title>
+    <author><name>An Author</name></author>
+    <summary>About the book.</summary>
+    <link rel="http://opds-spec.org/acquisition" href="/books/1/file" type="application/epub+zip"/>
+    <link rel="http://opds-spec.org/image" href="/books/1/cover.jpg" type="image/jpeg"/>
+  </entry>
+  <entry>
+    <id>urn:feed:authors</id>
+    <title>By Author</title>
+    <link rel="subsection" href="authors" type="application/atom+xml;profile=opds-catalog"/>
+  </entry>
+</feed>`
+
+const testOpenSearch = `<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+  <Url type="application/atom+xml" template="/opds/search?q={searchTerms}"/>
+</OpenSearchDescription>`
+
+func testCatalogServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/opds", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		io.WriteString(w, testCatalog)
+	})
+	mux.HandleFunc("/opds/search.xml", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testOpenSearch)
+	})
+	mux.HandleFunc("/books/1/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/epub+zip")
+		io.WriteString(w, "epub")
+	})
+	mux.HandleFunc("/books/2/file", func(w http.ResponseWriter, r *http.Request) {
+		// streamed, so there is no Content-Length to check up front
+		io.Copy(w, io.LimitReader(zeroReader{}, maxDownloadSize+1))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/opds", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// loopbackClient can read the test server, which listens on a loopback
+// address.
+func loopbackClient() *Client {
+	return &Client{AllowedNetworks: []netip.Prefix{
+		netip.MustParsePrefix("127.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}}
+}
+
+func TestClientBrowse(t *testing.T) {
+	server := testCatalogServer(t)
+
+	scenarios := []struct {
+		name string
+		url  string
+	}{
+		{"feed", server.URL + "/opds"},
+		{"redirected feed", server.URL + "/moved"},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			feed, err := loopbackClient().Browse(context.Background(), s.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if feed.Title != "Test Catalog" {
+				t.Errorf("expected title %q, got %q", "Test Catalog", feed.Title)
+			}
+			if feed.URL != server.URL+"/opds" {
+				t.Errorf("expected url %q, got %q", server.URL+"/opds", feed.URL)
+			}
+			if feed.Next != server.URL+"/opds?page=2" {
+				t.Errorf("expected next %q, got %q", server.URL+"/opds?page=2", feed.Next)
+			}
+			if feed.Search != server.URL+"/opds/search?q={searchTerms}" {
+				t.Errorf("expected search %q, got %q", server.URL+"/opds/search?q={searchTerms}", feed.Search)
+			}
+
+			if len(feed.Entries) != 2 {
+				t.Fatalf("expected 2 entries, got %d", len(feed.Entries))
+			}
+
+			book := feed.Entries[0]
+			if book.Title != "A Book" || book.Author != "An Author" {
+				t.Errorf("expected A Book by An Author, got %q by %q", book.Title, book.Author)
+			}
+			if len(book.Acquisitions) != 1 || book.Acquisitions[0].Href != server.URL+"/books/1/file" {
+				t.Errorf("expected the acquisition %q, got %v", server.URL+"/books/1/file", book.Acquisitions)
+			}
+			if book.Cover != server.URL+"/books/1/cover.jpg" {
+				t.Errorf("expected cover %q, got %q", server.URL+"/books/1/cover.jpg", book.Cover)
+			}
+
+			if navigation := feed.Entries[1].Navigation; navigation != server.URL+"/authors" {
+				t.Errorf("expected navigation %q, got %q", server.URL+"/authors", navigation)
+			}
+		})
+	}
+}
+
+func TestClientDownload(t *testing.T) {
+	server := testCatalogServer(t)
+
+	file, err := loopbackClient().Download(context.Background(), server.URL+"/books/1/file", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.OriginalName != "file.epub" {
+		t.Errorf("expected the file to be named file.epub, got %q", file.OriginalName)
+	}
+
+	if _, err := loopbackClient().Download(context.Background(), server.URL+"/books/1/file", 2); err == nil {
+		t.Error("expected a file larger than the limit to fail")
+	}
+
+	if _, err := loopbackClient().Download(context.Background(), server.URL+"/books/2/file", 0); err == nil {
+		t.Error("expected a file larger than the default limit to fail")
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestClientRejectsPrivateAddresses(t *testing.T) {
+	server := testCatalogServer(t)
+
+	scenarios := []struct {
+		name   string
+		client *Client
+		url    string
+	}{
+		{"loopback", &Client{}, server.URL + "/opds"},
+		{"localhost", &Client{}, "http://localhost:1/opds"},
+		{"private", &Client{}, "http://10.0.0.1:1/opds"},
+		{"cloud metadata", &Client{}, "http://169.254.169.254/latest/meta-data/"},
+		{"unspecified", &Client{}, "http://0.0.0.0:1/opds"},
+		{"ipv4 mapped loopback", &Client{}, "http://[::ffff:127.0.0.1]:1/opds"},
+		{"other network allowed", &Client{AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")}}, server.URL + "/opds"},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			_, err := s.client.Browse(context.Background(), s.url)
+			if !errors.Is(err, ErrPrivateAddress) {
+				t.Fatalf("expected ErrPrivateAddress, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClientRedirectLimit(t *testing.T) {
+	server := testCatalogServer(t)
+
+	if _, err := loopbackClient().Browse(context.Background(), server.URL+"/loop"); err == nil {
+		t.Fatal("expected endless redirects to fail")
+	}
+}
+
+func TestAllowedNetworks(t *testing.T) {
+	t.Setenv("OPDS_ALLOWED_NETWORKS", " 192.168.1.7/24, 10.0.0.5 ,invalid,")
+
+	networks := AllowedNetworks()
+	if len(networks) != 2 {
+		t.Fatalf("expected 2 networks, got %v", networks)
+	}
+	if networks[0].String() != "192.168.1.0/24" || networks[1].String() != "10.0.0.5/32" {
+		t.Errorf("expected 192.168.1.0/24 and 10.0.0.5/32, got %v", networks)
+	}
+}
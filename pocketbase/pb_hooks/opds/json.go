@@ -0,0 +1,135 @@
+package opds
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// OPDS 2.0 catalog, https://drafts.opds.io/opds-2.0
+
+const feedType = "application/opds+json"
+
+type Feed struct {
+	Metadata     FeedMetadata  `json:"metadata"`
+	Links        []Link        `json:"links"`
+	Publications []Publication `json:"publications"`
+}
+
+type FeedMetadata struct {
+	Title         string `json:"title"`
+	NumberOfItems int    `json:"numberOfItems"`
+	ItemsPerPage  int    `json:"itemsPerPage"`
+	CurrentPage   int    `json:"currentPage"`
+}
+
+type Link struct {
+	Rel       string `json:"rel,omitempty"`
+	Href      string `json:"href"`
+	Type      string `json:"type,omitempty"`
+	Templated bool   `json:"templated,omitempty"`
+}
+
+type Publication struct {
+	Metadata PublicationMetadata `json:"metadata"`
+	Links    []Link              `json:"links"`
+	Images   []Link              `json:"images,omitempty"`
+}
+
+type PublicationMetadata struct {
+	Type        string     `json:"@type"`
+	Identifier  string     `json:"identifier"`
+	Title       string     `json:"title"`
+	Author      string     `json:"author,omitempty"`
+	Publisher   string     `json:"publisher,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Language    string     `json:"language,omitempty"`
+	Subject     []string   `json:"subject,omitempty"`
+	Published   string     `json:"published,omitempty"`
+	Modified    string     `json:"modified"`
+	BelongsTo   *BelongsTo `json:"belongsTo,omitempty"`
+}
+
+type BelongsTo struct {
+	Series []Series `json:"series"`
+}
+
+type Series struct {
+	Name     string  `json:"name"`
+	Position float64 `json:"position,omitempty"`
+}
+
+func writeJSONFeed(e *core.RequestEvent, p *page) error {
+	feed := Feed{
+		Metadata: FeedMetadata{
+			Title:         "Library",
+			NumberOfItems: p.total,
+			ItemsPerPage:  perPage,
+			CurrentPage:   p.number,
+		},
+		Publications: make([]Publication, 0, len(p.books)),
+	}
+	if p.query != "" {
+		feed.Metadata.Title = fmt.Sprintf("Search results for %q", p.query)
+	}
+
+	feed.Links = []Link{
+		{Rel: "self", Href: pageURL(p, "/v2", "query", p.number), Type: feedType},
+		{Rel: "start", Href: p.base + "/v2", Type: feedType},
+		{Rel: "search", Href: p.base + "/v2/search{?query}", Type: feedType, Templated: true},
+		{Rel: "first", Href: pageURL(p, "/v2", "query", 1), Type: feedType},
+		{Rel: "last", Href: pageURL(p, "/v2", "query", p.lastNumber()), Type: feedType},
+	}
+	if p.number > 1 {
+		feed.Links = append(feed.Links, Link{Rel: "previous", Href: pageURL(p, "/v2", "query", p.number-1), Type: feedType})
+	}
+	if p.number < p.lastNumber() {
+		feed.Links = append(feed.Links, Link{Rel: "next", Href: pageURL(p, "/v2", "query", p.number+1), Type: feedType})
+	}
+
+	for _, book := range p.books {
+		feed.Publications = append(feed.Publications, bookPublication(p, book))
+	}
+
+	e.Response.Header().Set("Content-Type", feedType)
+	return e.JSON(http.StatusOK, feed)
+}
+
+func bookPublication(p *page, book *core.Record) Publication {
+	publication := Publication{
+		Metadata: PublicationMetadata{
+			Type:        "http://schema.org/Book",
+			Identifier:  "urn:ai-reader:book:" + book.Id,
+			Title:       book.GetString("title"),
+			Author:      book.GetString("author"),
+			Publisher:   book.GetString("publisher"),
+			Description: book.GetString("description"),
+			Language:    book.GetString("language"),
+			Modified:    book.GetDateTime("updated").Time().UTC().Format(time.RFC3339),
+		},
+		Links: []Link{{
+			Rel:  "http://opds-spec.org/acquisition",
+			Href: bookURL(p, book, "file"),
+			Type: fileType(book.GetString("file")),
+		}},
+	}
+
+	if subject := book.GetString("subject"); subject != "" {
+		publication.Metadata.Subject = []string{subject}
+	}
+	if series := book.GetString("series"); series != "" {
+		publication.Metadata.BelongsTo = &BelongsTo{
+			Series: []Series{{Name: series, Position: book.GetFloat("series_index")}},
+		}
+	}
+	if date := book.GetDateTime("date"); !date.IsZero() {
+		publication.Metadata.Published = date.Time().Format(time.DateOnly)
+	}
+	if cover := book.GetString("cover_image"); cover != "" {
+		publication.Images = []Link{{Href: bookURL(p, book, "cover"), Type: fileType(cover)}}
+	}
+
+	return publication
+}
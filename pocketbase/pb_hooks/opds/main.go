@@ -0,0 +1,383 @@
+package opds
+
+import (
+	"crypto/subtle"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/book_hooks"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/full_text_search"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/quota"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+const perPage = 25
+
+const feedKeyLength = 40
+
+// The catalog is served under /opds for requests authenticated with a
+// PocketBase token or HTTP basic auth (email and feed key), and under
+// /opds/keys/{key} for readers that can only be given a URL.
+var catalogBases = []string{"/opds", "/opds/keys/{key}"}
+
+var fileTypes = map[string]string{
+	".epub":     "application/epub+zip",
+	".pdf":      "application/pdf",
+	".txt":      "text/plain",
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".html":     "text/html",
+	".htm":      "text/html",
+	".xhtml":    "application/xhtml+xml",
+	".jpg":      "image/jpeg",
+	".jpeg":     "image/jpeg",
+	".png":      "image/png",
+	".gif":      "image/gif",
+	".webp":     "image/webp",
+}
+
+// remoteRequest is the body of requests to a remote catalog. The credentials
+// are only used for that request and never stored.
+type remoteRequest struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (r remoteRequest) client() *Client {
+	return &Client{Username: r.Username, Password: r.Password, AllowedNetworks: AllowedNetworks()}
+}
+
+type FeedKey struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// page is one page of the user's books, either all of them or the results
+// of a search.
+type page struct {
+	base   string
+	query  string
+	number int
+	total  int
+	books  []*core.Record
+}
+
+func (p *page) lastNumber() int {
+	if p.total == 0 {
+		return 1
+	}
+	return (p.total + perPage - 1) / perPage
+}
+
+func Init(app *pocketbase.PocketBase) error {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		for _, base := range catalogBases {
+			se.Router.GET(base, func(e *core.RequestEvent) error {
+				return listFeed(e, "", writeAtomFeed)
+			}).BindFunc(requireFeedUser)
+
+			se.Router.GET(base+"/search", func(e *core.RequestEvent) error {
+				return listFeed(e, e.Request.URL.Query().Get("q"), writeAtomFeed)
+			}).BindFunc(requireFeedUser)
+
+			se.Router.GET(base+"/opensearch.xml", func(e *core.RequestEvent) error {
+				return writeOpenSearch(e, catalogBase(e))
+			}).BindFunc(requireFeedUser)
+
+			se.Router.GET(base+"/v2", func(e *core.RequestEvent) error {
+				return listFeed(e, "", writeJSONFeed)
+			}).BindFunc(requireFeedUser)
+
+			se.Router.GET(base+"/v2/search", func(e *core.RequestEvent) error {
+				return listFeed(e, e.Request.URL.Query().Get("query"), writeJSONFeed)
+			}).BindFunc(requireFeedUser)
+
+			se.Router.GET(base+"/books/{id}/file", func(e *core.RequestEvent) error {
+				return serveBookFile(e, "file")
+			}).BindFunc(requireFeedUser)
+
+			se.Router.GET(base+"/books/{id}/cover", func(e *core.RequestEvent) error {
+				return serveBookFile(e, "cover_image")
+			}).BindFunc(requireFeedUser)
+		}
+
+		se.Router.GET("/api/opds", func(e *core.RequestEvent) error {
+			if e.Auth.GetString("opds_key") == "" {
+				if err := rotateFeedKey(e.App, e.Auth); err != nil {
+					return e.InternalServerError("failed to create feed key", err)
+				}
+			}
+
+			return e.JSON(http.StatusOK, feedKey(e.App, e.Auth))
+		}).Bind(apis.RequireAuth())
+
+		se.Router.POST("/api/opds/key", func(e *core.RequestEvent) error {
+			if err := rotateFeedKey(e.App, e.Auth); err != nil {
+				return e.InternalServerError("failed to rotate feed key", err)
+			}
+
+			return e.JSON(http.StatusOK, feedKey(e.App, e.Auth))
+		}).Bind(apis.RequireAuth())
+
+		se.Router.POST("/api/opds/browse", func(e *core.RequestEvent) error {
+			var body remoteRequest
+			if err := e.BindBody(&body); err != nil || body.URL == "" {
+				return e.BadRequestError("A catalog URL is required.", err)
+			}
+
+			feed, err := body.client().Browse(e.Request.Context(), body.URL)
+			switch {
+			case errors.Is(err, ErrPrivateAddress):
+				return e.ForbiddenError("The catalog is on a private network address.", err)
+			case err != nil:
+				return e.BadRequestError("Failed to read the catalog.", err)
+			}
+
+			return e.JSON(http.StatusOK, feed)
+		}).Bind(apis.RequireAuth())
+
+		se.Router.POST("/api/opds/import", func(e *core.RequestEvent) error {
+			var body remoteRequest
+			if err := e.BindBody(&body); err != nil || body.URL == "" {
+				return e.BadRequestError("An acquisition URL is required.", err)
+			}
+
+			booksCollection, err := e.App.FindCollectionByNameOrId("books")
+			if err != nil {
+				return e.InternalServerError("failed to get books collection", err)
+			}
+
+			var maxSize int64
+			if field, ok := booksCollection.Fields.GetByName("file").(*core.FileField); ok {
+				maxSize = field.MaxSize
+			}
+
+			file, err := body.client().Download(e.Request.Context(), body.URL, maxSize)
+			switch {
+			case errors.Is(err, ErrPrivateAddress):
+				return e.ForbiddenError("The catalog is on a private network address.", err)
+			case err != nil:
+				return e.BadRequestError("Failed to download the book.", err)
+			}
+
+			book, err := book_hooks.CreateBook(e.App, e.Auth, file)
+			if err != nil {
+				var duplicate *book_hooks.DuplicateBookError
+				var exceeded *quota.ExceededError
+				switch {
+				case errors.As(err, &duplicate):
+					return e.JSON(http.StatusConflict, map[string]any{
+						"status":  http.StatusConflict,
+						"message": duplicate.Error(),
+						"data":    map[string]any{},
+						"book":    duplicate.Book.Id,
+					})
+				case errors.As(err, &exceeded):
+					return e.ForbiddenError(exceeded.Message, nil)
+				default:
+					return e.BadRequestError("failed to import book", err)
+				}
+			}
+
+			return e.JSON(http.StatusOK, book)
+		}).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+
+	return nil
+}
+
+// requireFeedUser sets e.Auth to the user whose catalog is requested, from the
+// feed key in the path, a PocketBase token or HTTP basic auth with the user's
+// email and feed key.
+func requireFeedUser(e *core.RequestEvent) error {
+	if key := e.Request.PathValue("key"); key != "" {
+		user, err := e.App.FindFirstRecordByData("users", "opds_key", key)
+		if err != nil || user.GetBool("deleted") {
+			return e.UnauthorizedError("Invalid feed key.", err)
+		}
+		e.Auth = user
+		return e.Next()
+	}
+
+	if e.Auth != nil && e.Auth.Collection().Name == "users" {
+		return e.Next()
+	}
+
+	if email, key, ok := e.Request.BasicAuth(); ok && key != "" {
+		user, err := e.App.FindAuthRecordByEmail("users", email)
+		if err == nil && !user.GetBool("deleted") && subtle.ConstantTimeCompare([]byte(user.GetString("opds_key")), []byte(key)) == 1 {
+			e.Auth = user
+			return e.Next()
+		}
+	}
+
+	e.Response.Header().Set("WWW-Authenticate", `Basic realm="AI Reader"`)
+	return e.UnauthorizedError("The request requires a valid token or feed key.", nil)
+}
+
+// catalogBase returns the path the catalog was requested under, so that links
+// keep the feed key of the request.
+func catalogBase(e *core.RequestEvent) string {
+	if key := e.Request.PathValue("key"); key != "" {
+		return "/opds/keys/" + url.PathEscape(key)
+	}
+	return "/opds"
+}
+
+func listFeed(e *core.RequestEvent, query string, write func(*core.RequestEvent, *page) error) error {
+	number, _ := strconv.Atoi(e.Request.URL.Query().Get("page"))
+	if number < 1 {
+		number = 1
+	}
+
+	p := &page{
+		base:   catalogBase(e),
+		query:  strings.TrimSpace(query),
+		number: number,
+	}
+
+	var err error
+	if p.query == "" {
+		p.books, p.total, err = listBooks(e.App, e.Auth.Id, number)
+	} else {
+		p.books, p.total, err = searchBooks(e.App, e.Auth.Id, p.query, number)
+	}
+	if err != nil {
+		return e.InternalServerError("failed to get books", err)
+	}
+
+	return write(e, p)
+}
+
+func listBooks(app core.App, userId string, number int) ([]*core.Record, int, error) {
+	total, err := app.CountRecords("books", dbx.HashExp{"user": userId})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	books, err := app.FindRecordsByFilter("books", "user = {:user}", "-created", perPage, (number-1)*perPage, dbx.Params{"user": userId})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return books, int(total), nil
+}
+
+// searchBooks returns the user's books matching the query in the books_fts
+// table, best matches first.
+func searchBooks(app core.App, userId, query string, number int) ([]*core.Record, int, error) {
+	matches := func() *dbx.SelectQuery {
+		return app.RecordQuery("books").
+			InnerJoin("books_fts", dbx.NewExp("[[books_fts.id]] = [[books.id]]")).
+			AndWhere(dbx.HashExp{"books.user": userId}).
+			AndWhere(dbx.NewExp("books_fts MATCH {:q}", dbx.Params{"q": full_text_search.ProcessSearchQuery(query)}))
+	}
+
+	var total int
+	if err := matches().Select("COUNT(*)").Row(&total); err != nil {
+		return nil, 0, err
+	}
+
+	books := []*core.Record{}
+	err := matches().
+		OrderBy("books_fts.rank").
+		Limit(perPage).
+		Offset(int64((number - 1) * perPage)).
+		All(&books)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return books, total, nil
+}
+
+// serveBookFile serves one of the book's files, since the book file is
+// protected and e-readers can't request file tokens.
+func serveBookFile(e *core.RequestEvent, field string) error {
+	book, err := e.App.FindRecordById("books", e.Request.PathValue("id"))
+	if err != nil || book.GetString("user") != e.Auth.Id {
+		return e.NotFoundError("Book not found.", err)
+	}
+
+	name := book.GetString(field)
+	if name == "" {
+		return e.NotFoundError("File not found.", nil)
+	}
+
+	fsys, err := e.App.NewFilesystem()
+	if err != nil {
+		return e.InternalServerError("failed to open storage", err)
+	}
+	defer fsys.Close()
+
+	e.Response.Header().Set("Content-Type", fileType(name))
+	e.Response.Header().Set("Cache-Control", "private, max-age=3600")
+
+	if err := fsys.Serve(e.Response, e.Request, book.BaseFilesPath()+"/"+name, name); err != nil {
+		return e.NotFoundError("File not found.", err)
+	}
+
+	return nil
+}
+
+func rotateFeedKey(app core.App, user *core.Record) error {
+	user.Set("opds_key", security.RandomString(feedKeyLength))
+	return app.Save(user)
+}
+
+func feedKey(app core.App, user *core.Record) FeedKey {
+	key := user.GetString("opds_key")
+	baseURL := strings.TrimRight(app.Settings().Meta.AppURL, "/")
+
+	return FeedKey{
+		Key: key,
+		URL: baseURL + "/opds/keys/" + url.PathEscape(key),
+	}
+}
+
+// pageURL returns the URL of another page of the same listing.
+func pageURL(p *page, feedPath, queryParam string, number int) string {
+	params := url.Values{}
+	if p.query != "" {
+		params.Set(queryParam, p.query)
+	}
+	if number > 1 {
+		params.Set("page", strconv.Itoa(number))
+	}
+
+	u := p.base + feedPath
+	if p.query != "" {
+		u += "/search"
+	}
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	return u
+}
+
+func fileType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if t, ok := fileTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func bookURL(p *page, book *core.Record, file string) string {
+	return p.base + "/books/" + book.Id + "/" + file
+}
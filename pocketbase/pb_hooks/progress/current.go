@@ -0,0 +1,93 @@
+package progress
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultCurrentLimit = 10
+	maxCurrentLimit     = 50
+)
+
+// CurrentBook is a book on the user's currently reading list with their
+// position in it.
+type CurrentBook struct {
+	Position
+	Title      string  `json:"title"`
+	Author     string  `json:"author"`
+	Completion float64 `json:"completion"`
+}
+
+// currentlyReading returns the books the user opened, most recently opened
+// first, leaving out the ones they removed from the list.
+func currentlyReading(e *core.RequestEvent) error {
+	limit := defaultCurrentLimit
+	if raw := e.Request.URL.Query().Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxCurrentLimit {
+			return e.BadRequestError("limit must be a number between 1 and 50.", err)
+		}
+	}
+
+	records, err := e.App.FindRecordsByFilter(
+		"reading_positions",
+		"user = {:user} && opened != '' && removed = false",
+		"-opened",
+		limit,
+		0,
+		dbx.Params{"user": e.Auth.Id},
+	)
+	if err != nil {
+		return e.InternalServerError("failed to load currently reading books", err)
+	}
+
+	result := make([]CurrentBook, 0, len(records))
+	for _, record := range records {
+		book, err := e.App.FindRecordById("books", record.GetString("book"))
+		if err != nil || book.GetString("user") != e.Auth.Id {
+			continue
+		}
+
+		chapters, err := bookChapterLengths(e.App, book.Id)
+		if err != nil {
+			return e.InternalServerError("failed to load currently reading books", err)
+		}
+
+		position := ResumePosition(e.App, e.Auth.Id, book)
+		position.Opened = record.GetString("opened")
+
+		result = append(result, CurrentBook{
+			Position:   *position,
+			Title:      book.GetString("title"),
+			Author:     book.GetString("author"),
+			Completion: bookCompletion(chapters, position),
+		})
+	}
+
+	return e.JSON(http.StatusOK, result)
+}
+
+// removeFromCurrentlyReading takes the book off the currently reading list
+// while keeping the position. Opening the book again puts it back.
+func removeFromCurrentlyReading(e *core.RequestEvent) error {
+	record, err := e.App.FindFirstRecordByFilter(
+		"reading_positions",
+		"user = {:user} && book = {:book}",
+		dbx.Params{"user": e.Auth.Id, "book": e.Request.PathValue("book")},
+	)
+	if err != nil {
+		return e.NotFoundError("Book not found.", err)
+	}
+
+	record.Set("removed", true)
+	if err := e.App.Save(record); err != nil {
+		return e.InternalServerError("failed to remove book from currently reading", err)
+	}
+
+	return e.NoContent(http.StatusNoContent)
+}
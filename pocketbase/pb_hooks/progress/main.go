@@ -0,0 +1,268 @@
+package progress
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// how far ahead of the server a device's clock may be before its timestamps
+// are capped, so one device with a wrong clock can't lock out the others
+const MaxClockSkew = time.Minute
+
+// a CFI-like path of child element indexes from the chapter body, e.g. /4/2/1
+var pathRegex = regexp.MustCompile(`^(/\d+)*$`)
+
+// ErrNotFound is returned when the book or chapter of a position doesn't exist
+// or isn't the user's.
+var ErrNotFound = errors.New("not found")
+
+// Position is where the user is in a book. Timestamp is the time the position
+// was reached on the device, in milliseconds since the epoch, and a position
+// only replaces one with an older timestamp. Opened is when the user last
+// opened the book.
+type Position struct {
+	Book       string  `json:"book"`
+	Chapter    string  `json:"chapter"`
+	Path       string  `json:"path"`
+	NodeIndex  int     `json:"nodeIndex"`
+	Offset     int     `json:"offset"`
+	Percentage float64 `json:"percentage"`
+	Timestamp  int64   `json:"timestamp"`
+	Device     string  `json:"device"`
+	Opened     string  `json:"opened,omitempty"`
+}
+
+func Init(app *pocketbase.PocketBase) error {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		// returns the position in ?book=, or in the book opened last
+		se.Router.GET("/api/progress", func(e *core.RequestEvent) error {
+			bookId := e.Request.URL.Query().Get("book")
+			if bookId == "" {
+				bookId = LastOpenedBook(e.App, e.Auth.Id)
+				if bookId == "" {
+					return e.NotFoundError("No book has been read yet.", nil)
+				}
+			}
+
+			book, err := e.App.FindRecordById("books", bookId)
+			if err != nil || book.GetString("user") != e.Auth.Id {
+				return e.NotFoundError("Book not found.", err)
+			}
+
+			return e.JSON(http.StatusOK, ResumePosition(e.App, e.Auth.Id, book))
+		}).Bind(apis.RequireAuth())
+
+		se.Router.PUT("/api/progress", func(e *core.RequestEvent) error {
+			var position Position
+			if err := e.BindBody(&position); err != nil {
+				return e.BadRequestError("invalid reading position", err)
+			}
+
+			if err := ValidatePosition(position); err != nil {
+				return e.BadRequestError(err.Error(), nil)
+			}
+
+			var current *Position
+			var saved bool
+			err := e.App.RunInTransaction(func(txApp core.App) error {
+				var err error
+				current, saved, err = SavePosition(txApp, e.Auth.Id, position)
+				return err
+			})
+			switch {
+			case errors.Is(err, ErrNotFound):
+				return e.NotFoundError("Book or chapter not found.", nil)
+			case err != nil:
+				return e.InternalServerError("failed to save reading position", err)
+			case !saved:
+				// a newer position was saved from another device
+				return e.JSON(http.StatusConflict, current)
+			}
+
+			return e.JSON(http.StatusOK, current)
+		}).Bind(apis.RequireAuth())
+
+		se.Router.GET("/api/progress/current", currentlyReading).Bind(apis.RequireAuth())
+		se.Router.DELETE("/api/progress/current/{book}", removeFromCurrentlyReading).Bind(apis.RequireAuth())
+
+		se.Router.POST("/api/sessions/heartbeat", heartbeat).Bind(apis.RequireAuth())
+		se.Router.GET("/api/stats", stats).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+
+	return nil
+}
+
+// ValidatePosition checks a position sent by a client.
+func ValidatePosition(position Position) error {
+	switch {
+	case position.Book == "" || position.Chapter == "":
+		return errors.New("book and chapter are required")
+	case len(position.Path) > 512 || !pathRegex.MatchString(position.Path):
+		return errors.New("path must be a list of element indexes, such as /4/2/1")
+	case position.NodeIndex < 0 || position.Offset < 0:
+		return errors.New("nodeIndex and offset can't be negative")
+	case position.Percentage < 0 || position.Percentage > 100:
+		return errors.New("percentage must be between 0 and 100")
+	case position.Timestamp <= 0:
+		return errors.New("timestamp is required")
+	case len(position.Device) > 100:
+		return errors.New("device can't be longer than 100 characters")
+	}
+	return nil
+}
+
+// SavePosition saves the position unless the stored one is at least as new,
+// and returns the position stored afterwards and whether it was saved.
+func SavePosition(app core.App, userId string, position Position) (*Position, bool, error) {
+	book, err := app.FindRecordById("books", position.Book)
+	if err != nil || book.GetString("user") != userId {
+		return nil, false, ErrNotFound
+	}
+
+	chapter, err := app.FindRecordById("chapters", position.Chapter)
+	if err != nil || chapter.GetString("book") != book.Id {
+		return nil, false, ErrNotFound
+	}
+
+	if limit := time.Now().Add(MaxClockSkew).UnixMilli(); position.Timestamp > limit {
+		position.Timestamp = limit
+	}
+
+	record, err := findPosition(app, userId, book.Id)
+	if err != nil {
+		return nil, false, err
+	}
+	if !record.IsNew() && int64(record.GetInt("timestamp")) >= position.Timestamp {
+		return PositionFromRecord(record), false, nil
+	}
+
+	record.Set("chapter", position.Chapter)
+	record.Set("path", position.Path)
+	record.Set("node_index", position.NodeIndex)
+	record.Set("offset", position.Offset)
+	record.Set("percentage", position.Percentage)
+	record.Set("timestamp", position.Timestamp)
+	record.Set("device", position.Device)
+	record.Set("opened", types.NowDateTime())
+	record.Set("removed", false)
+	if err := app.Save(record); err != nil {
+		return nil, false, err
+	}
+
+	return PositionFromRecord(record), true, nil
+}
+
+// ResumePosition returns the user's position in the book, or the start of
+// the book if no position was saved yet.
+func ResumePosition(app core.App, userId string, book *core.Record) *Position {
+	record, err := app.FindFirstRecordByFilter(
+		"reading_positions",
+		"user = {:user} && book = {:book}",
+		dbx.Params{"user": userId, "book": book.Id},
+	)
+	if err == nil && record.GetString("chapter") != "" {
+		return PositionFromRecord(record)
+	}
+
+	position := &Position{Book: book.Id}
+	if chapters := book.GetStringSlice("chapters"); len(chapters) > 0 {
+		position.Chapter = chapters[0]
+	}
+	return position
+}
+
+// OpenBook records that the user opened the book, or the chapter of it if
+// chapterId is set, and puts the book back on their currently reading list.
+// Opening another chapter than the saved one moves the position to the start
+// of that chapter. The timestamp is left as it is: it comes from the device
+// clocks, so a server time here could reject the positions of a device whose
+// clock is behind.
+func OpenBook(app core.App, userId string, book *core.Record, chapterId string) error {
+	record, err := findPosition(app, userId, book.Id)
+	if err != nil {
+		return err
+	}
+
+	if chapterId == "" && record.GetString("chapter") == "" {
+		if chapters := book.GetStringSlice("chapters"); len(chapters) > 0 {
+			chapterId = chapters[0]
+		}
+	}
+
+	if chapterId != "" && chapterId != record.GetString("chapter") {
+		record.Set("chapter", chapterId)
+		record.Set("path", "")
+		record.Set("node_index", 0)
+		record.Set("offset", 0)
+		record.Set("percentage", 0)
+		record.Set("device", "")
+	}
+
+	record.Set("opened", types.NowDateTime())
+	record.Set("removed", false)
+	return app.Save(record)
+}
+
+// LastOpenedBook returns the id of the book the user opened last, or an empty
+// string if they haven't opened any.
+func LastOpenedBook(app core.App, userId string) string {
+	records, err := app.FindRecordsByFilter(
+		"reading_positions",
+		"user = {:user} && opened != ''",
+		"-opened",
+		1,
+		0,
+		dbx.Params{"user": userId},
+	)
+	if err != nil || len(records) == 0 {
+		return ""
+	}
+	return records[0].GetString("book")
+}
+
+// findPosition returns the user's position record for the book, or a new
+// unsaved one if there is none yet.
+func findPosition(app core.App, userId, bookId string) (*core.Record, error) {
+	record, err := app.FindFirstRecordByFilter(
+		"reading_positions",
+		"user = {:user} && book = {:book}",
+		dbx.Params{"user": userId, "book": bookId},
+	)
+	if err == nil {
+		return record, nil
+	}
+
+	collection, err := app.FindCollectionByNameOrId("reading_positions")
+	if err != nil {
+		return nil, err
+	}
+
+	record = core.NewRecord(collection)
+	record.Set("user", userId)
+	record.Set("book", bookId)
+	return record, nil
+}
+
+func PositionFromRecord(record *core.Record) *Position {
+	return &Position{
+		Book:       record.GetString("book"),
+		Chapter:    record.GetString("chapter"),
+		Path:       record.GetString("path"),
+		NodeIndex:  record.GetInt("node_index"),
+		Offset:     record.GetInt("offset"),
+		Percentage: record.GetFloat("percentage"),
+		Timestamp:  int64(record.GetInt("timestamp")),
+		Device:     record.GetString("device"),
+		Opened:     record.GetString("opened"),
+	}
+}
@@ -0,0 +1,189 @@
+package progress
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// a heartbeat more than this long after the previous one starts a new session
+const sessionIdleTimeout = 5 * time.Minute
+
+type heartbeatRequest struct {
+	Book       string  `json:"book"`
+	Chapter    string  `json:"chapter"`
+	Percentage float64 `json:"percentage"`
+	Device     string  `json:"device"`
+}
+
+type Session struct {
+	Id              string  `json:"id"`
+	Book            string  `json:"book"`
+	Chapter         string  `json:"chapter"`
+	StartChapter    string  `json:"startChapter"`
+	StartPercentage float64 `json:"startPercentage"`
+	EndPercentage   float64 `json:"endPercentage"`
+	Started         string  `json:"started"`
+	Ended           string  `json:"ended"`
+	Duration        int     `json:"duration"`
+	Words           int     `json:"words"`
+	Device          string  `json:"device"`
+}
+
+// chapterLength is the word count of a chapter, in reading order.
+type chapterLength struct {
+	id    string
+	words int
+}
+
+func heartbeat(e *core.RequestEvent) error {
+	var request heartbeatRequest
+	if err := e.BindBody(&request); err != nil {
+		return e.BadRequestError("invalid heartbeat", err)
+	}
+
+	switch {
+	case request.Book == "" || request.Chapter == "":
+		return e.BadRequestError("book and chapter are required", nil)
+	case request.Percentage < 0 || request.Percentage > 100:
+		return e.BadRequestError("percentage must be between 0 and 100", nil)
+	case len(request.Device) > 100:
+		return e.BadRequestError("device can't be longer than 100 characters", nil)
+	}
+
+	var session *core.Record
+	err := e.App.RunInTransaction(func(txApp core.App) error {
+		var err error
+		session, err = recordHeartbeat(txApp, e.Auth.Id, request, time.Now().UTC())
+		return err
+	})
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return e.NotFoundError("Book or chapter not found.", nil)
+	case err != nil:
+		return e.InternalServerError("failed to save reading session", err)
+	}
+
+	return e.JSON(http.StatusOK, SessionFromRecord(session))
+}
+
+// recordHeartbeat extends the user's session in the book on the device, or
+// starts a new one if the last heartbeat is too old. Only the time between
+// heartbeats of a session counts as reading.
+func recordHeartbeat(app core.App, userId string, request heartbeatRequest, now time.Time) (*core.Record, error) {
+	book, err := app.FindRecordById("books", request.Book)
+	if err != nil || book.GetString("user") != userId {
+		return nil, ErrNotFound
+	}
+
+	chapter, err := app.FindRecordById("chapters", request.Chapter)
+	if err != nil || chapter.GetString("book") != book.Id {
+		return nil, ErrNotFound
+	}
+
+	sessions := []*core.Record{}
+	err = app.RecordQuery("reading_sessions").
+		AndWhere(dbx.HashExp{"user": userId, "book": book.Id, "device": request.Device}).
+		AndWhere(dbx.NewExp("[[ended]] >= {:since}", dbx.Params{"since": now.Add(-sessionIdleTimeout).Format(types.DefaultDateLayout)})).
+		OrderBy("ended DESC").
+		Limit(1).
+		All(&sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	var session *core.Record
+	if len(sessions) > 0 {
+		session = sessions[0]
+		elapsed := now.Sub(session.GetDateTime("ended").Time())
+		if elapsed > 0 {
+			session.Set("duration", session.GetInt("duration")+int(elapsed.Seconds()))
+		}
+	} else {
+		collection, err := app.FindCollectionByNameOrId("reading_sessions")
+		if err != nil {
+			return nil, err
+		}
+
+		session = core.NewRecord(collection)
+		session.Set("user", userId)
+		session.Set("book", book.Id)
+		session.Set("device", request.Device)
+		session.Set("started", now)
+		session.Set("start_chapter", chapter.Id)
+		session.Set("start_percentage", request.Percentage)
+	}
+
+	session.Set("ended", now)
+	session.Set("chapter", chapter.Id)
+	session.Set("end_percentage", request.Percentage)
+
+	chapters, err := bookChapterLengths(app, book.Id)
+	if err != nil {
+		return nil, err
+	}
+	start, _ := wordsBefore(chapters, session.GetString("start_chapter"), session.GetFloat("start_percentage"))
+	end, _ := wordsBefore(chapters, chapter.Id, request.Percentage)
+	session.Set("words", max(0, int(end-start)))
+
+	if err := app.Save(session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func bookChapterLengths(app core.App, bookId string) ([]chapterLength, error) {
+	var rows []struct {
+		Id        string `db:"id"`
+		WordCount int    `db:"word_count"`
+	}
+	err := app.DB().
+		Select("id", "word_count").
+		From("chapters").
+		Where(dbx.HashExp{"book": bookId}).
+		OrderBy("[[order]] ASC").
+		All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := make([]chapterLength, 0, len(rows))
+	for _, row := range rows {
+		chapters = append(chapters, chapterLength{id: row.Id, words: row.WordCount})
+	}
+	return chapters, nil
+}
+
+// wordsBefore returns the number of words of the book before the percentage
+// of the chapter.
+func wordsBefore(chapters []chapterLength, chapterId string, percentage float64) (float64, bool) {
+	words := 0.0
+	for _, chapter := range chapters {
+		if chapter.id == chapterId {
+			return words + float64(chapter.words)*percentage/100, true
+		}
+		words += float64(chapter.words)
+	}
+	return 0, false
+}
+
+func SessionFromRecord(record *core.Record) Session {
+	return Session{
+		Id:              record.Id,
+		Book:            record.GetString("book"),
+		Chapter:         record.GetString("chapter"),
+		StartChapter:    record.GetString("start_chapter"),
+		StartPercentage: record.GetFloat("start_percentage"),
+		EndPercentage:   record.GetFloat("end_percentage"),
+		Started:         record.GetDateTime("started").String(),
+		Ended:           record.GetDateTime("ended").String(),
+		Duration:        record.GetInt("duration"),
+		Words:           record.GetInt("words"),
+		Device:          record.GetString("device"),
+	}
+}
@@ -0,0 +1,286 @@
+package progress
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// words of a printed page, used to report pages read
+	wordsPerPage = 250
+
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+type Stats struct {
+	Days     []Period     `json:"days"`
+	Weeks    []Period     `json:"weeks"`
+	Sessions SessionStats `json:"sessions"`
+	Streak   Streak       `json:"streak"`
+	Books    []BookStats  `json:"books"`
+}
+
+// Period is the reading done in a day, or in a week starting on Monday.
+type Period struct {
+	Start    string `json:"start"`
+	Seconds  int    `json:"seconds"`
+	Words    int    `json:"words"`
+	Sessions int    `json:"sessions"`
+}
+
+type SessionStats struct {
+	Count          int     `json:"count"`
+	Seconds        int     `json:"seconds"`
+	Words          int     `json:"words"`
+	AverageSeconds float64 `json:"averageSeconds"`
+	AverageWords   float64 `json:"averageWords"`
+	AveragePages   float64 `json:"averagePages"`
+}
+
+// Streak counts consecutive days with reading. The current streak includes
+// today, or yesterday if nothing was read yet today.
+type Streak struct {
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+}
+
+type BookStats struct {
+	Book       string  `json:"book"`
+	Title      string  `json:"title"`
+	Percentage float64 `json:"percentage"`
+	Seconds    int     `json:"seconds"`
+	LastRead   string  `json:"lastRead,omitempty"`
+}
+
+// stats returns the reading of the last ?days= days, 30 by default, in the
+// ?tz= time zone, UTC by default.
+func stats(e *core.RequestEvent) error {
+	days := defaultStatsDays
+	if raw := e.Request.URL.Query().Get("days"); raw != "" {
+		var err error
+		days, err = strconv.Atoi(raw)
+		if err != nil || days < 1 || days > maxStatsDays {
+			return e.BadRequestError("days must be a number between 1 and 366.", err)
+		}
+	}
+
+	location := time.UTC
+	if tz := e.Request.URL.Query().Get("tz"); tz != "" {
+		var err error
+		location, err = time.LoadLocation(tz)
+		if err != nil {
+			return e.BadRequestError("Unknown time zone.", err)
+		}
+	}
+
+	result, err := userStats(e.App, e.Auth.Id, time.Now().In(location), days)
+	if err != nil {
+		return e.InternalServerError("failed to compute reading stats", err)
+	}
+
+	return e.JSON(http.StatusOK, result)
+}
+
+func userStats(app core.App, userId string, now time.Time, days int) (*Stats, error) {
+	location := now.Location()
+	today := startOfDay(now)
+	from := today.AddDate(0, 0, -(days - 1))
+
+	result := &Stats{
+		Days:  make([]Period, days),
+		Weeks: []Period{},
+		Books: []BookStats{},
+	}
+
+	dayIndex := make(map[string]int, days)
+	weekIndex := make(map[string]int)
+	for i := range days {
+		day := from.AddDate(0, 0, i)
+		result.Days[i] = Period{Start: day.Format(time.DateOnly)}
+		dayIndex[result.Days[i].Start] = i
+
+		week := startOfWeek(day).Format(time.DateOnly)
+		if _, ok := weekIndex[week]; !ok {
+			weekIndex[week] = len(result.Weeks)
+			result.Weeks = append(result.Weeks, Period{Start: week})
+		}
+	}
+
+	sessions, err := app.FindRecordsByFilter(
+		"reading_sessions",
+		"user = {:user} && started >= {:from}",
+		"started",
+		0,
+		0,
+		dbx.Params{"user": userId, "from": from.UTC().Format(types.DefaultDateLayout)},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		started := session.GetDateTime("started").Time().In(location)
+		seconds := session.GetInt("duration")
+		words := session.GetInt("words")
+
+		if i, ok := dayIndex[started.Format(time.DateOnly)]; ok {
+			result.Days[i].Seconds += seconds
+			result.Days[i].Words += words
+			result.Days[i].Sessions++
+		}
+		if i, ok := weekIndex[startOfWeek(started).Format(time.DateOnly)]; ok {
+			result.Weeks[i].Seconds += seconds
+			result.Weeks[i].Words += words
+			result.Weeks[i].Sessions++
+		}
+
+		result.Sessions.Count++
+		result.Sessions.Seconds += seconds
+		result.Sessions.Words += words
+	}
+
+	if result.Sessions.Count > 0 {
+		count := float64(result.Sessions.Count)
+		result.Sessions.AverageSeconds = float64(result.Sessions.Seconds) / count
+		result.Sessions.AverageWords = float64(result.Sessions.Words) / count
+		result.Sessions.AveragePages = result.Sessions.AverageWords / wordsPerPage
+	}
+
+	result.Streak, err = readingStreak(app, userId, today)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Books, err = bookStats(app, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// readingStreak counts the streaks over every session of the user, as they
+// can go back further than the requested days.
+func readingStreak(app core.App, userId string, today time.Time) (Streak, error) {
+	var started []string
+	err := app.DB().
+		Select("started").
+		From("reading_sessions").
+		Where(dbx.HashExp{"user": userId}).
+		AndWhere(dbx.NewExp("duration > 0")).
+		OrderBy("started").
+		Column(&started)
+	if err != nil {
+		return Streak{}, err
+	}
+
+	var streak Streak
+	var last time.Time
+	run := 0
+	for _, raw := range started {
+		date, err := types.ParseDateTime(raw)
+		if err != nil {
+			continue
+		}
+
+		day := startOfDay(date.Time().In(today.Location()))
+		switch {
+		case day.Equal(last):
+			continue
+		case !last.IsZero() && day.Equal(last.AddDate(0, 0, 1)):
+			run++
+		default:
+			run = 1
+		}
+		last = day
+		streak.Longest = max(streak.Longest, run)
+	}
+
+	if last.Equal(today) || last.Equal(today.AddDate(0, 0, -1)) {
+		streak.Current = run
+	}
+
+	return streak, nil
+}
+
+// bookStats returns the completion of every book the user has read, from
+// their reading position.
+func bookStats(app core.App, userId string) ([]BookStats, error) {
+	var totals []struct {
+		Book     string `db:"book"`
+		Seconds  int    `db:"seconds"`
+		LastRead string `db:"last_read"`
+	}
+	err := app.DB().
+		Select("book", "SUM(duration) AS seconds", "MAX(ended) AS last_read").
+		From("reading_sessions").
+		Where(dbx.HashExp{"user": userId}).
+		GroupBy("book").
+		OrderBy("last_read DESC").
+		All(&totals)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]BookStats, 0, len(totals))
+	for _, total := range totals {
+		book, err := app.FindRecordById("books", total.Book)
+		if err != nil {
+			continue
+		}
+
+		chapters, err := bookChapterLengths(app, book.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, BookStats{
+			Book:       book.Id,
+			Title:      book.GetString("title"),
+			Percentage: bookCompletion(chapters, ResumePosition(app, userId, book)),
+			Seconds:    total.Seconds,
+			LastRead:   total.LastRead,
+		})
+	}
+
+	return result, nil
+}
+
+// bookCompletion returns how much of the book is before the position, by
+// words, or by chapters for books whose length wasn't counted.
+func bookCompletion(chapters []chapterLength, position *Position) float64 {
+	total := 0
+	for _, chapter := range chapters {
+		total += chapter.words
+	}
+
+	if total > 0 {
+		words, ok := wordsBefore(chapters, position.Chapter, position.Percentage)
+		if !ok {
+			return 0
+		}
+		return min(100, words/float64(total)*100)
+	}
+
+	for i, chapter := range chapters {
+		if chapter.id == position.Chapter {
+			return (float64(i) + position.Percentage/100) / float64(len(chapters)) * 100
+		}
+	}
+	return 0
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
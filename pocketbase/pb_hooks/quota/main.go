@@ -0,0 +1,202 @@
+package quota
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ExceededError is returned when an action would exceed one of the user's
+// limits. Its message is meant to be shown to the user.
+type ExceededError struct {
+	Message string
+}
+
+func (e *ExceededError) Error() string {
+	return e.Message
+}
+
+const (
+	PlanFree = "free"
+	PlanPaid = "paid"
+)
+
+// Limits are the allowances of a plan. A zero limit means unlimited.
+type Limits struct {
+	Books                   int   `json:"books"`
+	StorageBytes            int64 `json:"storageBytes"`
+	MessagesPerDay          int   `json:"messagesPerDay"`
+	EmbeddingTokensPerMonth int   `json:"embeddingTokensPerMonth"`
+}
+
+type Usage struct {
+	Books                   int   `json:"books"`
+	StorageBytes            int64 `json:"storageBytes"`
+	MessagesPerDay          int   `json:"messagesPerDay"`
+	EmbeddingTokensPerMonth int   `json:"embeddingTokensPerMonth"`
+}
+
+type Quota struct {
+	Plan   string `json:"plan"`
+	Limits Limits `json:"limits"`
+	Usage  Usage  `json:"usage"`
+}
+
+var plans = map[string]Limits{}
+
+func Init(app *pocketbase.PocketBase) error {
+	plans[PlanFree] = Limits{
+		Books:                   envInt("QUOTA_FREE_BOOKS", 5),
+		StorageBytes:            int64(envInt("QUOTA_FREE_STORAGE_BYTES", 100_000_000)),
+		MessagesPerDay:          envInt("QUOTA_FREE_MESSAGES_PER_DAY", 50),
+		EmbeddingTokensPerMonth: envInt("QUOTA_FREE_EMBEDDING_TOKENS_PER_MONTH", 2_000_000),
+	}
+	plans[PlanPaid] = Limits{
+		Books:                   envInt("QUOTA_PAID_BOOKS", 0),
+		StorageBytes:            int64(envInt("QUOTA_PAID_STORAGE_BYTES", 5_000_000_000)),
+		MessagesPerDay:          envInt("QUOTA_PAID_MESSAGES_PER_DAY", 1000),
+		EmbeddingTokensPerMonth: envInt("QUOTA_PAID_EMBEDDING_TOKENS_PER_MONTH", 50_000_000),
+	}
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.GET("/api/quota", func(e *core.RequestEvent) error {
+			usage, err := GetUsage(e.App, e.Auth.Id)
+			if err != nil {
+				return e.InternalServerError("failed to get quota usage", err)
+			}
+
+			return e.JSON(http.StatusOK, Quota{
+				Plan:   PlanFor(e.Auth),
+				Limits: LimitsFor(e.Auth),
+				Usage:  usage,
+			})
+		}).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+
+	return nil
+}
+
+func PlanFor(user *core.Record) string {
+	if user.GetBool("paid") {
+		return PlanPaid
+	}
+	return PlanFree
+}
+
+func LimitsFor(user *core.Record) Limits {
+	return plans[PlanFor(user)]
+}
+
+// GetUsage returns what the user has used of each limit in its current period.
+func GetUsage(app core.App, userId string) (Usage, error) {
+	var usage Usage
+
+	uploads, err := app.FindRecordById("uploads_by_user", userId)
+	if err != nil {
+		return usage, err
+	}
+	usage.Books = uploads.GetInt("uploadCount")
+
+	err = app.DB().
+		Select("COALESCE(SUM(size), 0)").
+		From("books").
+		Where(dbx.HashExp{"user": userId, "import_error": ""}).
+		Row(&usage.StorageBytes)
+	if err != nil {
+		return usage, err
+	}
+
+	now := time.Now().UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	messages, err := app.CountRecords("messages",
+		dbx.HashExp{"user": userId, "role": "user"},
+		dbx.NewExp("created >= {:since}", dbx.Params{"since": formatDate(dayStart)}),
+	)
+	if err != nil {
+		return usage, err
+	}
+	usage.MessagesPerDay = int(messages)
+
+	err = app.DB().
+		Select("COALESCE(SUM(input_tokens), 0)").
+		From("ai_usage").
+		Where(dbx.HashExp{"user": userId, "task": "embed"}).
+		AndWhere(dbx.NewExp("created >= {:since}", dbx.Params{"since": formatDate(monthStart)})).
+		Row(&usage.EmbeddingTokensPerMonth)
+	if err != nil {
+		return usage, err
+	}
+
+	return usage, nil
+}
+
+// CheckBookUpload returns an *ExceededError if the user can't upload
+// another book of the given size.
+func CheckBookUpload(app core.App, user *core.Record, size int64) error {
+	limits := LimitsFor(user)
+
+	usage, err := GetUsage(app, user.Id)
+	if err != nil {
+		return err
+	}
+
+	if limits.Books > 0 && usage.Books >= limits.Books {
+		return &ExceededError{fmt.Sprintf("Upload limit of %d books reached. Please upgrade to continue uploading files.", limits.Books)}
+	}
+
+	if limits.StorageBytes > 0 && usage.StorageBytes+size > limits.StorageBytes {
+		return &ExceededError{fmt.Sprintf("Storage limit of %d MB reached. Please upgrade or delete some books to continue uploading files.", limits.StorageBytes/1_000_000)}
+	}
+
+	// embedding a new book needs tokens left for the month
+	if limits.EmbeddingTokensPerMonth > 0 && usage.EmbeddingTokensPerMonth >= limits.EmbeddingTokensPerMonth {
+		return &ExceededError{"Monthly processing limit reached. Please upgrade or wait until next month to upload more books."}
+	}
+
+	return nil
+}
+
+// CheckMessages returns an *ExceededError if sending pending more
+// messages would exceed the user's daily message limit.
+func CheckMessages(app core.App, user *core.Record, pending int) error {
+	limits := LimitsFor(user)
+	if limits.MessagesPerDay <= 0 {
+		return nil
+	}
+
+	usage, err := GetUsage(app, user.Id)
+	if err != nil {
+		return err
+	}
+
+	if usage.MessagesPerDay+pending > limits.MessagesPerDay {
+		return &ExceededError{fmt.Sprintf("Daily limit of %d messages reached. Please upgrade or try again tomorrow.", limits.MessagesPerDay)}
+	}
+
+	return nil
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func formatDate(t time.Time) string {
+	date, _ := types.ParseDateTime(t)
+	return date.String()
+}
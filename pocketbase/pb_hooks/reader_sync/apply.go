@@ -0,0 +1,353 @@
+package reader_sync
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/highlight_hooks"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/progress"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ids of highlights and bookmarks are generated by the clients, in the same
+// format as PocketBase's, so items created offline keep their id
+var recordIdRegex = regexp.MustCompile(`^[a-z0-9]{15}$`)
+
+var preferenceKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,100}$`)
+
+// the largest preference value accepted, in bytes
+const maxPreferenceSize = 16 << 10
+
+type highlightData struct {
+	Book      string        `json:"book"`
+	Chapter   string        `json:"chapter"`
+	Text      string        `json:"text"`
+	Hash      string        `json:"hash"`
+	Selection types.JSONRaw `json:"selection"`
+	Color     string        `json:"color"`
+	Note      string        `json:"note"`
+	Tags      []string      `json:"tags"`
+	highlight_hooks.Anchor
+}
+
+type tagData struct {
+	Name string `json:"name"`
+}
+
+type bookmarkData struct {
+	Book       string  `json:"book"`
+	Chapter    string  `json:"chapter"`
+	Path       string  `json:"path"`
+	NodeIndex  int     `json:"nodeIndex"`
+	Offset     int     `json:"offset"`
+	Percentage float64 `json:"percentage"`
+	Label      string  `json:"label"`
+}
+
+// applyChange applies the change unless the server has a newer version of the
+// item, which it returns instead.
+func applyChange(app core.App, userId, device string, change Change) (*Change, error) {
+	if change.Timestamp <= 0 {
+		return nil, invalidChangeError("timestamp is required")
+	}
+	if limit := time.Now().Add(progress.MaxClockSkew).UnixMilli(); change.Timestamp > limit {
+		change.Timestamp = limit
+	}
+
+	switch change.Type {
+	case typeProgress:
+		return applyProgress(app, userId, device, change)
+	case typeHighlight, typeBookmark, typeTag:
+		if !recordIdRegex.MatchString(change.Id) {
+			return nil, invalidChangeError("id must be 15 lowercase letters and digits")
+		}
+	case typePreference:
+		if !preferenceKeyRegex.MatchString(change.Id) {
+			return nil, invalidChangeError("preference keys can only have letters, digits, '_', '.' and '-'")
+		}
+	default:
+		return nil, invalidChangeError("unknown change type " + change.Type)
+	}
+
+	record, err := findRecord(app, userId, change)
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil {
+		tombstone, err := findTombstone(app, userId, change.Type, change.Id)
+		if err != nil {
+			return nil, err
+		}
+		if tombstone != nil && int64(tombstone.GetInt("modified")) >= change.Timestamp {
+			return changeFromTombstone(tombstone), nil
+		}
+		if change.Deleted {
+			return nil, nil
+		}
+	} else if int64(record.GetInt("modified")) >= change.Timestamp {
+		current := changeFromRecord(change.Type, record)
+		return &current, nil
+	}
+
+	if change.Deleted {
+		// the tombstone takes the time of the deletion on the device
+		record.Set("modified", change.Timestamp)
+		return nil, app.Delete(record)
+	}
+
+	isNew := record == nil
+	if isNew {
+		collection, err := app.FindCollectionByNameOrId(collectionName(change.Type))
+		if err != nil {
+			return nil, err
+		}
+
+		record = core.NewRecord(collection)
+		record.Set("user", userId)
+		if change.Type == typePreference {
+			record.Set("key", change.Id)
+		} else {
+			record.Id = change.Id
+		}
+	}
+
+	switch change.Type {
+	case typeHighlight:
+		err = setHighlight(app, userId, record, change.Data)
+	case typeBookmark:
+		err = setBookmark(app, userId, record, change)
+	case typePreference:
+		err = setPreference(record, change.Data)
+	case typeTag:
+		err = setTag(app, userId, record, change.Data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record.Set("modified", change.Timestamp)
+	if err := app.Save(record); err != nil {
+		return nil, err
+	}
+
+	if isNew {
+		// the item was deleted before and created again
+		if tombstone, err := findTombstone(app, userId, change.Type, change.Id); err != nil {
+			return nil, err
+		} else if tombstone != nil {
+			if err := app.Delete(tombstone); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// applyProgress saves the reading position in the book. Positions can't be
+// deleted, only moved.
+func applyProgress(app core.App, userId, device string, change Change) (*Change, error) {
+	if change.Deleted {
+		return nil, invalidChangeError("reading progress can't be deleted")
+	}
+
+	var position progress.Position
+	if err := json.Unmarshal(change.Data, &position); err != nil {
+		return nil, invalidChangeError("invalid reading position")
+	}
+	position.Book = change.Id
+	position.Timestamp = change.Timestamp
+	if position.Device == "" {
+		position.Device = device
+	}
+
+	if err := progress.ValidatePosition(position); err != nil {
+		return nil, invalidChangeError(err.Error())
+	}
+
+	current, saved, err := progress.SavePosition(app, userId, position)
+	switch {
+	case errors.Is(err, progress.ErrNotFound):
+		return nil, invalidChangeError("book or chapter not found")
+	case err != nil:
+		return nil, err
+	case saved:
+		return nil, nil
+	}
+
+	return &Change{Type: typeProgress, Id: current.Book, Timestamp: current.Timestamp, Data: jsonData(current)}, nil
+}
+
+func setHighlight(app core.App, userId string, record *core.Record, raw types.JSONRaw) error {
+	var data highlightData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return invalidChangeError("invalid highlight")
+	}
+	switch {
+	case data.Text == "" || data.Hash == "":
+		return invalidChangeError("text and hash are required")
+	case data.Color != "" && !slices.Contains(highlight_hooks.Colors, data.Color):
+		return invalidChangeError("color must be one of " + strings.Join(highlight_hooks.Colors, ", "))
+	case len([]rune(data.Note)) > 10000:
+		return invalidChangeError("note can't be longer than 10000 characters")
+	}
+	if err := checkChapter(app, userId, data.Book, data.Chapter); err != nil {
+		return err
+	}
+	if err := highlight_hooks.CheckTags(app, userId, data.Tags); errors.Is(err, highlight_hooks.ErrTagNotFound) {
+		return invalidChangeError("tag not found, tags have to be synced before the highlights that have them")
+	} else if err != nil {
+		return err
+	}
+
+	record.Set("book", data.Book)
+	record.Set("chapter", data.Chapter)
+	record.Set("text", data.Text)
+	record.Set("hash", data.Hash)
+	record.Set("selection", data.Selection)
+	record.Set("color", data.Color)
+	record.Set("note", data.Note)
+	record.Set("tags", data.Tags)
+	highlight_hooks.SetAnchor(record, &data.Anchor)
+
+	err := highlight_hooks.AnchorHighlight(app, record)
+	if errors.Is(err, highlight_hooks.ErrNotAnchored) {
+		return invalidChangeError(err.Error())
+	}
+	return err
+}
+
+func setBookmark(app core.App, userId string, record *core.Record, change Change) error {
+	var data bookmarkData
+	if err := json.Unmarshal(change.Data, &data); err != nil {
+		return invalidChangeError("invalid bookmark")
+	}
+	if len([]rune(data.Label)) > 200 {
+		return invalidChangeError("label can't be longer than 200 characters")
+	}
+
+	// bookmarks point at the same kind of location as reading positions
+	err := progress.ValidatePosition(progress.Position{
+		Book:       data.Book,
+		Chapter:    data.Chapter,
+		Path:       data.Path,
+		NodeIndex:  data.NodeIndex,
+		Offset:     data.Offset,
+		Percentage: data.Percentage,
+		Timestamp:  change.Timestamp,
+	})
+	if err != nil {
+		return invalidChangeError(err.Error())
+	}
+	if err := checkChapter(app, userId, data.Book, data.Chapter); err != nil {
+		return err
+	}
+
+	record.Set("book", data.Book)
+	record.Set("chapter", data.Chapter)
+	record.Set("path", data.Path)
+	record.Set("node_index", data.NodeIndex)
+	record.Set("offset", data.Offset)
+	record.Set("percentage", data.Percentage)
+	record.Set("label", data.Label)
+	return nil
+}
+
+func setTag(app core.App, userId string, record *core.Record, raw types.JSONRaw) error {
+	var data tagData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return invalidChangeError("invalid tag")
+	}
+
+	name := strings.TrimSpace(data.Name)
+	switch {
+	case name == "":
+		return invalidChangeError("name is required")
+	case len([]rune(name)) > 50:
+		return invalidChangeError("name can't be longer than 50 characters")
+	}
+
+	// tag names are unique per user, ignoring case
+	var taken int
+	err := app.RecordQuery("tags").
+		Select("COUNT(*)").
+		AndWhere(dbx.HashExp{"user": userId}).
+		AndWhere(dbx.NewExp("[[name]] = {:name} COLLATE NOCASE", dbx.Params{"name": name})).
+		AndWhere(dbx.Not(dbx.HashExp{"id": record.Id})).
+		Row(&taken)
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return invalidChangeError("a tag with this name already exists")
+	}
+
+	record.Set("name", name)
+	return nil
+}
+
+func setPreference(record *core.Record, raw types.JSONRaw) error {
+	if len(raw) == 0 || !json.Valid(raw) {
+		return invalidChangeError("invalid preference value")
+	}
+	if len(raw) > maxPreferenceSize {
+		return invalidChangeError("preference values can't be larger than 16KB")
+	}
+
+	record.Set("value", raw)
+	return nil
+}
+
+// checkChapter returns an invalidChangeError unless the book is the user's
+// and the chapter is in it.
+func checkChapter(app core.App, userId, bookId, chapterId string) error {
+	book, err := app.FindRecordById("books", bookId)
+	if err != nil || book.GetString("user") != userId {
+		return invalidChangeError("book not found")
+	}
+
+	chapter, err := app.FindRecordById("chapters", chapterId)
+	if err != nil || chapter.GetString("book") != book.Id {
+		return invalidChangeError("chapter not found")
+	}
+
+	return nil
+}
+
+// findRecord returns the user's record the change is for, or nil if there is
+// none.
+func findRecord(app core.App, userId string, change Change) (*core.Record, error) {
+	var records []*core.Record
+	var err error
+	if change.Type == typePreference {
+		records, err = app.FindAllRecords("reader_preferences", dbx.HashExp{"user": userId, "key": change.Id})
+	} else {
+		records, err = app.FindAllRecords(collectionName(change.Type), dbx.HashExp{"id": change.Id})
+	}
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+
+	// ids are unique across users, so another user's record means the id is taken
+	if records[0].GetString("user") != userId {
+		return nil, invalidChangeError("id is already in use")
+	}
+
+	return records[0], nil
+}
+
+func collectionName(changeType string) string {
+	for name, t := range syncedCollections {
+		if t == changeType {
+			return name
+		}
+	}
+	return ""
+}
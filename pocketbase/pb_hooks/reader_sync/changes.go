@@ -0,0 +1,107 @@
+package reader_sync
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/highlight_hooks"
+	"github.com/lsherman98/ai-reader/pocketbase/pb_hooks/progress"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// changesSince returns the user's changes after the cursor in the order they
+// were made, at most limit of them, and whether there are more.
+func changesSince(app core.App, userId string, cursor, limit int) ([]Change, bool, error) {
+	params := dbx.Params{"user": userId, "cursor": cursor}
+	changes := []Change{}
+
+	for name, changeType := range syncedCollections {
+		records, err := app.FindRecordsByFilter(name, "user = {:user} && seq > {:cursor}", "seq", limit+1, 0, params)
+		if err != nil {
+			return nil, false, err
+		}
+
+		for _, record := range records {
+			changes = append(changes, changeFromRecord(changeType, record))
+		}
+	}
+
+	tombstones, err := app.FindRecordsByFilter("sync_tombstones", "user = {:user} && seq > {:cursor}", "seq", limit+1, 0, params)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, tombstone := range tombstones {
+		changes = append(changes, *changeFromTombstone(tombstone))
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Seq < changes[j].Seq
+	})
+
+	if len(changes) > limit {
+		return changes[:limit], true, nil
+	}
+	return changes, false, nil
+}
+
+func changeFromRecord(changeType string, record *core.Record) Change {
+	change := Change{
+		Type:      changeType,
+		Id:        changeId(changeType, record),
+		Timestamp: int64(record.GetInt("modified")),
+		Seq:       record.GetInt("seq"),
+	}
+
+	switch changeType {
+	case typeProgress:
+		position := progress.PositionFromRecord(record)
+		change.Timestamp = position.Timestamp
+		change.Data = jsonData(position)
+	case typeHighlight:
+		change.Data = jsonData(highlightData{
+			Book:      record.GetString("book"),
+			Chapter:   record.GetString("chapter"),
+			Text:      record.GetString("text"),
+			Hash:      record.GetString("hash"),
+			Selection: types.JSONRaw(record.GetString("selection")),
+			Color:     record.GetString("color"),
+			Note:      record.GetString("note"),
+			Tags:      record.GetStringSlice("tags"),
+			Anchor:    highlight_hooks.AnchorFromRecord(record),
+		})
+	case typeBookmark:
+		change.Data = jsonData(bookmarkData{
+			Book:       record.GetString("book"),
+			Chapter:    record.GetString("chapter"),
+			Path:       record.GetString("path"),
+			NodeIndex:  record.GetInt("node_index"),
+			Offset:     record.GetInt("offset"),
+			Percentage: record.GetFloat("percentage"),
+			Label:      record.GetString("label"),
+		})
+	case typePreference:
+		change.Data = types.JSONRaw(record.GetString("value"))
+	case typeTag:
+		change.Data = jsonData(tagData{Name: record.GetString("name")})
+	}
+
+	return change
+}
+
+func changeFromTombstone(tombstone *core.Record) *Change {
+	return &Change{
+		Type:      tombstone.GetString("type"),
+		Id:        tombstone.GetString("record"),
+		Timestamp: int64(tombstone.GetInt("modified")),
+		Deleted:   true,
+		Seq:       tombstone.GetInt("seq"),
+	}
+}
+
+func jsonData(v any) types.JSONRaw {
+	// the values are built from plain structs, which always marshal
+	data, _ := json.Marshal(v)
+	return data
+}
@@ -0,0 +1,149 @@
+package reader_sync
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// the most changes accepted in a request, and returned in a response
+const maxChanges = 500
+
+const (
+	typeProgress   = "progress"
+	typeHighlight  = "highlight"
+	typeBookmark   = "bookmark"
+	typePreference = "preference"
+	typeTag        = "tag"
+)
+
+// Change is a change to one synced item. Id is the book for progress, the
+// record id for highlights, bookmarks and tags and the key for preferences.
+// Timestamp is when the change was made on the device, in milliseconds since
+// the epoch, and the change with the newest timestamp wins. Seq is set on
+// changes returned by the server.
+type Change struct {
+	Type      string        `json:"type"`
+	Id        string        `json:"id"`
+	Timestamp int64         `json:"timestamp"`
+	Deleted   bool          `json:"deleted,omitempty"`
+	Data      types.JSONRaw `json:"data,omitempty"`
+	Seq       int           `json:"seq,omitempty"`
+}
+
+type syncRequest struct {
+	Cursor  int      `json:"cursor"`
+	Device  string   `json:"device"`
+	Changes []Change `json:"changes"`
+}
+
+// SyncResponse holds the changes after the request's cursor, followed by the
+// server's version of any item whose change from the request lost. Cursor is
+// sent with the next request, and More means there are changes left to fetch.
+type SyncResponse struct {
+	Cursor  int           `json:"cursor"`
+	More    bool          `json:"more"`
+	Changes []Change      `json:"changes"`
+	Errors  []ChangeError `json:"errors"`
+}
+
+// ChangeError is a change from the request that was invalid and skipped.
+type ChangeError struct {
+	Index   int    `json:"index"`
+	Message string `json:"message"`
+}
+
+// invalidChangeError is returned by applyChange for changes that can't be
+// applied, as opposed to database errors that fail the whole request.
+type invalidChangeError string
+
+func (e invalidChangeError) Error() string {
+	return string(e)
+}
+
+func Init(app *pocketbase.PocketBase) error {
+	initSeq(app)
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.POST("/api/sync", syncChanges).Bind(apis.RequireAuth())
+
+		return se.Next()
+	})
+
+	return nil
+}
+
+// syncChanges applies the client's changes and returns the server's changes
+// since the client's cursor, all in one transaction so the cursor never skips
+// a change.
+func syncChanges(e *core.RequestEvent) error {
+	var request syncRequest
+	if err := e.BindBody(&request); err != nil {
+		return e.BadRequestError("invalid sync request", err)
+	}
+
+	switch {
+	case request.Cursor < 0:
+		return e.BadRequestError("cursor can't be negative", nil)
+	case len(request.Changes) > maxChanges:
+		return e.BadRequestError("a request can't have more than 500 changes", nil)
+	case len(request.Device) > 100:
+		return e.BadRequestError("device can't be longer than 100 characters", nil)
+	}
+
+	response := SyncResponse{
+		Cursor:  request.Cursor,
+		Changes: []Change{},
+		Errors:  []ChangeError{},
+	}
+
+	err := e.App.RunInTransaction(func(txApp core.App) error {
+		var rejected []Change
+		for i, change := range request.Changes {
+			current, err := applyChange(txApp, e.Auth.Id, request.Device, change)
+			var invalid invalidChangeError
+			switch {
+			case errors.As(err, &invalid):
+				response.Errors = append(response.Errors, ChangeError{Index: i, Message: invalid.Error()})
+			case err != nil:
+				return err
+			case current != nil:
+				rejected = append(rejected, *current)
+			}
+		}
+
+		changes, more, err := changesSince(txApp, e.Auth.Id, request.Cursor, maxChanges)
+		if err != nil {
+			return err
+		}
+		response.Changes = changes
+		response.More = more
+		if len(changes) > 0 {
+			response.Cursor = changes[len(changes)-1].Seq
+		}
+
+		// the client keeps its version of an item until it gets the server's,
+		// which may be older than the cursor
+		returned := make(map[string]bool, len(changes))
+		for _, change := range changes {
+			returned[change.Type+"/"+change.Id] = true
+		}
+		for _, change := range rejected {
+			if !returned[change.Type+"/"+change.Id] {
+				response.Changes = append(response.Changes, change)
+				returned[change.Type+"/"+change.Id] = true
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return e.InternalServerError("failed to sync changes", err)
+	}
+
+	return e.JSON(http.StatusOK, response)
+}
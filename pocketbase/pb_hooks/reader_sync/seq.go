@@ -0,0 +1,155 @@
+package reader_sync
+
+import (
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// the synced collections and the type of change their records are sent as
+var syncedCollections = map[string]string{
+	"reading_positions":  typeProgress,
+	"highlights":         typeHighlight,
+	"bookmarks":          typeBookmark,
+	"reader_preferences": typePreference,
+	"tags":               typeTag,
+}
+
+// initSeq numbers every write to a synced record, including the ones made
+// outside of /api/sync, and keeps a tombstone for every deleted one, so they
+// all reach the other devices.
+func initSeq(app *pocketbase.PocketBase) {
+	collections := make([]string, 0, len(syncedCollections))
+	for name := range syncedCollections {
+		collections = append(collections, name)
+	}
+
+	app.OnRecordCreate(collections...).BindFunc(stampRecord)
+	app.OnRecordUpdate(collections...).BindFunc(stampRecord)
+	app.OnRecordDelete(collections...).BindFunc(recordTombstone)
+}
+
+// stampRecord gives the record the user's next sequence number. It runs in
+// the same transaction as the write, so a client can't see a number before
+// all the lower ones are committed.
+func stampRecord(e *core.RecordEvent) error {
+	// records saved by migrations that ran before the field existed
+	if e.Record.Collection().Fields.GetByName("seq") == nil {
+		return e.Next()
+	}
+
+	return inTransaction(e, func(txApp core.App) error {
+		seq, err := nextSeq(txApp, e.Record.GetString("user"))
+		if err != nil {
+			return err
+		}
+		e.Record.Set("seq", seq)
+
+		// writes that don't come from a device happen now
+		if e.Record.Collection().Fields.GetByName("modified") != nil &&
+			e.Record.GetInt("modified") == e.Record.Original().GetInt("modified") {
+			e.Record.Set("modified", time.Now().UnixMilli())
+		}
+
+		return e.Next()
+	})
+}
+
+func recordTombstone(e *core.RecordEvent) error {
+	if _, err := e.App.FindCollectionByNameOrId("sync_tombstones"); err != nil {
+		return e.Next()
+	}
+
+	changeType := syncedCollections[e.Record.Collection().Name]
+	id := changeId(changeType, e.Record)
+
+	modified := time.Now().UnixMilli()
+	if e.Record.GetInt("modified") != e.Record.Original().GetInt("modified") {
+		modified = int64(e.Record.GetInt("modified"))
+	}
+
+	return inTransaction(e, func(txApp core.App) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		return saveTombstone(txApp, e.Record.GetString("user"), changeType, id, modified)
+	})
+}
+
+func saveTombstone(app core.App, userId, changeType, id string, modified int64) error {
+	tombstone, err := findTombstone(app, userId, changeType, id)
+	if err != nil {
+		return err
+	}
+	if tombstone == nil {
+		collection, err := app.FindCollectionByNameOrId("sync_tombstones")
+		if err != nil {
+			return err
+		}
+
+		tombstone = core.NewRecord(collection)
+		tombstone.Set("user", userId)
+		tombstone.Set("type", changeType)
+		tombstone.Set("record", id)
+	}
+
+	seq, err := nextSeq(app, userId)
+	if err != nil {
+		return err
+	}
+
+	tombstone.Set("modified", modified)
+	tombstone.Set("seq", seq)
+	return app.Save(tombstone)
+}
+
+// findTombstone returns the tombstone of the item, or nil if it wasn't deleted.
+func findTombstone(app core.App, userId, changeType, id string) (*core.Record, error) {
+	tombstones, err := app.FindAllRecords("sync_tombstones", dbx.HashExp{"user": userId, "type": changeType, "record": id})
+	if err != nil || len(tombstones) == 0 {
+		return nil, err
+	}
+	return tombstones[0], nil
+}
+
+// nextSeq increments and returns the user's sequence number. It is kept in
+// sync_counters rather than on the user, as users are saved as a whole row by
+// code that may hold an older copy of the number.
+func nextSeq(app core.App, userId string) (int, error) {
+	var seq int
+	err := app.DB().
+		NewQuery(`INSERT INTO {{sync_counters}} ([[id]], [[user]], [[seq]]) VALUES ({:id}, {:user}, 1)
+			ON CONFLICT ([[user]]) DO UPDATE SET [[seq]] = [[seq]] + 1
+			RETURNING [[seq]]`).
+		Bind(dbx.Params{"id": core.GenerateDefaultRandomId(), "user": userId}).
+		Row(&seq)
+	return seq, err
+}
+
+// inTransaction runs fn in the event's transaction, starting one if the
+// record isn't being written in one already.
+func inTransaction(e *core.RecordEvent, fn func(txApp core.App) error) error {
+	if e.App.IsTransactional() {
+		return fn(e.App)
+	}
+
+	return e.App.RunInTransaction(func(txApp core.App) error {
+		e.App = txApp
+		return fn(txApp)
+	})
+}
+
+// changeId returns the id a record is synced by.
+func changeId(changeType string, record *core.Record) string {
+	switch changeType {
+	case typeProgress:
+		return record.GetString("book")
+	case typePreference:
+		return record.GetString("key")
+	default:
+		return record.Id
+	}
+}
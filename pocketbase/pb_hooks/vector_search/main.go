@@ -1,7 +1,9 @@
 package vector_search
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -372,6 +374,14 @@ func processRecordEmbedding(app *pocketbase.PocketBase, target string, client *g
 	title := record.GetString("title")
 	content := record.GetString("content")
 
+	reused, err := reuseDuplicateEmbedding(app, target, record)
+	if err != nil {
+		app.Logger().Error("Error reusing embedding of duplicate book:", "error", err.Error())
+	}
+	if reused {
+		return nil
+	}
+
 	trackAIUsage(app, record, title, content)
 
 	if content != "" {
@@ -419,6 +429,57 @@ func processRecordEmbedding(app *pocketbase.PocketBase, target string, client *g
 	return nil
 }
 
+// reuseDuplicateEmbedding copies the embedding of an identical chunk from a
+// book with the same content hash, which is the case when another user has
+// uploaded the same file. It reports whether an embedding was copied.
+func reuseDuplicateEmbedding(app *pocketbase.PocketBase, target string, record *core.Record) (bool, error) {
+	book, err := app.FindRecordById("books", record.GetString("book"))
+	if err != nil || book.GetString("content_hash") == "" {
+		return false, nil
+	}
+
+	var sourceId int64
+	stmt := "SELECT v.vector_id FROM " + target + " v "
+	stmt += "JOIN books b ON b.id = v.book "
+	stmt += "WHERE b.content_hash = {:hash} AND v.book != {:book} AND v.title = {:title} AND v.content = {:content} AND v.vector_id != 0 "
+	stmt += "LIMIT 1;"
+	err = app.DB().NewQuery(stmt).Bind(dbx.Params{
+		"hash":    book.GetString("content_hash"),
+		"book":    book.Id,
+		"title":   record.GetString("title"),
+		"content": record.GetString("content"),
+	}).Row(&sourceId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	deleteEmbeddingsForRecord(app, target, record)
+
+	// embeddings are copied rather than shared so that deleting either book
+	// doesn't remove the other's embedding
+	stmt = "INSERT INTO " + target + "_embeddings (embedding) "
+	stmt += "SELECT embedding FROM " + target + "_embeddings WHERE id = {:id};"
+	res, err := app.DB().NewQuery(stmt).Bind(dbx.Params{"id": sourceId}).Execute()
+	if err != nil {
+		return false, err
+	}
+
+	vectorId, err := res.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+
+	record.Set("vector_id", vectorId)
+	if err := app.UnsafeWithoutHooks().Save(record); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 func deleteEmbeddingsForRecord(app *pocketbase.PocketBase, target string, record *core.Record) error {
 	type Meta struct {
 		Id string `db:"id" json:"id"`
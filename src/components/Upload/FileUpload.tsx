@@ -32,17 +32,19 @@ export function FileUpload({
 }) {
   const { data: uploadLimitReached } = useGetUploadLimitReached();
 
-  const allowedMimeTypes = ["application/epub+zip"];
+  const allowedMimeTypes = ["application/epub+zip", "application/pdf", "text/plain", "text/markdown", "text/html"];
+  const allowedExtensions = [".epub", ".pdf", ".txt", ".md", ".markdown", ".html", ".htm"];
 
   const validateFile = (file: File): { valid: boolean; error?: string } => {
     if (file.size > 20 * 1024 * 1024) {
       return { valid: false, error: "File size is too large. Max file size is 10MB." };
     }
 
-    if (!allowedMimeTypes.includes(file.type)) {
+    const extension = file.name.slice(file.name.lastIndexOf(".")).toLowerCase();
+    if (!allowedMimeTypes.includes(file.type) && !allowedExtensions.includes(extension)) {
       return {
         valid: false,
-        error: "Invalid file type. Only .epub files are supported at this time.",
+        error: "Invalid file type. Only .epub, .pdf, .txt, .md and .html files are supported at this time.",
       };
     }
 
@@ -115,7 +117,7 @@ export function FileUpload({
                   <p className="font-semibold">Upload files</p>
                   <p className="text-sm text-muted-foreground">Click here or drag and drop to upload</p>
                   <p className="text-xs text-muted-foreground">
-                    Only .epub files are supported at this time. Max file size is 10MB.
+                    Only .epub, .pdf, .txt, .md and .html files are supported at this time. Max file size is 10MB.
                   </p>
                 </div>
               </DropzoneTrigger>
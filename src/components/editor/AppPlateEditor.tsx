@@ -1,5 +1,5 @@
 /* eslint-disable @typescript-eslint/no-explicit-any */
-import { useAddHighlight, useDeleteHighlightByHash, useUpdateChapter } from "@/lib/api/mutations";
+import { useAddHighlight, useDeleteHighlightByHash } from "@/lib/api/mutations";
 import { ChaptersRecord } from "@/lib/pocketbase-types";
 import { useCitationStore } from "@/lib/stores/citation-store";
 import { useSelectedHighlightStore } from "@/lib/stores/selected-highlight-store";
@@ -9,8 +9,7 @@ import { BasicBlocksKit } from "./plugins/basic-blocks-kit";
 import { BasicMarksKit } from "./plugins/basic-marks-kit";
 import { DisableTextInput } from "./plugins/disable-text-input";
 import { FloatingToolbarKit } from "./plugins/floating-toolbar-kit";
-import { createStaticEditor, Node, Range, serializeHtml, Value } from "platejs";
-import { BaseEditorKit } from "./plugins/editor-base-kit";
+import { Node, Range, Value } from "platejs";
 import { Editor, EditorContainer } from "../ui/editor";
 import { useNavigationHistoryStore } from "@/lib/stores/navigation-history-store";
 import { useNavigate } from "@tanstack/react-router";
@@ -22,9 +21,10 @@ import {
   findAdjacentHighlights,
   findHighlightedElementInEditor,
   findMatchingMarksInEditor,
+  getSelectionContext,
   selectMarksInEditor,
 } from "@/lib/utils/highlights";
-import { calculateTextSimilarity, scrollElementIntoView } from "@/lib/utils/utils";
+import { calculateTextSimilarity, resolveFileUrls, scrollElementIntoView } from "@/lib/utils/utils";
 import { findBestMatchingNode, highlightCitationInElement } from "@/lib/utils/citations";
 
 export function AppPlateEditor({ chapter }: { chapter?: ChaptersRecord }) {
@@ -32,7 +32,6 @@ export function AppPlateEditor({ chapter }: { chapter?: ChaptersRecord }) {
   const currentEditorSelection = useRef<Range | null>(null);
 
   const navigate = useNavigate();
-  const updateChapterMutation = useUpdateChapter();
   const addHighlightMutation = useAddHighlight();
   const deleteHighlightByHashMutation = useDeleteHighlightByHash();
   const { canGoBack, previousLocation, setPreviousLocation } = useNavigationHistoryStore();
@@ -43,10 +42,6 @@ export function AppPlateEditor({ chapter }: { chapter?: ChaptersRecord }) {
     plugins: [...BasicBlocksKit, ...BasicMarksKit, DisableTextInput, ...FloatingToolbarKit],
   });
 
-  const staticHtmlEditor = createStaticEditor({
-    plugins: BaseEditorKit,
-  });
-
   useEffect(() => {
     setTimeout(() => {
       if (selectedHighlight && chapter && selectedHighlight.chapter === chapter.id && selectedHighlight.text) {
@@ -60,21 +55,6 @@ export function AppPlateEditor({ chapter }: { chapter?: ChaptersRecord }) {
     }, 200);
   }, [selectedHighlight, chapter, setSelectedHighlight, chapterHtmlContent, plateEditor.children]);
 
-  const handleEditorValueChange = useCallback(
-    async (value: any) => {
-      if (!chapter) return;
-      if (value && value.editor.selection) {
-        const htmlContent = await serializeHtml(staticHtmlEditor, {
-          props: { value: value.value as Value },
-          stripDataAttributes: true,
-        });
-        setChapterHtmlContent(htmlContent);
-        updateChapterMutation.mutateAsync({ chapterId: chapter.id, content: htmlContent });
-      }
-    },
-    [chapter, staticHtmlEditor, updateChapterMutation],
-  );
-
   const handleHighlightClick = (event: any) => {
     const clickedElement = event.target;
     const isHighlightClicked = clickedElement.parentElement.classList.contains("slate-highlight");
@@ -114,6 +94,7 @@ export function AppPlateEditor({ chapter }: { chapter?: ChaptersRecord }) {
     } else {
       const adjustedSelection = createAdjustedSelection(selection);
       const highlightHash = await createHighlightHash(chapter.book, chapter.id, adjustedSelection, selectedText);
+      const { prefix, suffix } = getSelectionContext(plateEditor, selection);
 
       addHighlightMutation.mutate({
         bookId: chapter.book,
@@ -121,6 +102,8 @@ export function AppPlateEditor({ chapter }: { chapter?: ChaptersRecord }) {
         text: selectedText,
         selection: adjustedSelection,
         hash: highlightHash,
+        prefix,
+        suffix,
       });
     }
   }, [addHighlightMutation, chapter, deleteHighlightByHashMutation, plateEditor]);
@@ -162,12 +145,11 @@ export function AppPlateEditor({ chapter }: { chapter?: ChaptersRecord }) {
     if (!plateEditor || !chapterHtmlContent) return;
     const deserializedValue = plateEditor.api.html.deserialize({ element: chapterHtmlContent });
     plateEditor.tf.setValue(deserializedValue as Value);
-    staticHtmlEditor.tf.setValue(deserializedValue as Value);
-  }, [plateEditor, staticHtmlEditor, chapterHtmlContent]);
+  }, [plateEditor, chapterHtmlContent]);
 
   useEffect(() => {
     if (!chapter) return;
-    setChapterHtmlContent(chapter.content || "<p>Loading...</p>");
+    setChapterHtmlContent(chapter.content ? resolveFileUrls(chapter.content) : "<p>Loading...</p>");
   }, [chapter]);
 
   useEffect(() => {
@@ -195,7 +177,7 @@ export function AppPlateEditor({ chapter }: { chapter?: ChaptersRecord }) {
   }, [currentCitation, plateEditor.children, setCurrentCitation, chapterHtmlContent, plateEditor]);
 
   return (
-    <Plate editor={plateEditor} onValueChange={handleEditorValueChange} onSelectionChange={handleEditorSelectionChange}>
+    <Plate editor={plateEditor} onSelectionChange={handleEditorSelectionChange}>
       <EditorContainer className="h-full w-full max-h-[calc(100vh-50px)] overflow-hidden caret-transparent">
         <Editor onClick={handleHighlightClick} />
       </EditorContainer>
@@ -1,8 +1,8 @@
 import { pb } from "../pocketbase";
-import { BooksResponse, ChatsResponse, Collections, HighlightsResponse } from "../pocketbase-types";
+import { BooksResponse, ChatsResponse, Collections, HighlightsColorOptions, HighlightsResponse } from "../pocketbase-types";
 import { FileUploadObj } from "@/pages/_app/upload.lazy";
-import { getUserId } from "../utils/utils";
-import { Citation, ExpandHighlights, ExpandMessages, UploadFileRequest } from "../types";
+import { getUserId, relativeFileUrls } from "../utils/utils";
+import { BookLength, BulkImportReport, Citation, ClippingsReport, CurrentBook, ExpandHighlights, ExpandMessages, HighlightExportFormat, HighlightFilters, HighlightList, IngestJob, OpdsFeedKey, Quota, ReadingHeartbeat, ReadingPosition, ReadingSession, ReadingStats, RemoteCatalogRequest, RemoteFeed, SyncRequest, SyncResponse, TagCount, UploadFileRequest } from "../types";
 import { Range } from "platejs";
 
 export const downloadBook = async (id: string) => {
@@ -14,6 +14,30 @@ export const downloadBook = async (id: string) => {
     return pb.files.getURL(record, filename, { download: true, token: fileToken });
 };
 
+export const exportBook = async (id: string) => {
+    if (!getUserId()) return;
+    return await downloadExport(`/api/books/${id}/export`);
+};
+
+export const exportLibrary = async () => {
+    if (!getUserId()) return;
+    return await downloadExport("/api/export");
+};
+
+export const exportHighlights = async (id: string, format: HighlightExportFormat) => {
+    if (!getUserId()) return;
+    return await downloadExport(`/api/books/${id}/highlights/export?format=${format}`);
+};
+
+const downloadExport = async (path: string) => {
+    const response = await fetch(pb.buildURL(path), {
+        headers: { Authorization: pb.authStore.token },
+    });
+    if (!response.ok) throw new Error("Failed to export");
+
+    return await response.blob();
+};
+
 export const uploadBook = async (upload: FileUploadObj) => {
     if (!getUserId()) return;
 
@@ -29,6 +53,38 @@ export const uploadBook = async (upload: FileUploadObj) => {
     return await pb.collection(Collections.Books).create(data, { requestKey: upload.file.name });
 };
 
+export const getIngestStatus = async (bookId: string) => {
+    if (!getUserId()) return;
+    return await pb.send<IngestJob>(`/api/books/${bookId}/ingest`, { method: "GET" });
+};
+
+export const retryIngest = async (bookId: string) => {
+    if (!getUserId()) return;
+    return await pb.send<IngestJob>(`/api/books/${bookId}/ingest/retry`, { method: "POST" });
+};
+
+export const reimportBook = async (bookId: string) => {
+    if (!getUserId()) return;
+    return await pb.send<IngestJob>(`/api/books/${bookId}/reimport`, { method: "POST" });
+};
+
+export const importLibrary = async (archive: File) => {
+    if (!getUserId()) return;
+
+    const body = new FormData();
+    body.append("file", archive);
+    return await pb.send<BulkImportReport>("/api/books/import", { method: "POST", body });
+};
+
+export const importHighlights = async (clippings: File, bookId?: string) => {
+    if (!getUserId()) return;
+
+    const body = new FormData();
+    body.append("file", clippings);
+    if (bookId) body.append("book", bookId);
+    return await pb.send<ClippingsReport>("/api/highlights/import", { method: "POST", body });
+};
+
 export const getBooks = async (page: number, limit: number) => {
     if (!getUserId()) return;
     return await pb.collection(Collections.Books).getList(page, limit);
@@ -44,11 +100,6 @@ export const searchBooks = async (query: string) => {
     return await pb.send(`/api/collections/books/records/full-text-search?search=${query}`, { method: "GET" });
 };
 
-export const getLastReadBook = async () => {
-    if (!getUserId()) return;
-    return await pb.collection(Collections.LastRead).getFirstListItem(`user="${getUserId()}"`);
-};
-
 export const updateBook = async (id: string, title?: string, coverImage?: File, author?: string) => {
     if (!getUserId()) return;
 
@@ -70,11 +121,29 @@ export const deleteBook = async (id: string) => {
     return await pb.collection(Collections.Books).delete(id);
 };
 
+export const getBookLength = async (bookId?: string, chapterId?: string, progress?: number) => {
+    if (!getUserId() || !bookId) return;
+    const query: Record<string, string | number> = {};
+    if (chapterId) query.chapter = chapterId;
+    if (chapterId && progress !== undefined) query.progress = progress;
+    return await pb.send<BookLength>(`/api/books/${bookId}/length`, { method: "GET", query });
+};
+
 export const getChaptersByBookId = async (id?: string) => {
     if (!getUserId() || !id) return;
     return await pb.collection(Collections.Chapters).getFullList({
         filter: `book="${id}" && user="${getUserId()}"`,
         fields: "id,title,order",
+        sort: "order",
+    });
+};
+
+export const getTocEntriesByBookId = async (id?: string) => {
+    if (!getUserId() || !id) return;
+    return await pb.collection(Collections.TocEntries).getFullList({
+        filter: `book="${id}" && user="${getUserId()}"`,
+        fields: "id,label,depth,chapter,fragment",
+        sort: "order",
     });
 };
 
@@ -85,7 +154,7 @@ export const getChapterById = async (id?: string) => {
 
 export const updateChapter = async (id: string, content?: string) => {
     if (!getUserId()) return;
-    return await pb.collection(Collections.Chapters).update(id, { content });
+    return await pb.collection(Collections.Chapters).update(id, { content: content && relativeFileUrls(content) });
 };
 
 export const getChats = async (id?: string) => {
@@ -167,7 +236,9 @@ export const addHighlight = async (
     chapterId: string,
     text: string,
     selection: Range,
-    hash: string
+    hash: string,
+    prefix: string,
+    suffix: string
 ) => {
     if (!getUserId()) return;
 
@@ -178,6 +249,8 @@ export const addHighlight = async (
         selection: JSON.stringify(selection),
         user: getUserId(),
         hash,
+        prefix,
+        suffix,
     });
 };
 
@@ -192,16 +265,110 @@ export const deleteHighlightByHash = async (hash: string) => {
     return await pb.collection(Collections.Highlights).delete(highlight.id);
 };
 
-export const uploadLimitReached = async () => {
-    await pb.collection("users").authRefresh();
+export const updateHighlight = async (
+    id: string,
+    data: { color?: HighlightsColorOptions | ""; note?: string; tags?: string[] }
+) => {
+    if (!getUserId()) return;
+    return await pb.collection(Collections.Highlights).update(id, data);
+};
+
+export const getLibraryHighlights = async (filters: HighlightFilters = {}) => {
+    if (!getUserId()) return;
+    return await pb.send<HighlightList>("/api/highlights", {
+        method: "GET",
+        query: {
+            book: filters.book,
+            tag: filters.tags,
+            color: filters.colors,
+            page: filters.page,
+            perPage: filters.perPage,
+        },
+    });
+};
 
-    const user = pb.authStore.record;
-    const paid = user?.paid;
-    if (!user || paid) return false;
+export const getTags = async () => {
+    if (!getUserId()) return;
+    return await pb.send<TagCount[]>("/api/tags", { method: "GET" });
+};
 
-    const uploadCountRecord = await pb.collection(Collections.UploadsByUser).getOne(user.id)
-    return uploadCountRecord.uploadCount >= 5
-}
+export const addTag = async (name: string) => {
+    if (!getUserId()) return;
+    return await pb.collection(Collections.Tags).create({ name, user: getUserId() });
+};
+
+export const deleteTag = async (id: string) => {
+    if (!getUserId()) return;
+    return await pb.collection(Collections.Tags).delete(id);
+};
+
+export const getReadingPosition = async (bookId?: string) => {
+    if (!getUserId()) return;
+    return await pb.send<ReadingPosition>("/api/progress", { method: "GET", query: bookId ? { book: bookId } : {} });
+};
+
+export const saveReadingPosition = async (position: ReadingPosition) => {
+    if (!getUserId()) return;
+    return await pb.send<ReadingPosition>("/api/progress", { method: "PUT", body: position });
+};
+
+export const getCurrentlyReading = async (limit: number = 10) => {
+    if (!getUserId()) return;
+    return await pb.send<CurrentBook[]>("/api/progress/current", { method: "GET", query: { limit } });
+};
+
+export const removeFromCurrentlyReading = async (bookId: string) => {
+    if (!getUserId()) return;
+    return await pb.send(`/api/progress/current/${bookId}`, { method: "DELETE" });
+};
+
+export const syncChanges = async (request: SyncRequest) => {
+    if (!getUserId()) return;
+    return await pb.send<SyncResponse>("/api/sync", { method: "POST", body: request });
+};
+
+export const sendReadingHeartbeat = async (heartbeat: ReadingHeartbeat) => {
+    if (!getUserId()) return;
+    return await pb.send<ReadingSession>("/api/sessions/heartbeat", { method: "POST", body: heartbeat });
+};
+
+export const getReadingStats = async (days: number = 30) => {
+    if (!getUserId()) return;
+    const tz = Intl.DateTimeFormat().resolvedOptions().timeZone;
+    return await pb.send<ReadingStats>("/api/stats", { method: "GET", query: { days, tz } });
+};
+
+export const getQuota = async () => {
+    if (!getUserId()) return;
+    return await pb.send<Quota>("/api/quota", { method: "GET" });
+};
+
+export const getOpdsFeedKey = async () => {
+    if (!getUserId()) return;
+    return await pb.send<OpdsFeedKey>("/api/opds", { method: "GET" });
+};
+
+export const rotateOpdsFeedKey = async () => {
+    if (!getUserId()) return;
+    return await pb.send<OpdsFeedKey>("/api/opds/key", { method: "POST" });
+};
+
+export const browseRemoteCatalog = async (request: RemoteCatalogRequest) => {
+    if (!getUserId()) return;
+    return await pb.send<RemoteFeed>("/api/opds/browse", { method: "POST", body: request });
+};
+
+export const importRemoteBook = async (request: RemoteCatalogRequest) => {
+    if (!getUserId()) return;
+    return await pb.send<BooksResponse>("/api/opds/import", { method: "POST", body: request });
+};
+
+export const uploadLimitReached = async () => {
+    const quota = await getQuota();
+    if (!quota) return false;
+
+    return quota.limits.books > 0 && quota.usage.books >= quota.limits.books;
+};
 
 export const isPaidUser = async () => {
     await pb.collection("users").authRefresh();
@@ -1,10 +1,12 @@
 import { useMutation, useQueryClient } from "@tanstack/react-query";
-import { addChat, addHighlight, addMessage, createCheckoutSession, createPortalSession, deleteAccount, deleteBook, deleteChat, deleteHighlight, deleteHighlightByHash, downloadBook, generateAIResponse, updateBook, updateChapter, updateChat, uploadBook } from "./api";
+import { addChat, addHighlight, addTag, addMessage, createCheckoutSession, createPortalSession, deleteAccount, deleteBook, deleteChat, deleteHighlight, deleteHighlightByHash, deleteTag, downloadBook, generateAIResponse, removeFromCurrentlyReading, retryIngest, rotateOpdsFeedKey, saveReadingPosition, sendReadingHeartbeat, updateBook, updateChapter, updateHighlight, updateChat, uploadBook } from "./api";
 import { handleError } from "../utils/utils";
 import { FileUploadObj } from "@/pages/_app/upload.lazy";
-import { Citation } from "../types";
+import { Citation, ReadingHeartbeat, ReadingPosition } from "../types";
+import { HighlightsColorOptions } from "../pocketbase-types";
 import { Range } from "platejs";
 import { pb } from "../pocketbase";
+import { ClientResponseError } from "pocketbase";
 
 export function useUploadBook() {
     const queryClient = useQueryClient();
@@ -18,6 +20,18 @@ export function useUploadBook() {
     })
 }
 
+export function useRetryIngest() {
+    const queryClient = useQueryClient();
+
+    return useMutation({
+        mutationFn: (bookId: string) => retryIngest(bookId),
+        onError: handleError,
+        onSuccess: async (_, bookId) => {
+            await queryClient.invalidateQueries({ queryKey: ['ingest', bookId] });
+        },
+    })
+}
+
 export function useUpdateBook() {
     const queryClient = useQueryClient();
 
@@ -130,7 +144,7 @@ export function useAddHighlight() {
     const queryClient = useQueryClient();
 
     return useMutation({
-        mutationFn: ({ bookId, chapterId, text, selection, hash }: { bookId: string, chapterId: string, text: string, selection: Range, hash: string }) => addHighlight(bookId, chapterId, text, selection, hash),
+        mutationFn: ({ bookId, chapterId, text, selection, hash, prefix, suffix }: { bookId: string, chapterId: string, text: string, selection: Range, hash: string, prefix: string, suffix: string }) => addHighlight(bookId, chapterId, text, selection, hash, prefix, suffix),
         onError: handleError,
         onSuccess: async (data) => {
             await queryClient.invalidateQueries({ queryKey: ['highlights', data?.book] });
@@ -138,6 +152,47 @@ export function useAddHighlight() {
     })
 }
 
+export function useUpdateHighlight() {
+    const queryClient = useQueryClient();
+
+    return useMutation({
+        mutationFn: ({ id, ...data }: { id: string, color?: HighlightsColorOptions | "", note?: string, tags?: string[] }) => updateHighlight(id, data),
+        onError: handleError,
+        onSuccess: async () => {
+            await queryClient.invalidateQueries({ queryKey: ['highlights'] });
+            await queryClient.invalidateQueries({ queryKey: ['libraryHighlights'] });
+            await queryClient.invalidateQueries({ queryKey: ['tags'] });
+            await queryClient.invalidateQueries({ queryKey: ['chapters'] });
+        }
+    })
+}
+
+export function useAddTag() {
+    const queryClient = useQueryClient();
+
+    return useMutation({
+        mutationFn: (name: string) => addTag(name),
+        onError: handleError,
+        onSuccess: async () => {
+            await queryClient.invalidateQueries({ queryKey: ['tags'] });
+        }
+    })
+}
+
+export function useDeleteTag() {
+    const queryClient = useQueryClient();
+
+    return useMutation({
+        mutationFn: (id: string) => deleteTag(id),
+        onError: handleError,
+        onSuccess: async () => {
+            await queryClient.invalidateQueries({ queryKey: ['tags'] });
+            await queryClient.invalidateQueries({ queryKey: ['highlights'] });
+            await queryClient.invalidateQueries({ queryKey: ['libraryHighlights'] });
+        }
+    })
+}
+
 export function useDeleteHighlight() {
     const queryClient = useQueryClient();
 
@@ -187,4 +242,59 @@ export function useCreatePortalSession() {
         mutationFn: () => createPortalSession(),
         onError: handleError,
     })
-}
\ No newline at end of file
+}
+export function useRotateOpdsFeedKey() {
+    const queryClient = useQueryClient();
+
+    return useMutation({
+        mutationFn: () => rotateOpdsFeedKey(),
+        onError: handleError,
+        onSuccess: async () => {
+            await queryClient.invalidateQueries({ queryKey: ['opds'] });
+        },
+    })
+}
+
+export function useSaveReadingPosition() {
+    const queryClient = useQueryClient();
+
+    return useMutation({
+        mutationFn: (position: ReadingPosition) => saveReadingPosition(position),
+        onError: (error) => {
+            // a newer position was saved from another device, so the reader moves there instead
+            if (error instanceof ClientResponseError && error.status === 409) {
+                const position = error.response as ReadingPosition;
+                queryClient.setQueryData(['progress', position.book], position);
+                return;
+            }
+            handleError(error);
+        },
+        onSuccess: (position) => {
+            if (!position) return;
+            queryClient.setQueryData(['progress', position.book], position);
+        },
+    })
+}
+
+export function useRemoveFromCurrentlyReading() {
+    const queryClient = useQueryClient();
+
+    return useMutation({
+        mutationFn: (bookId: string) => removeFromCurrentlyReading(bookId),
+        onError: handleError,
+        onSuccess: async () => {
+            await queryClient.invalidateQueries({ queryKey: ['currentlyReading'] });
+        },
+    })
+}
+
+export function useSendReadingHeartbeat() {
+    const queryClient = useQueryClient();
+
+    return useMutation({
+        mutationFn: (heartbeat: ReadingHeartbeat) => sendReadingHeartbeat(heartbeat),
+        onSuccess: async () => {
+            await queryClient.invalidateQueries({ queryKey: ['stats'] });
+        },
+    })
+}
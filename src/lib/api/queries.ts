@@ -1,5 +1,6 @@
 import { keepPreviousData, useQuery } from "@tanstack/react-query";
-import { getBookById, getBooks, getChapterById, getChaptersByBookId, getChats, getHighlights, getLastReadBook, getMessagesByChatId, isPaidUser, searchBooks, uploadLimitReached } from "./api";
+import { getBookById, getBookLength, getBooks, getChapterById, getChaptersByBookId, getChats, getHighlights, getCurrentlyReading, getLibraryHighlights, getTags, getIngestStatus, getMessagesByChatId, getOpdsFeedKey, getReadingPosition, getReadingStats, getTocEntriesByBookId, isPaidUser, searchBooks, uploadLimitReached } from "./api";
+import { HighlightFilters } from "../types";
 
 export function useGetBooks(page: number = 1, limit: number = 25) {
     return useQuery({
@@ -18,6 +19,18 @@ export function useGetBookById(id?: string) {
     });
 }
 
+export function useGetIngestStatus(bookId?: string) {
+    return useQuery({
+        queryKey: ['ingest', bookId],
+        queryFn: () => getIngestStatus(bookId!),
+        enabled: !!bookId,
+        refetchInterval: (query) => {
+            const status = query.state.data?.status;
+            return status === 'ready' || status === 'failed' ? false : 3000;
+        },
+    });
+}
+
 export function useSearchBooks(query: string) {
     return useQuery({
         queryKey: ['search', query],
@@ -26,15 +39,46 @@ export function useSearchBooks(query: string) {
     });
 }
 
-export function useGetLastReadBook() {
+export function useGetLastOpenedPosition() {
     return useQuery({
-        queryKey: ['lastReadBook'],
-        queryFn: () => getLastReadBook(),
+        queryKey: ['progress', 'lastOpened'],
+        queryFn: () => getReadingPosition(),
         gcTime: Infinity,
         enabled: false
     });
 }
 
+export function useGetLibraryHighlights(filters: HighlightFilters = {}) {
+    return useQuery({
+        queryKey: ['libraryHighlights', filters],
+        queryFn: () => getLibraryHighlights(filters),
+        placeholderData: keepPreviousData,
+    });
+}
+
+export function useGetTags() {
+    return useQuery({
+        queryKey: ['tags'],
+        queryFn: () => getTags(),
+    });
+}
+
+export function useGetCurrentlyReading(limit: number = 10) {
+    return useQuery({
+        queryKey: ['currentlyReading', limit],
+        queryFn: () => getCurrentlyReading(limit),
+    });
+}
+
+export function useGetBookLength(bookId?: string, chapterId?: string, progress?: number) {
+    return useQuery({
+        queryKey: ['bookLength', bookId, chapterId, progress],
+        queryFn: () => getBookLength(bookId, chapterId, progress),
+        placeholderData: keepPreviousData,
+        enabled: !!bookId && bookId !== 'undefined',
+    });
+}
+
 export function useGetChaptersByBookId(id?: string) {
     return useQuery({
         queryKey: ['chapters', id],
@@ -44,6 +88,15 @@ export function useGetChaptersByBookId(id?: string) {
     });
 }
 
+export function useGetTocEntriesByBookId(id?: string) {
+    return useQuery({
+        queryKey: ['toc', id],
+        queryFn: () => getTocEntriesByBookId(id),
+        placeholderData: keepPreviousData,
+        enabled: !!id && id !== 'undefined',
+    });
+}
+
 export function useGetChapterById(id?: string) {
     return useQuery({
         queryKey: ['chapter', id],
@@ -102,3 +155,25 @@ export function useIsPaidUser() {
         refetchOnReconnect: 'always',
     });
 }
+
+export function useGetOpdsFeedKey() {
+    return useQuery({
+        queryKey: ['opds'],
+        queryFn: () => getOpdsFeedKey(),
+    });
+}
+
+export function useGetReadingPosition(bookId?: string) {
+    return useQuery({
+        queryKey: ['progress', bookId],
+        queryFn: () => getReadingPosition(bookId),
+        enabled: !!bookId && bookId !== 'undefined',
+    });
+}
+
+export function useGetReadingStats(days: number = 30) {
+    return useQuery({
+        queryKey: ['stats', days],
+        queryFn: () => getReadingStats(days),
+    });
+}
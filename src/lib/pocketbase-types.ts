@@ -14,15 +14,22 @@ export enum Collections {
 	AiSpendByUser = "ai_spend_by_user",
 	AiTotalSpend = "ai_total_spend",
 	AiUsage = "ai_usage",
+	Bookmarks = "bookmarks",
 	Books = "books",
 	Chapters = "chapters",
 	Chats = "chats",
 	Highlights = "highlights",
-	LastRead = "last_read",
 	Messages = "messages",
+	ReaderPreferences = "reader_preferences",
+	ReadingPositions = "reading_positions",
+	ReadingSessions = "reading_sessions",
 	StripeCharges = "stripe_charges",
 	StripeCustomers = "stripe_customers",
 	StripeSubscriptions = "stripe_subscriptions",
+	SyncCounters = "sync_counters",
+	SyncTombstones = "sync_tombstones",
+	Tags = "tags",
+	TocEntries = "toc_entries",
 	UploadsByUser = "uploads_by_user",
 	Users = "users",
 	Vectors = "vectors",
@@ -147,34 +154,66 @@ export type AiUsageRecord = {
 	user?: RecordIdString
 }
 
-export type BooksRecord = {
+export type BookmarksRecord = {
+	book: RecordIdString
+	chapter?: RecordIdString
+	created?: IsoDateString
+	id: string
+	label?: string
+	modified?: number
+	node_index?: number
+	offset?: number
+	path?: string
+	percentage?: number
+	seq?: number
+	updated?: IsoDateString
+	user: RecordIdString
+}
+
+export type BooksRecord<Tcontributors = unknown, Tidentifiers = unknown> = {
 	author?: string
 	chapters?: RecordIdString[]
+	character_count?: number
 	chats?: RecordIdString[]
+	content_hash?: string
+	contributors?: null | Tcontributors
 	cover_image?: string
 	created?: IsoDateString
-	current_chapter?: RecordIdString
 	date?: IsoDateString
 	description?: string
 	file: string
 	id: string
+	identifiers?: null | Tidentifiers
+	import_error?: string
+	isbn?: string
 	language?: string
+	publisher?: string
+	reading_minutes?: number
+	rights?: string
+	series?: string
+	series_index?: number
+	size?: number
 	subject?: string
 	title?: string
 	updated?: IsoDateString
 	user: RecordIdString
+	word_count?: number
 }
 
-export type ChaptersRecord = {
+export type ChaptersRecord<Tsanitize_report = unknown> = {
 	book: RecordIdString
+	character_count?: number
 	content: HTMLString
 	created?: IsoDateString
 	href?: string
 	id: string
 	order?: number
+	reading_minutes?: number
+	sanitize_report?: null | Tsanitize_report
 	title?: string
 	updated?: IsoDateString
 	user: RecordIdString
+	word_count?: number
 }
 
 export type ChatsRecord = {
@@ -187,27 +226,35 @@ export type ChatsRecord = {
 	user: RecordIdString
 }
 
+export enum HighlightsColorOptions {
+	"yellow" = "yellow",
+	"green" = "green",
+	"blue" = "blue",
+	"pink" = "pink",
+	"purple" = "purple",
+}
 export type HighlightsRecord<Tselection = unknown> = {
 	book?: RecordIdString
 	chapter: RecordIdString
+	color?: HighlightsColorOptions
 	created?: IsoDateString
+	end?: number
 	hash: string
 	id: string
-	selection: null | Tselection
+	modified?: number
+	note?: string
+	path?: string
+	prefix?: string
+	selection?: null | Tselection
+	seq?: number
+	start?: number
+	suffix?: string
+	tags?: RecordIdString[]
 	text: string
 	updated?: IsoDateString
 	user: RecordIdString
 }
 
-export type LastReadRecord = {
-	book?: RecordIdString
-	chapter?: RecordIdString
-	created?: IsoDateString
-	id: string
-	updated?: IsoDateString
-	user?: RecordIdString
-}
-
 export enum MessagesRoleOptions {
 	"user" = "user",
 	"assistant" = "assistant",
@@ -224,6 +271,52 @@ export type MessagesRecord<Tcitations = unknown> = {
 	user: RecordIdString
 }
 
+export type ReaderPreferencesRecord<Tvalue = unknown> = {
+	created?: IsoDateString
+	id: string
+	key: string
+	modified?: number
+	seq?: number
+	updated?: IsoDateString
+	user: RecordIdString
+	value?: null | Tvalue
+}
+
+export type ReadingPositionsRecord = {
+	book: RecordIdString
+	chapter?: RecordIdString
+	created?: IsoDateString
+	device?: string
+	id: string
+	node_index?: number
+	offset?: number
+	opened?: IsoDateString
+	path?: string
+	percentage?: number
+	removed?: boolean
+	seq?: number
+	timestamp?: number
+	updated?: IsoDateString
+	user: RecordIdString
+}
+
+export type ReadingSessionsRecord = {
+	book: RecordIdString
+	chapter?: RecordIdString
+	created?: IsoDateString
+	device?: string
+	duration?: number
+	end_percentage?: number
+	ended: IsoDateString
+	id: string
+	start_chapter?: RecordIdString
+	start_percentage?: number
+	started: IsoDateString
+	updated?: IsoDateString
+	user: RecordIdString
+	words?: number
+}
+
 export enum StripeChargesStatusOptions {
 	"succeeded" = "succeeded",
 	"pending" = "pending",
@@ -270,6 +363,54 @@ export type StripeSubscriptionsRecord<Tmetadata = unknown> = {
 	user?: RecordIdString
 }
 
+export type SyncCountersRecord = {
+	id: string
+	seq?: number
+	user: RecordIdString
+}
+
+export enum SyncTombstonesTypeOptions {
+	"progress" = "progress",
+	"highlight" = "highlight",
+	"bookmark" = "bookmark",
+	"preference" = "preference",
+	"tag" = "tag",
+}
+export type SyncTombstonesRecord = {
+	created?: IsoDateString
+	id: string
+	modified?: number
+	record: string
+	seq?: number
+	type: SyncTombstonesTypeOptions
+	updated?: IsoDateString
+	user: RecordIdString
+}
+
+export type TagsRecord = {
+	created?: IsoDateString
+	id: string
+	modified?: number
+	name: string
+	seq?: number
+	updated?: IsoDateString
+	user: RecordIdString
+}
+
+export type TocEntriesRecord = {
+	book: RecordIdString
+	chapter?: RecordIdString
+	created?: IsoDateString
+	depth?: number
+	fragment?: string
+	id: string
+	label?: string
+	order?: number
+	parent?: RecordIdString
+	updated?: IsoDateString
+	user: RecordIdString
+}
+
 export type UploadsByUserRecord = {
 	email: string
 	id: string
@@ -284,6 +425,7 @@ export type UsersRecord = {
 	emailVisibility?: boolean
 	id: string
 	name?: string
+	opds_key?: string
 	paid?: boolean
 	password: string
 	tokenKey: string
@@ -312,15 +454,22 @@ export type SuperusersResponse<Texpand = unknown> = Required<SuperusersRecord> &
 export type AiSpendByUserResponse<Ttotal_spend = unknown, Texpand = unknown> = Required<AiSpendByUserRecord<Ttotal_spend>> & BaseSystemFields<Texpand>
 export type AiTotalSpendResponse<Tgoogle_total = unknown, Tgrand_total = unknown, Topenai_total = unknown, Texpand = unknown> = Required<AiTotalSpendRecord<Tgoogle_total, Tgrand_total, Topenai_total>> & BaseSystemFields<Texpand>
 export type AiUsageResponse<Texpand = unknown> = Required<AiUsageRecord> & BaseSystemFields<Texpand>
-export type BooksResponse<Texpand = unknown> = Required<BooksRecord> & BaseSystemFields<Texpand>
-export type ChaptersResponse<Texpand = unknown> = Required<ChaptersRecord> & BaseSystemFields<Texpand>
+export type BookmarksResponse<Texpand = unknown> = Required<BookmarksRecord> & BaseSystemFields<Texpand>
+export type BooksResponse<Tcontributors = unknown, Tidentifiers = unknown, Texpand = unknown> = Required<BooksRecord<Tcontributors, Tidentifiers>> & BaseSystemFields<Texpand>
+export type ChaptersResponse<Tsanitize_report = unknown, Texpand = unknown> = Required<ChaptersRecord<Tsanitize_report>> & BaseSystemFields<Texpand>
 export type ChatsResponse<Texpand = unknown> = Required<ChatsRecord> & BaseSystemFields<Texpand>
 export type HighlightsResponse<Tselection = unknown, Texpand = unknown> = Required<HighlightsRecord<Tselection>> & BaseSystemFields<Texpand>
-export type LastReadResponse<Texpand = unknown> = Required<LastReadRecord> & BaseSystemFields<Texpand>
 export type MessagesResponse<Tcitations = unknown, Texpand = unknown> = Required<MessagesRecord<Tcitations>> & BaseSystemFields<Texpand>
+export type ReaderPreferencesResponse<Tvalue = unknown, Texpand = unknown> = Required<ReaderPreferencesRecord<Tvalue>> & BaseSystemFields<Texpand>
+export type ReadingPositionsResponse<Texpand = unknown> = Required<ReadingPositionsRecord> & BaseSystemFields<Texpand>
+export type ReadingSessionsResponse<Texpand = unknown> = Required<ReadingSessionsRecord> & BaseSystemFields<Texpand>
 export type StripeChargesResponse<Tmetadata = unknown, Texpand = unknown> = Required<StripeChargesRecord<Tmetadata>> & BaseSystemFields<Texpand>
 export type StripeCustomersResponse<Texpand = unknown> = Required<StripeCustomersRecord> & BaseSystemFields<Texpand>
 export type StripeSubscriptionsResponse<Tmetadata = unknown, Texpand = unknown> = Required<StripeSubscriptionsRecord<Tmetadata>> & BaseSystemFields<Texpand>
+export type SyncCountersResponse<Texpand = unknown> = Required<SyncCountersRecord> & BaseSystemFields<Texpand>
+export type SyncTombstonesResponse<Texpand = unknown> = Required<SyncTombstonesRecord> & BaseSystemFields<Texpand>
+export type TagsResponse<Texpand = unknown> = Required<TagsRecord> & BaseSystemFields<Texpand>
+export type TocEntriesResponse<Texpand = unknown> = Required<TocEntriesRecord> & BaseSystemFields<Texpand>
 export type UploadsByUserResponse<Texpand = unknown> = Required<UploadsByUserRecord> & BaseSystemFields<Texpand>
 export type UsersResponse<Texpand = unknown> = Required<UsersRecord> & AuthSystemFields<Texpand>
 export type VectorsResponse<Texpand = unknown> = Required<VectorsRecord> & BaseSystemFields<Texpand>
@@ -336,15 +485,22 @@ export type CollectionRecords = {
 	ai_spend_by_user: AiSpendByUserRecord
 	ai_total_spend: AiTotalSpendRecord
 	ai_usage: AiUsageRecord
+	bookmarks: BookmarksRecord
 	books: BooksRecord
 	chapters: ChaptersRecord
 	chats: ChatsRecord
 	highlights: HighlightsRecord
-	last_read: LastReadRecord
 	messages: MessagesRecord
+	reader_preferences: ReaderPreferencesRecord
+	reading_positions: ReadingPositionsRecord
+	reading_sessions: ReadingSessionsRecord
 	stripe_charges: StripeChargesRecord
 	stripe_customers: StripeCustomersRecord
 	stripe_subscriptions: StripeSubscriptionsRecord
+	sync_counters: SyncCountersRecord
+	sync_tombstones: SyncTombstonesRecord
+	tags: TagsRecord
+	toc_entries: TocEntriesRecord
 	uploads_by_user: UploadsByUserRecord
 	users: UsersRecord
 	vectors: VectorsRecord
@@ -359,15 +515,22 @@ export type CollectionResponses = {
 	ai_spend_by_user: AiSpendByUserResponse
 	ai_total_spend: AiTotalSpendResponse
 	ai_usage: AiUsageResponse
+	bookmarks: BookmarksResponse
 	books: BooksResponse
 	chapters: ChaptersResponse
 	chats: ChatsResponse
 	highlights: HighlightsResponse
-	last_read: LastReadResponse
 	messages: MessagesResponse
+	reader_preferences: ReaderPreferencesResponse
+	reading_positions: ReadingPositionsResponse
+	reading_sessions: ReadingSessionsResponse
 	stripe_charges: StripeChargesResponse
 	stripe_customers: StripeCustomersResponse
 	stripe_subscriptions: StripeSubscriptionsResponse
+	sync_counters: SyncCountersResponse
+	sync_tombstones: SyncTombstonesResponse
+	tags: TagsResponse
+	toc_entries: TocEntriesResponse
 	uploads_by_user: UploadsByUserResponse
 	users: UsersResponse
 	vectors: VectorsResponse
@@ -385,15 +548,22 @@ export type TypedPocketBase = PocketBase & {
 	collection(idOrName: 'ai_spend_by_user'): RecordService<AiSpendByUserResponse>
 	collection(idOrName: 'ai_total_spend'): RecordService<AiTotalSpendResponse>
 	collection(idOrName: 'ai_usage'): RecordService<AiUsageResponse>
+	collection(idOrName: 'bookmarks'): RecordService<BookmarksResponse>
 	collection(idOrName: 'books'): RecordService<BooksResponse>
 	collection(idOrName: 'chapters'): RecordService<ChaptersResponse>
 	collection(idOrName: 'chats'): RecordService<ChatsResponse>
 	collection(idOrName: 'highlights'): RecordService<HighlightsResponse>
-	collection(idOrName: 'last_read'): RecordService<LastReadResponse>
 	collection(idOrName: 'messages'): RecordService<MessagesResponse>
+	collection(idOrName: 'reader_preferences'): RecordService<ReaderPreferencesResponse>
+	collection(idOrName: 'reading_positions'): RecordService<ReadingPositionsResponse>
+	collection(idOrName: 'reading_sessions'): RecordService<ReadingSessionsResponse>
 	collection(idOrName: 'stripe_charges'): RecordService<StripeChargesResponse>
 	collection(idOrName: 'stripe_customers'): RecordService<StripeCustomersResponse>
 	collection(idOrName: 'stripe_subscriptions'): RecordService<StripeSubscriptionsResponse>
+	collection(idOrName: 'sync_counters'): RecordService<SyncCountersResponse>
+	collection(idOrName: 'sync_tombstones'): RecordService<SyncTombstonesResponse>
+	collection(idOrName: 'tags'): RecordService<TagsResponse>
+	collection(idOrName: 'toc_entries'): RecordService<TocEntriesResponse>
 	collection(idOrName: 'uploads_by_user'): RecordService<UploadsByUserResponse>
 	collection(idOrName: 'users'): RecordService<UsersResponse>
 	collection(idOrName: 'vectors'): RecordService<VectorsResponse>
@@ -1,4 +1,4 @@
-import { BooksResponse, ChaptersResponse, MessagesResponse } from "./pocketbase-types";
+import { BooksResponse, ChaptersResponse, HighlightsColorOptions, MessagesResponse } from "./pocketbase-types";
 
 export interface Citation {
     quote: string;
@@ -27,4 +27,274 @@ export type UploadFileRequest = {
     user: string;
     file: File;
     cover_image?: File;
-}
\ No newline at end of file
+}
+export type IngestStatus = "queued" | "parsing" | "chunking" | "embedding" | "ready" | "failed";
+
+export type IngestJob = {
+    id: string;
+    book: string;
+    kind: "import" | "reimport" | "";
+    status: IngestStatus;
+    attempts: number;
+    chapters_total: number;
+    chapters_done: number;
+    vectors_total: number;
+    vectors_done: number;
+    error: string;
+    // what a reimport changed, once its chapters are updated
+    report: ReimportReport | null;
+}
+
+export type QuotaValues = {
+    books: number;
+    storageBytes: number;
+    messagesPerDay: number;
+    embeddingTokensPerMonth: number;
+}
+
+export type Quota = {
+    plan: "free" | "paid";
+    limits: QuotaValues;
+    usage: QuotaValues;
+}
+
+export type ReimportReport = {
+    chaptersAdded: number;
+    chaptersUpdated: number;
+    chaptersUnchanged: number;
+    chaptersRemoved: number;
+    highlightsReanchored: number;
+    highlightsUnanchored: number;
+}
+
+export type BulkImportResult = {
+    name: string;
+    status: "imported" | "duplicate" | "failed";
+    book?: string;
+    error?: string;
+}
+
+export type BulkImportReport = {
+    imported: number;
+    duplicate: number;
+    failed: number;
+    results: BulkImportResult[];
+}
+
+export type OpdsFeedKey = {
+    key: string;
+    url: string;
+}
+
+export type RemoteCatalogRequest = {
+    url: string;
+    username?: string;
+    password?: string;
+}
+
+export type RemoteLink = {
+    href: string;
+    type: string;
+}
+
+export type RemoteEntry = {
+    id: string;
+    title: string;
+    author?: string;
+    summary?: string;
+    cover?: string;
+    acquisitions: RemoteLink[];
+    navigation?: string;
+}
+
+export type RemoteFeed = {
+    url: string;
+    title: string;
+    entries: RemoteEntry[];
+    start?: string;
+    next?: string;
+    previous?: string;
+    search?: string;
+}
+
+export type BookContributor = {
+    name: string;
+    role: string;
+    fileAs?: string;
+}
+
+export type BookIdentifier = {
+    scheme: string;
+    value: string;
+}
+
+export type ChapterLength = {
+    id: string;
+    title: string;
+    order: number;
+    words: number;
+    characters: number;
+    minutes: number;
+}
+
+export type BookLength = {
+    words: number;
+    characters: number;
+    minutes: number;
+    chapters: ChapterLength[];
+    chapterMinutesLeft?: number;
+    bookMinutesLeft?: number;
+}
+
+export type ReadingPosition = {
+    book: string;
+    chapter: string;
+    path: string;
+    nodeIndex: number;
+    offset: number;
+    percentage: number;
+    timestamp: number;
+    device: string;
+    opened?: string;
+}
+
+export type CurrentBook = ReadingPosition & {
+    title: string;
+    author: string;
+    completion: number;
+}
+
+export type ReadingHeartbeat = {
+    book: string;
+    chapter: string;
+    percentage: number;
+    device?: string;
+}
+
+export type ReadingSession = {
+    id: string;
+    book: string;
+    chapter: string;
+    startChapter: string;
+    startPercentage: number;
+    endPercentage: number;
+    started: string;
+    ended: string;
+    duration: number;
+    words: number;
+    device: string;
+}
+
+export type ReadingPeriod = {
+    start: string;
+    seconds: number;
+    words: number;
+    sessions: number;
+}
+
+export type ReadingStats = {
+    days: ReadingPeriod[];
+    weeks: ReadingPeriod[];
+    sessions: {
+        count: number;
+        seconds: number;
+        words: number;
+        averageSeconds: number;
+        averageWords: number;
+        averagePages: number;
+    };
+    streak: {
+        current: number;
+        longest: number;
+    };
+    books: {
+        book: string;
+        title: string;
+        percentage: number;
+        seconds: number;
+        lastRead?: string;
+    }[];
+}
+
+export type SyncChangeType = "progress" | "highlight" | "bookmark" | "preference" | "tag";
+
+export type SyncChange = {
+    type: SyncChangeType;
+    id: string;
+    timestamp: number;
+    deleted?: boolean;
+    data?: unknown;
+    seq?: number;
+}
+
+export type SyncRequest = {
+    cursor: number;
+    device?: string;
+    changes: SyncChange[];
+}
+
+export type SyncResponse = {
+    cursor: number;
+    more: boolean;
+    changes: SyncChange[];
+    errors: {
+        index: number;
+        message: string;
+    }[];
+}
+
+export type Tag = {
+    id: string;
+    name: string;
+}
+
+export type TagCount = Tag & {
+    count: number;
+}
+
+export type LibraryHighlight = {
+    id: string;
+    book: string;
+    bookTitle: string;
+    chapter: string;
+    chapterTitle: string;
+    text: string;
+    color: HighlightsColorOptions | "";
+    note: string;
+    tags: Tag[];
+    created: string;
+}
+
+export type HighlightFilters = {
+    book?: string;
+    tags?: string[];
+    colors?: HighlightsColorOptions[];
+    page?: number;
+    perPage?: number;
+}
+
+export type HighlightList = {
+    page: number;
+    perPage: number;
+    totalItems: number;
+    items: LibraryHighlight[];
+}
+
+export type HighlightExportFormat = "md" | "csv" | "json" | "txt";
+
+export type ClippingResult = {
+    title: string;
+    author: string;
+    text: string;
+    status: "imported" | "duplicate" | "unmatched";
+    book?: string;
+    highlight?: string;
+    error?: string;
+}
+
+export type ClippingsReport = {
+    imported: number;
+    duplicate: number;
+    unmatched: number;
+    results: ClippingResult[];
+}
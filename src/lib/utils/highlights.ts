@@ -1,4 +1,4 @@
-import { Descendant, Node, PointApi, Range } from "platejs";
+import { Descendant, Node, PointApi, Range, RangeApi } from "platejs";
 import { PlateEditor } from "platejs/react";
 
 export const findHighlightedElementInEditor = (editorChildren: Node[], highlightText: string): Node | undefined => {
@@ -124,4 +124,13 @@ export async function createHighlightHash(bookId: string, chapterId: string, sel
     const hashBuffer = await crypto.subtle.digest("SHA-256", data);
     const hashArray = Array.from(new Uint8Array(hashBuffer));
     return hashArray.map((b) => b.toString(16).padStart(2, "0")).join("");
-}
\ No newline at end of file
+}
+
+// the text around the selection, which the server uses to tell apart
+// occurrences of the same text in the chapter
+export const getSelectionContext = (editor: PlateEditor, selection: Range, length = 32) => {
+    const [start, end] = RangeApi.edges(selection);
+    const prefix = editor.api.string({ anchor: editor.api.start([])!, focus: start });
+    const suffix = editor.api.string({ anchor: end, focus: editor.api.end([])! });
+    return { prefix: prefix.slice(-length), suffix: suffix.slice(0, length) };
+};
@@ -140,4 +140,13 @@ export const getPageNumbers = (totalPages: number, currentPage: number) => {
   }
 
   return pageNumbers;
-};
\ No newline at end of file
+};
+// Chapter content links to its images with root-relative /api/files/ paths,
+// which only resolve against the page when the app is served by PocketBase.
+export const resolveFileUrls = (html: string): string => {
+  return html.replace(/(\s(?:src|href|xlink:href)=["'])\/api\/files\//g, `$1${pb.baseURL}api/files/`);
+};
+
+export const relativeFileUrls = (html: string): string => {
+  return html.split(`${pb.baseURL}api/files/`).join("/api/files/");
+};
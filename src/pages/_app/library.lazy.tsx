@@ -38,7 +38,7 @@ function LibraryPage() {
   const handleReadBook = (book: BooksResponse) => {
     navigate({
       to: `/reader/${book.id}`,
-      search: { chapter: book.current_chapter || book.chapters?.[0] },
+      search: { chapter: undefined },
     });
   };
 
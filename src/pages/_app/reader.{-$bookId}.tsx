@@ -1,5 +1,5 @@
 import { createFileRoute } from "@tanstack/react-router";
-import { useGetBookById, useGetChapterById, useGetChaptersByBookId, useGetLastReadBook } from "@/lib/api/queries";
+import { useGetChapterById, useGetChaptersByBookId, useGetLastOpenedPosition, useGetReadingPosition, useGetTocEntriesByBookId } from "@/lib/api/queries";
 import { PlateController } from "platejs/react";
 import { useCallback, useEffect } from "react";
 import { useNavigate } from "@tanstack/react-router";
@@ -26,9 +26,10 @@ function Index() {
 
   const { data: chapter} = useGetChapterById(chapterId);
   const { data: chaptersData } = useGetChaptersByBookId(bookId);
-  const { data: book } = useGetBookById(bookId);
+  const { data: tocData } = useGetTocEntriesByBookId(bookId);
   const { selectedHighlight } = useSelectedHighlightStore();
-  const { data: lastReadBook, refetch: refetchLastReadBook } = useGetLastReadBook();
+  const { data: position } = useGetReadingPosition(chapterId ? undefined : bookId);
+  const { data: lastOpened, refetch: refetchLastOpened } = useGetLastOpenedPosition();
   const { currentChapterId, setCurrentChapterId } = useCurrentChapterStore();
 
   const navigateTo = useCallback(
@@ -54,20 +55,20 @@ function Index() {
 
   useEffect(() => {
     if (!bookId || bookId === "undefined") {
-      if (lastReadBook) {
-        navigateTo(lastReadBook.book, lastReadBook.chapter, true);
+      if (lastOpened) {
+        navigateTo(lastOpened.book, lastOpened.chapter, true);
       } else {
-        refetchLastReadBook();
+        refetchLastOpened();
       }
       return;
     }
 
     if (chapterId) {
       setCurrentChapterId(chapterId);
-    } else if (book?.current_chapter) {
-      navigateTo(bookId, book.current_chapter, true);
+    } else if (position?.chapter) {
+      navigateTo(bookId, position.chapter, true);
     }
-  }, [bookId, chapterId, lastReadBook, book, navigateTo, refetchLastReadBook, setCurrentChapterId]);
+  }, [bookId, chapterId, lastOpened, position, navigateTo, refetchLastOpened, setCurrentChapterId]);
 
   useEffect(() => {
     if (selectedHighlight?.chapter && selectedHighlight.chapter !== currentChapterId) {
@@ -92,15 +93,26 @@ function Index() {
           </PopoverTrigger>
           <PopoverContent align="start">
             <ul className="p-1 flex flex-col gap-2 max-h-96 overflow-y-auto overflow-x-hidden no-scrollbar">
-              {chaptersData?.map((chapter) => (
-                <li
-                  key={chapter.id}
-                  onClick={() => goToChapter(chapter.id)}
-                  className={`cursor-pointer p-2 rounded hover:bg-accent ${chapter.id === currentChapterId ? "bg-accent" : ""}`}
-                >
-                  {chapter.title}
-                </li>
-              ))}
+              {tocData?.length
+                ? tocData.map((entry) => (
+                    <li
+                      key={entry.id}
+                      onClick={() => entry.chapter && goToChapter(entry.chapter)}
+                      style={{ paddingLeft: `${0.5 + entry.depth}rem` }}
+                      className={`p-2 rounded ${entry.chapter ? "cursor-pointer hover:bg-accent" : "font-medium"} ${entry.chapter && entry.chapter === currentChapterId && !entry.fragment ? "bg-accent" : ""}`}
+                    >
+                      {entry.label}
+                    </li>
+                  ))
+                : chaptersData?.map((chapter) => (
+                    <li
+                      key={chapter.id}
+                      onClick={() => goToChapter(chapter.id)}
+                      className={`cursor-pointer p-2 rounded hover:bg-accent ${chapter.id === currentChapterId ? "bg-accent" : ""}`}
+                    >
+                      {chapter.title}
+                    </li>
+                  ))}
             </ul>
           </PopoverContent>
         </Popover>